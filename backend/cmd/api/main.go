@@ -7,12 +7,17 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
 	"github.com/Wangren-Academy/Agent/backend/internal/api/handlers"
+	"github.com/Wangren-Academy/Agent/backend/internal/mcp"
 	"github.com/Wangren-Academy/Agent/backend/internal/store"
+	"github.com/Wangren-Academy/Agent/backend/internal/tools"
 	"github.com/Wangren-Academy/Agent/backend/internal/websocket"
+	"github.com/Wangren-Academy/Agent/backend/internal/workflow"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -39,6 +44,38 @@ func main() {
 	hub := websocket.NewHub()
 	go hub.Run()
 
+	// Register model executors
+	registry := agent.NewRegistry()
+	if apiKey := os.Getenv("OPENAI_API_KEY"); apiKey != "" {
+		registry.Register(agent.NewOpenAIAdapter(apiKey))
+	}
+	if apiKey := os.Getenv("ANTHROPIC_API_KEY"); apiKey != "" {
+		anthropic := agent.NewAnthropicAdapter(apiKey)
+		if baseURL := os.Getenv("ANTHROPIC_BASE_URL"); baseURL != "" {
+			anthropic.SetBaseURL(baseURL)
+		}
+		registry.Register(anthropic)
+	}
+	localAdapter := agent.NewLocalAdapter(getEnv("LOCAL_MODEL_URL", "http://localhost:11434"))
+	registry.Register(localAdapter)
+
+	// Register tools available to agents
+	httpAllowlist := splitList(getEnv("TOOL_HTTP_ALLOWLIST", ""))
+	toolRegistry := tools.NewRegistry()
+	tools.RegisterBuiltins(toolRegistry, tools.BuiltinOptions{
+		HTTPAllowlist: httpAllowlist,
+	})
+
+	// Connect to external MCP tool servers
+	if path := os.Getenv("MCP_SERVERS_CONFIG"); path != "" {
+		clients := connectMCPServers(path, toolRegistry)
+		defer func() {
+			for _, client := range clients {
+				client.Close()
+			}
+		}()
+	}
+
 	// Setup Gin router
 	gin.SetMode(getEnv("GIN_MODE", "debug"))
 	r := gin.Default()
@@ -58,6 +95,9 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
+	// Running executions, shared by the handlers that start and control them
+	runs := workflow.NewRuns()
+
 	// API routes
 	api := r.Group("/api/v1")
 	{
@@ -70,7 +110,11 @@ func main() {
 		api.DELETE("/agents/:id", agentHandler.Delete)
 
 		// Workflow routes
-		workflowHandler := handlers.NewWorkflowHandler(db)
+		workflowHandler := handlers.NewWorkflowHandler(db, registry)
+		workflowHandler.SetHub(hub)
+		workflowHandler.SetTools(toolRegistry)
+		workflowHandler.SetHTTPClient(tools.NewAllowlistClient(httpAllowlist))
+		workflowHandler.SetRuns(runs)
 		api.GET("/workflows", workflowHandler.List)
 		api.POST("/workflows", workflowHandler.Create)
 		api.GET("/workflows/:id", workflowHandler.Get)
@@ -78,15 +122,44 @@ func main() {
 		api.DELETE("/workflows/:id", workflowHandler.Delete)
 		api.POST("/workflows/:id/execute", workflowHandler.Execute)
 
+		// Model discovery routes
+		modelHandler := handlers.NewModelHandler(localAdapter)
+		api.GET("/models/local", modelHandler.ListLocal)
+
+		// Tool routes
+		toolHandler := handlers.NewToolHandler(toolRegistry)
+		api.GET("/tools", toolHandler.List)
+
 		// Execution routes
 		executionHandler := handlers.NewExecutionHandler(db)
+		executionHandler.SetRuns(runs)
+		executionHandler.SetWorkflows(workflowHandler)
+		hub.SetHandler(executionHandler)
+		hub.SetHistory(executionHandler)
 		api.GET("/executions", executionHandler.List)
 		api.GET("/executions/:id", executionHandler.Get)
 		api.POST("/executions/:id/replay", executionHandler.Replay)
+		api.GET("/executions/:id/diff/:other_id", executionHandler.Diff)
+		api.GET("/executions/:id/logs", executionHandler.Logs)
+		api.POST("/executions/:id/approvals/:node_id", executionHandler.Decide)
+		api.POST("/executions/:id/cancel", executionHandler.Cancel)
+		api.POST("/executions/:id/pause", executionHandler.Pause)
+		api.POST("/executions/:id/resume", executionHandler.Resume)
+		api.PUT("/executions/:id/nodes/:node_id/output", executionHandler.EditOutput)
+
+		// Pick up executions left unfinished by a restart. EXECUTION_RECOVERY=fail
+		// marks interrupted executions failed instead of resuming them.
+		resumeInterrupted := getEnv("EXECUTION_RECOVERY", "resume") != "fail"
+		if err := workflowHandler.RecoverExecutions(context.Background(), resumeInterrupted); err != nil {
+			log.Printf("Failed to recover executions: %v", err)
+		}
 	}
 
 	// WebSocket endpoint
+	// Connect with ?since=<sequence> to receive the events journaled after
+	// it before live ones
 	r.GET("/ws/executions/:id", func(c *gin.Context) {
+		c.Request.SetPathValue("id", c.Param("id"))
 		websocket.ServeWS(hub, c.Writer, c.Request)
 	})
 
@@ -125,3 +198,44 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// connectMCPServers connects to every configured MCP server and registers its
+// tools. Servers that fail to start are logged and skipped.
+func connectMCPServers(path string, registry *tools.Registry) []*mcp.Client {
+	cfg, err := mcp.LoadConfig(path)
+	if err != nil {
+		log.Printf("Failed to load MCP config: %v", err)
+		return nil
+	}
+
+	var clients []*mcp.Client
+	for _, server := range cfg.Servers {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		client, err := mcp.Connect(ctx, server)
+		if err != nil {
+			cancel()
+			log.Printf("Failed to connect to MCP server %s: %v", server.Name, err)
+			continue
+		}
+		names, err := mcp.RegisterTools(ctx, registry, client)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to list tools of MCP server %s: %v", server.Name, err)
+			client.Close()
+			continue
+		}
+		log.Printf("Connected to MCP server %s (%d tools)", server.Name, len(names))
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
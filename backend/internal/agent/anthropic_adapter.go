@@ -0,0 +1,420 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	anthropicVersion          = "2023-06-01"
+	anthropicDefaultMaxTokens = 4096
+)
+
+// AnthropicAdapter implements Executor for Anthropic models
+type AnthropicAdapter struct {
+	apiKey     string
+	httpClient *http.Client
+	baseURL    string
+}
+
+// NewAnthropicAdapter creates a new Anthropic adapter
+func NewAnthropicAdapter(apiKey string) *AnthropicAdapter {
+	return &AnthropicAdapter{
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: 120 * time.Second},
+		baseURL:    "https://api.anthropic.com/v1",
+	}
+}
+
+// SetBaseURL overrides the API base URL (e.g. for proxies or test servers)
+func (a *AnthropicAdapter) SetBaseURL(baseURL string) {
+	a.baseURL = strings.TrimRight(baseURL, "/")
+}
+
+// Name returns the adapter name
+func (a *AnthropicAdapter) Name() string {
+	return "anthropic"
+}
+
+// anthropicBlock is a single content block of the Messages API
+type anthropicBlock struct {
+	Type      string         `json:"type"`
+	Text      string         `json:"text,omitempty"`
+	ID        string         `json:"id,omitempty"`
+	Name      string         `json:"name,omitempty"`
+	Input     map[string]any `json:"input"`
+	ToolUseID string         `json:"tool_use_id,omitempty"`
+	Content   string         `json:"content,omitempty"`
+}
+
+// MarshalJSON always sends a tool_use block's input as an object, even for
+// tools without arguments, and leaves it out of every other block type
+func (b anthropicBlock) MarshalJSON() ([]byte, error) {
+	type block anthropicBlock
+	if b.Type == "tool_use" {
+		if b.Input == nil {
+			b.Input = make(map[string]any)
+		}
+		return json.Marshal(block(b))
+	}
+	return json.Marshal(struct {
+		block
+		Input map[string]any `json:"input,omitempty"`
+	}{block: block(b)})
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+// Execute sends a request to Anthropic and returns the result
+func (a *AnthropicAdapter) Execute(ctx context.Context, messages []Message, config Config) (*Result, error) {
+	startTime := time.Now()
+
+	reqBody := a.buildRequest(messages, config)
+
+	resp, err := a.send(ctx, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var apiResp struct {
+		Content    []anthropicBlock `json:"content"`
+		StopReason string           `json:"stop_reason"`
+		Usage      struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	result := &Result{
+		StopReason: anthropicStopReason(apiResp.StopReason),
+		Usage: TokenUsage{
+			PromptTokens:     apiResp.Usage.InputTokens,
+			CompletionTokens: apiResp.Usage.OutputTokens,
+			TotalTokens:      apiResp.Usage.InputTokens + apiResp.Usage.OutputTokens,
+		},
+	}
+
+	var text strings.Builder
+	for _, block := range apiResp.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			args := block.Input
+			if args == nil {
+				args = make(map[string]any)
+			}
+			result.ToolCalls = append(result.ToolCalls, ToolCall{
+				ID:   block.ID,
+				Type: "function",
+				Function: FunctionCall{
+					Name:      block.Name,
+					Arguments: args,
+				},
+			})
+		}
+	}
+	result.Content = text.String()
+	result.Latency = time.Since(startTime)
+
+	return result, nil
+}
+
+// ExecuteStream sends a streaming request to Anthropic, forwarding text
+// deltas to onDelta and assembling tool_use input from partial JSON
+func (a *AnthropicAdapter) ExecuteStream(ctx context.Context, messages []Message, config Config, onDelta DeltaHandler) (*Result, error) {
+	startTime := time.Now()
+
+	reqBody := a.buildRequest(messages, config)
+	reqBody["stream"] = true
+
+	resp, err := a.send(ctx, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var event struct {
+		Type    string `json:"type"`
+		Index   int    `json:"index"`
+		Message struct {
+			Usage struct {
+				InputTokens int `json:"input_tokens"`
+			} `json:"usage"`
+		} `json:"message"`
+		ContentBlock anthropicBlock `json:"content_block"`
+		Delta        struct {
+			Type        string `json:"type"`
+			Text        string `json:"text"`
+			PartialJSON string `json:"partial_json"`
+			StopReason  string `json:"stop_reason"`
+		} `json:"delta"`
+		Usage struct {
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+
+	type blockState struct {
+		block     anthropicBlock
+		inputJSON strings.Builder
+	}
+
+	result := &Result{}
+	var text strings.Builder
+	blocks := make(map[int]*blockState)
+	var order []int
+	var streamErr error
+
+	err = readSSE(resp.Body, func(ev sseEvent) bool {
+		event.Delta.Type, event.Delta.Text, event.Delta.PartialJSON, event.Delta.StopReason = "", "", "", ""
+		event.ContentBlock = anthropicBlock{}
+		if err := json.Unmarshal([]byte(ev.Data), &event); err != nil {
+			streamErr = fmt.Errorf("decode stream event: %w", err)
+			return false
+		}
+		switch event.Type {
+		case "message_start":
+			result.Usage.PromptTokens = event.Message.Usage.InputTokens
+		case "content_block_start":
+			blocks[event.Index] = &blockState{block: event.ContentBlock}
+			order = append(order, event.Index)
+		case "content_block_delta":
+			state, ok := blocks[event.Index]
+			if !ok {
+				return true
+			}
+			switch event.Delta.Type {
+			case "text_delta":
+				text.WriteString(event.Delta.Text)
+				if onDelta != nil {
+					onDelta(event.Delta.Text)
+				}
+			case "input_json_delta":
+				state.inputJSON.WriteString(event.Delta.PartialJSON)
+			}
+		case "message_delta":
+			if event.Delta.StopReason != "" {
+				result.StopReason = anthropicStopReason(event.Delta.StopReason)
+			}
+			result.Usage.CompletionTokens = event.Usage.OutputTokens
+		case "message_stop":
+			return false
+		case "error":
+			streamErr = fmt.Errorf("anthropic stream error (%s): %s", event.Error.Type, event.Error.Message)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read stream: %w", err)
+	}
+	if streamErr != nil {
+		return nil, streamErr
+	}
+
+	for _, idx := range order {
+		state := blocks[idx]
+		if state.block.Type != "tool_use" {
+			continue
+		}
+		args := parseArguments(state.inputJSON.String())
+		result.ToolCalls = append(result.ToolCalls, ToolCall{
+			ID:   state.block.ID,
+			Type: "function",
+			Function: FunctionCall{
+				Name:      state.block.Name,
+				Arguments: args,
+			},
+		})
+	}
+
+	result.Content = text.String()
+	result.Usage.TotalTokens = result.Usage.PromptTokens + result.Usage.CompletionTokens
+	result.Latency = time.Since(startTime)
+
+	return result, nil
+}
+
+// send posts a Messages API request and checks the response status
+func (a *AnthropicAdapter) send(ctx context.Context, reqBody map[string]any) (*http.Response, error) {
+	b, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.baseURL+"/messages", bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("x-api-key", a.apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("anthropic api error: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		var apiErr struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(bodyBytes, &apiErr) == nil && apiErr.Error.Message != "" {
+			return nil, fmt.Errorf("anthropic api returned status %d (%s): %s", resp.StatusCode, apiErr.Error.Type, apiErr.Error.Message)
+		}
+		return nil, fmt.Errorf("anthropic api returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	return resp, nil
+}
+
+// buildRequest converts the conversation into a Messages API request body.
+// System messages are hoisted into the top-level "system" field, tool results
+// become tool_result blocks and consecutive messages of the same role are
+// merged, since the API requires user/assistant turns to alternate.
+func (a *AnthropicAdapter) buildRequest(messages []Message, config Config) map[string]any {
+	var system []string
+	var out []anthropicMessage
+
+	appendBlocks := func(role string, blocks ...anthropicBlock) {
+		if len(blocks) == 0 {
+			return
+		}
+		if n := len(out); n > 0 && out[n-1].Role == role {
+			out[n-1].Content = append(out[n-1].Content, blocks...)
+			return
+		}
+		out = append(out, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			if msg.Content != "" {
+				system = append(system, msg.Content)
+			}
+		case "tool":
+			appendBlocks("user", anthropicBlock{
+				Type:      "tool_result",
+				ToolUseID: msg.ToolCallID,
+				Content:   msg.Content,
+			})
+		case "assistant":
+			// The API rejects empty text blocks, which would otherwise sit
+			// next to the tool_use blocks of a tool-calling turn
+			var blocks []anthropicBlock
+			if strings.TrimSpace(msg.Content) != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				blocks = append(blocks, anthropicBlock{
+					Type:  "tool_use",
+					ID:    tc.ID,
+					Name:  tc.Function.Name,
+					Input: tc.Function.Arguments,
+				})
+			}
+			appendBlocks("assistant", blocks...)
+		default:
+			if strings.TrimSpace(msg.Content) != "" {
+				appendBlocks("user", anthropicBlock{Type: "text", Text: msg.Content})
+			}
+		}
+	}
+
+	maxTokens := config.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = anthropicDefaultMaxTokens
+	}
+
+	reqBody := map[string]any{
+		"model":      config.Model,
+		"messages":   out,
+		"max_tokens": maxTokens,
+	}
+	if len(system) > 0 {
+		reqBody["system"] = strings.Join(system, "\n\n")
+	}
+	if config.Temperature != nil {
+		reqBody["temperature"] = *config.Temperature
+	}
+	if config.TopP > 0 {
+		reqBody["top_p"] = config.TopP
+	}
+
+	if len(config.Tools) > 0 {
+		tools := make([]anthropicTool, 0, len(config.Tools))
+		for _, t := range config.Tools {
+			schema := t.Function.Parameters
+			if schema == nil {
+				schema = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			tools = append(tools, anthropicTool{
+				Name:        t.Function.Name,
+				Description: t.Function.Description,
+				InputSchema: schema,
+			})
+		}
+		reqBody["tools"] = tools
+		if choice, ok := config.Extra["tool_choice"].(string); ok {
+			reqBody["tool_choice"] = anthropicToolChoice(choice)
+		}
+	}
+
+	return reqBody
+}
+
+// anthropicToolChoice accepts the same values as the OpenAI adapter:
+// "auto", "none", "required" or a bare tool name
+func anthropicToolChoice(choice string) map[string]any {
+	switch choice {
+	case "auto", "none":
+		return map[string]any{"type": choice}
+	case "required":
+		return map[string]any{"type": "any"}
+	}
+	return map[string]any{"type": "tool", "name": choice}
+}
+
+// anthropicStopReason maps Anthropic stop reasons onto the normalized values
+func anthropicStopReason(reason string) string {
+	switch reason {
+	case "end_turn", "stop_sequence":
+		return StopReasonEnd
+	case "max_tokens":
+		return StopReasonMaxTokens
+	case "tool_use":
+		return StopReasonToolCalls
+	default:
+		return reason
+	}
+}
@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicBuildRequestToolUse(t *testing.T) {
+	a := NewAnthropicAdapter("key")
+	messages := []Message{
+		{Role: "user", Content: "what time is it?"},
+		{Role: "assistant", Content: "", ToolCalls: []ToolCall{{
+			ID:       "toolu_1",
+			Type:     "function",
+			Function: FunctionCall{Name: "now"},
+		}}},
+		{Role: "tool", ToolCallID: "toolu_1", Content: "12:00"},
+	}
+	b, err := json.Marshal(a.buildRequest(messages, Config{Model: "claude"}))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var req struct {
+		Messages []struct {
+			Role    string                       `json:"role"`
+			Content []map[string]json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(b, &req); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(req.Messages) != 3 {
+		t.Fatalf("got %d messages, want 3", len(req.Messages))
+	}
+
+	assistant := req.Messages[1].Content
+	if len(assistant) != 1 {
+		t.Fatalf("assistant turn has %d blocks, want only the tool_use block: %s", len(assistant), b)
+	}
+	if input := string(assistant[0]["input"]); input != "{}" {
+		t.Errorf("tool_use input = %s, want {}", input)
+	}
+	for _, msg := range []int{0, 2} {
+		if _, ok := req.Messages[msg].Content[0]["input"]; ok {
+			t.Errorf("message %d carries an input field: %s", msg, b)
+		}
+	}
+	if strings.Contains(string(b), `"text":""`) {
+		t.Errorf("request contains an empty text block: %s", b)
+	}
+}
+
+func TestAnthropicExecute(t *testing.T) {
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		fmt.Fprint(w, `{
+			"content": [
+				{"type": "text", "text": "Let me check"},
+				{"type": "tool_use", "id": "toolu_1", "name": "search", "input": {"q": "go"}}
+			],
+			"stop_reason": "tool_use",
+			"usage": {"input_tokens": 10, "output_tokens": 5}
+		}`)
+	}))
+	defer server.Close()
+
+	a := NewAnthropicAdapter("key")
+	a.SetBaseURL(server.URL)
+	zero := 0.0
+	result, err := a.Execute(context.Background(), []Message{{Role: "user", Content: "hi"}}, Config{Model: "claude", Temperature: &zero})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if result.Content != "Let me check" || result.StopReason != StopReasonToolCalls || result.Usage.TotalTokens != 15 {
+		t.Errorf("result = %+v", result)
+	}
+	if len(result.ToolCalls) != 1 || result.ToolCalls[0].ID != "toolu_1" || result.ToolCalls[0].Function.Arguments["q"] != "go" {
+		t.Errorf("tool calls = %+v", result.ToolCalls)
+	}
+	if temperature, ok := body["temperature"]; !ok || temperature != 0.0 {
+		t.Errorf("temperature = %v, %v; want an explicit 0", temperature, ok)
+	}
+
+	if _, err := a.Execute(context.Background(), nil, Config{Model: "claude"}); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if _, ok := body["temperature"]; ok {
+		t.Error("temperature sent without one configured")
+	}
+}
+
+func TestAnthropicExecuteErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"api error", `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, "status 529 (overloaded_error): Overloaded"},
+		{"plain body", "upstream unavailable", "status 529: upstream unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(529)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			a := NewAnthropicAdapter("key")
+			a.SetBaseURL(server.URL)
+			_, err := a.Execute(context.Background(), nil, Config{Model: "claude"})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -5,24 +5,38 @@ import (
 	"time"
 )
 
-// Executor defines the interface for AI model adapters
+// Executor defines the interface for AI model adapters.
+// Execute receives the full conversation history (system, user, assistant
+// and tool messages) in order.
 type Executor interface {
-	Execute(ctx context.Context, input Message, config Config) (*Result, error)
+	Execute(ctx context.Context, messages []Message, config Config) (*Result, error)
 	Name() string
 }
 
+// DeltaHandler receives incremental text output while a completion streams
+type DeltaHandler func(delta string)
+
+// StreamingExecutor is implemented by executors that can stream token deltas.
+// ExecuteStream calls onDelta for every text fragment as it arrives and
+// returns the aggregated result once the stream completes.
+type StreamingExecutor interface {
+	Executor
+	ExecuteStream(ctx context.Context, messages []Message, config Config, onDelta DeltaHandler) (*Result, error)
+}
+
 // Message represents a single message in the conversation
 type Message struct {
-	Role      string     `json:"role"`
-	Content   string     `json:"content"`
-	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
 }
 
 // ToolCall represents a tool/function call
 type ToolCall struct {
-	ID       string         `json:"id"`
-	Type     string         `json:"type"`
-	Function FunctionCall   `json:"function"`
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
 }
 
 // FunctionCall represents a function call details
@@ -33,12 +47,20 @@ type FunctionCall struct {
 
 // Result represents the execution result from an AI model
 type Result struct {
-	Content   string     `json:"content"`
-	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
-	Usage     TokenUsage `json:"usage"`
-	Latency   time.Duration `json:"latency"`
+	Content    string        `json:"content"`
+	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`
+	StopReason string        `json:"stop_reason,omitempty"`
+	Usage      TokenUsage    `json:"usage"`
+	Latency    time.Duration `json:"latency"`
 }
 
+// Normalized stop reasons reported in Result.StopReason
+const (
+	StopReasonEnd       = "stop"
+	StopReasonMaxTokens = "length"
+	StopReasonToolCalls = "tool_calls"
+)
+
 // TokenUsage represents token consumption
 type TokenUsage struct {
 	PromptTokens     int `json:"prompt_tokens"`
@@ -46,11 +68,12 @@ type TokenUsage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
-// Config represents model configuration
+// Config represents model configuration. Temperature is a pointer so that
+// an explicit 0 is sent rather than the provider default.
 type Config struct {
 	Provider    string         `json:"provider"`
 	Model       string         `json:"model"`
-	Temperature float64        `json:"temperature,omitempty"`
+	Temperature *float64       `json:"temperature,omitempty"`
 	MaxTokens   int            `json:"max_tokens,omitempty"`
 	TopP        float64        `json:"top_p,omitempty"`
 	Tools       []Tool         `json:"tools,omitempty"`
@@ -59,8 +82,8 @@ type Config struct {
 
 // Tool represents a tool/function definition
 type Tool struct {
-	Type     string       `json:"type"`
-	Function FunctionDef  `json:"function"`
+	Type     string      `json:"type"`
+	Function FunctionDef `json:"function"`
 }
 
 // FunctionDef represents a function definition
@@ -0,0 +1,346 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Local API flavours selectable through Config.Extra["api"]
+const (
+	LocalAPIOllama = "ollama"
+	LocalAPIOpenAI = "openai"
+)
+
+// LocalAdapter implements Executor for local models (e.g., Ollama)
+type LocalAdapter struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewLocalAdapter creates a new local model adapter
+func NewLocalAdapter(baseURL string) *LocalAdapter {
+	return &LocalAdapter{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 300 * time.Second},
+	}
+}
+
+// Name returns the adapter name
+func (a *LocalAdapter) Name() string {
+	return "local"
+}
+
+// Execute sends a request to a local model and returns the result.
+// Ollama's native /api/chat is used by default; setting Extra["api"] to
+// "openai" targets an OpenAI-compatible /v1/chat/completions server instead
+// (vLLM, llama.cpp server, LM Studio). Extra["base_url"] overrides the
+// adapter's base URL for a single agent.
+func (a *LocalAdapter) Execute(ctx context.Context, messages []Message, config Config) (*Result, error) {
+	baseURL := a.resolveBaseURL(config)
+
+	switch api := localAPI(config); api {
+	case LocalAPIOllama:
+		return a.executeOllama(ctx, baseURL, messages, config)
+	case LocalAPIOpenAI:
+		return a.openAICompat(baseURL, config).Execute(ctx, messages, config)
+	default:
+		return nil, fmt.Errorf("unsupported local api: %s", api)
+	}
+}
+
+// ExecuteStream streams a completion from the local model. Ollama replies
+// with newline-delimited JSON; OpenAI-compatible servers use SSE.
+func (a *LocalAdapter) ExecuteStream(ctx context.Context, messages []Message, config Config, onDelta DeltaHandler) (*Result, error) {
+	baseURL := a.resolveBaseURL(config)
+
+	switch api := localAPI(config); api {
+	case LocalAPIOllama:
+		return a.streamOllama(ctx, baseURL, messages, config, onDelta)
+	case LocalAPIOpenAI:
+		return a.openAICompat(baseURL, config).ExecuteStream(ctx, messages, config, onDelta)
+	default:
+		return nil, fmt.Errorf("unsupported local api: %s", api)
+	}
+}
+
+func (a *LocalAdapter) openAICompat(baseURL string, config Config) *OpenAIAdapter {
+	return &OpenAIAdapter{
+		apiKey:     extraString(config, "api_key"),
+		httpClient: a.httpClient,
+		baseURL:    baseURL + "/v1",
+	}
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+// ollamaResponse is a /api/chat reply, or a single chunk when streaming
+type ollamaResponse struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+func (a *LocalAdapter) executeOllama(ctx context.Context, baseURL string, messages []Message, config Config) (*Result, error) {
+	startTime := time.Now()
+
+	resp, err := a.sendOllama(ctx, baseURL, buildOllamaRequest(messages, config, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var apiResp ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	result := &Result{Content: apiResp.Message.Content}
+	finishOllamaResult(result, apiResp, apiResp.Message.ToolCalls)
+	result.Latency = time.Since(startTime)
+	return result, nil
+}
+
+func (a *LocalAdapter) streamOllama(ctx context.Context, baseURL string, messages []Message, config Config, onDelta DeltaHandler) (*Result, error) {
+	startTime := time.Now()
+
+	resp, err := a.sendOllama(ctx, baseURL, buildOllamaRequest(messages, config, true))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var content strings.Builder
+	var toolCalls []ollamaToolCall
+	var last ollamaResponse
+	var streamErr error
+
+	err = readNDJSON(resp.Body, func(line []byte) bool {
+		var chunk ollamaResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			streamErr = fmt.Errorf("decode stream chunk: %w", err)
+			return false
+		}
+		if chunk.Error != "" {
+			streamErr = fmt.Errorf("ollama stream error: %s", chunk.Error)
+			return false
+		}
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			if onDelta != nil {
+				onDelta(chunk.Message.Content)
+			}
+		}
+		toolCalls = append(toolCalls, chunk.Message.ToolCalls...)
+		last = chunk
+		return !chunk.Done
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read stream: %w", err)
+	}
+	if streamErr != nil {
+		return nil, streamErr
+	}
+
+	result := &Result{Content: content.String()}
+	finishOllamaResult(result, last, toolCalls)
+	result.Latency = time.Since(startTime)
+	return result, nil
+}
+
+func buildOllamaRequest(messages []Message, config Config, stream bool) map[string]any {
+	chatMessages := make([]ollamaMessage, 0, len(messages))
+	for _, msg := range messages {
+		m := ollamaMessage{Role: msg.Role, Content: msg.Content}
+		for _, tc := range msg.ToolCalls {
+			var call ollamaToolCall
+			call.Function.Name = tc.Function.Name
+			call.Function.Arguments = tc.Function.Arguments
+			m.ToolCalls = append(m.ToolCalls, call)
+		}
+		chatMessages = append(chatMessages, m)
+	}
+
+	options := map[string]any{}
+	if config.Temperature != nil {
+		options["temperature"] = *config.Temperature
+	}
+	if config.TopP > 0 {
+		options["top_p"] = config.TopP
+	}
+	if config.MaxTokens > 0 {
+		options["num_predict"] = config.MaxTokens
+	}
+
+	reqBody := map[string]any{
+		"model":    config.Model,
+		"messages": chatMessages,
+		"stream":   stream,
+	}
+	if len(options) > 0 {
+		reqBody["options"] = options
+	}
+	if len(config.Tools) > 0 {
+		reqBody["tools"] = config.Tools
+	}
+	return reqBody
+}
+
+func (a *LocalAdapter) sendOllama(ctx context.Context, baseURL string, reqBody map[string]any) (*http.Response, error) {
+	b, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/api/chat", bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ollama api error: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("ollama api returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	return resp, nil
+}
+
+// finishOllamaResult fills usage, tool calls and stop reason from the final reply
+func finishOllamaResult(result *Result, final ollamaResponse, toolCalls []ollamaToolCall) {
+	result.Usage = TokenUsage{
+		PromptTokens:     final.PromptEvalCount,
+		CompletionTokens: final.EvalCount,
+		TotalTokens:      final.PromptEvalCount + final.EvalCount,
+	}
+
+	// Ollama does not assign IDs to tool calls. Generated ones must stay
+	// unique across turns, since the conversation history keeps them all.
+	for _, tc := range toolCalls {
+		args := tc.Function.Arguments
+		if args == nil {
+			args = make(map[string]any)
+		}
+		result.ToolCalls = append(result.ToolCalls, ToolCall{
+			ID:   "call_" + uuid.NewString(),
+			Type: "function",
+			Function: FunctionCall{
+				Name:      tc.Function.Name,
+				Arguments: args,
+			},
+		})
+	}
+
+	switch {
+	case len(result.ToolCalls) > 0:
+		result.StopReason = StopReasonToolCalls
+	case final.DoneReason == "length":
+		result.StopReason = StopReasonMaxTokens
+	default:
+		result.StopReason = StopReasonEnd
+	}
+}
+
+// ListModels returns the models served by the local endpoint
+func (a *LocalAdapter) ListModels(ctx context.Context, api string) ([]string, error) {
+	if api == "" {
+		api = LocalAPIOllama
+	}
+
+	var path string
+	switch api {
+	case LocalAPIOllama:
+		path = "/api/tags"
+	case LocalAPIOpenAI:
+		path = "/v1/models"
+	default:
+		return nil, fmt.Errorf("unsupported local api: %s", api)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", a.baseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("local model endpoint unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("local model endpoint returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var listResp struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&listResp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+
+	models := make([]string, 0, len(listResp.Models)+len(listResp.Data))
+	for _, m := range listResp.Models {
+		models = append(models, m.Name)
+	}
+	for _, m := range listResp.Data {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+func (a *LocalAdapter) resolveBaseURL(config Config) string {
+	if baseURL := extraString(config, "base_url"); baseURL != "" {
+		return strings.TrimRight(baseURL, "/")
+	}
+	return a.baseURL
+}
+
+func localAPI(config Config) string {
+	if api := extraString(config, "api"); api != "" {
+		return api
+	}
+	return LocalAPIOllama
+}
+
+// extraString reads a string value from Config.Extra
+func extraString(config Config, key string) string {
+	if config.Extra == nil {
+		return ""
+	}
+	v, _ := config.Extra[key].(string)
+	return v
+}
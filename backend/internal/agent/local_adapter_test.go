@@ -0,0 +1,26 @@
+package agent
+
+import "testing"
+
+func TestFinishOllamaResultToolCallIDs(t *testing.T) {
+	var call ollamaToolCall
+	call.Function.Name = "search"
+
+	seen := make(map[string]bool)
+	for turn := 0; turn < 3; turn++ {
+		result := &Result{}
+		finishOllamaResult(result, ollamaResponse{}, []ollamaToolCall{call, call})
+		if result.StopReason != StopReasonToolCalls {
+			t.Fatalf("stop reason = %q, want %q", result.StopReason, StopReasonToolCalls)
+		}
+		for _, tc := range result.ToolCalls {
+			if seen[tc.ID] {
+				t.Fatalf("tool call ID %s reused across turns", tc.ID)
+			}
+			seen[tc.ID] = true
+			if tc.Function.Arguments == nil {
+				t.Errorf("tool call %s has nil arguments", tc.ID)
+			}
+		}
+	}
+}
@@ -7,7 +7,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // OpenAIAdapter implements Executor for OpenAI models
@@ -32,60 +35,30 @@ func (a *OpenAIAdapter) Name() string {
 }
 
 // Execute sends a request to OpenAI and returns the result
-func (a *OpenAIAdapter) Execute(ctx context.Context, input Message, config Config) (*Result, error) {
+func (a *OpenAIAdapter) Execute(ctx context.Context, messages []Message, config Config) (*Result, error) {
 	startTime := time.Now()
 
-	// Build messages for the OpenAI REST API
-	type chatMessage struct {
-		Role    string `json:"role"`
-		Content string `json:"content"`
-	}
-
-	messages := []chatMessage{{Role: "user", Content: input.Content}}
-
-	// Build request body
-	reqBody := map[string]any{
-		"model":       config.Model,
-		"messages":    messages,
-		"temperature": config.Temperature,
-		"max_tokens":  config.MaxTokens,
-		"top_p":       config.TopP,
-	}
+	reqBody := a.buildRequest(messages, config)
 
-	b, err := json.Marshal(reqBody)
+	resp, err := a.send(ctx, reqBody)
 	if err != nil {
-		return nil, fmt.Errorf("marshal request: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", a.baseURL+"/chat/completions", bytes.NewReader(b))
-	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+a.apiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := a.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("openai api error: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("openai api returned status %d: %s", resp.StatusCode, string(bodyBytes))
-	}
-
 	// Response structures
 	var apiResp struct {
 		Choices []struct {
 			Message struct {
-				Role         string `json:"role"`
-				Content      string `json:"content"`
+				Role         string           `json:"role"`
+				Content      string           `json:"content"`
+				ToolCalls    []openAIToolCall `json:"tool_calls,omitempty"`
 				FunctionCall *struct {
 					Name      string `json:"name"`
 					Arguments string `json:"arguments"`
 				} `json:"function_call,omitempty"`
 			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
 		} `json:"choices"`
 		Usage struct {
 			PromptTokens     int `json:"prompt_tokens"`
@@ -106,7 +79,8 @@ func (a *OpenAIAdapter) Execute(ctx context.Context, input Message, config Confi
 	latency := time.Since(startTime)
 
 	result := &Result{
-		Content: choice.Message.Content,
+		Content:    choice.Message.Content,
+		StopReason: openAIStopReason(choice.FinishReason),
 		Usage: TokenUsage{
 			PromptTokens:     apiResp.Usage.PromptTokens,
 			CompletionTokens: apiResp.Usage.CompletionTokens,
@@ -116,81 +90,294 @@ func (a *OpenAIAdapter) Execute(ctx context.Context, input Message, config Confi
 	}
 
 	// Handle tool calls if present
-	// Handle function_call if present
-	if choice.Message.FunctionCall != nil {
-		var args map[string]any
-		if err := json.Unmarshal([]byte(choice.Message.FunctionCall.Arguments), &args); err != nil {
-			args = make(map[string]any)
-		}
+	for _, tc := range choice.Message.ToolCalls {
+		result.ToolCalls = append(result.ToolCalls, ToolCall{
+			ID:   toolCallID(tc.ID),
+			Type: "function",
+			Function: FunctionCall{
+				Name:      tc.Function.Name,
+				Arguments: parseArguments(tc.Function.Arguments),
+			},
+		})
+	}
+
+	// Fall back to the deprecated function_call field for older servers. It
+	// has no ID, but the tool result sent back needs one.
+	if len(result.ToolCalls) == 0 && choice.Message.FunctionCall != nil {
 		result.ToolCalls = []ToolCall{{
-			ID:   "",
-			Type: "function_call",
+			ID:   toolCallID(""),
+			Type: "function",
 			Function: FunctionCall{
 				Name:      choice.Message.FunctionCall.Name,
-				Arguments: args,
+				Arguments: parseArguments(choice.Message.FunctionCall.Arguments),
 			},
 		}}
+		result.StopReason = StopReasonToolCalls
 	}
 
 	return result, nil
 }
 
-// AnthropicAdapter implements Executor for Anthropic models
-type AnthropicAdapter struct {
-	apiKey     string
-	httpClient *http.Client
-	baseURL    string
+// ExecuteStream sends a streaming request to OpenAI, forwarding content
+// deltas to onDelta and accumulating tool call fragments by index
+func (a *OpenAIAdapter) ExecuteStream(ctx context.Context, messages []Message, config Config, onDelta DeltaHandler) (*Result, error) {
+	startTime := time.Now()
+
+	reqBody := a.buildRequest(messages, config)
+	reqBody["stream"] = true
+	reqBody["stream_options"] = map[string]any{"include_usage": true}
+
+	resp, err := a.send(ctx, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	type toolCallChunk struct {
+		Index    int    `json:"index"`
+		ID       string `json:"id"`
+		Function struct {
+			Name      string `json:"name"`
+			Arguments string `json:"arguments"`
+		} `json:"function"`
+	}
+	var chunk struct {
+		Choices []struct {
+			Delta struct {
+				Content   string          `json:"content"`
+				ToolCalls []toolCallChunk `json:"tool_calls"`
+			} `json:"delta"`
+			FinishReason *string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+			TotalTokens      int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+
+	result := &Result{}
+	var content strings.Builder
+	var calls []*openAIToolCall
+	var decodeErr error
+
+	err = readSSE(resp.Body, func(ev sseEvent) bool {
+		if ev.Data == "[DONE]" {
+			return false
+		}
+		chunk.Choices = nil
+		chunk.Usage = nil
+		if err := json.Unmarshal([]byte(ev.Data), &chunk); err != nil {
+			decodeErr = fmt.Errorf("decode stream chunk: %w", err)
+			return false
+		}
+		if chunk.Usage != nil {
+			result.Usage = TokenUsage{
+				PromptTokens:     chunk.Usage.PromptTokens,
+				CompletionTokens: chunk.Usage.CompletionTokens,
+				TotalTokens:      chunk.Usage.TotalTokens,
+			}
+		}
+		if len(chunk.Choices) == 0 {
+			return true
+		}
+		choice := chunk.Choices[0]
+		if choice.Delta.Content != "" {
+			content.WriteString(choice.Delta.Content)
+			if onDelta != nil {
+				onDelta(choice.Delta.Content)
+			}
+		}
+		for _, tc := range choice.Delta.ToolCalls {
+			for len(calls) <= tc.Index {
+				calls = append(calls, &openAIToolCall{})
+			}
+			call := calls[tc.Index]
+			if tc.ID != "" {
+				call.ID = tc.ID
+			}
+			call.Function.Name += tc.Function.Name
+			call.Function.Arguments += tc.Function.Arguments
+		}
+		if choice.FinishReason != nil {
+			result.StopReason = openAIStopReason(*choice.FinishReason)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read stream: %w", err)
+	}
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	result.Content = content.String()
+	for _, call := range calls {
+		result.ToolCalls = append(result.ToolCalls, ToolCall{
+			ID:   toolCallID(call.ID),
+			Type: "function",
+			Function: FunctionCall{
+				Name:      call.Function.Name,
+				Arguments: parseArguments(call.Function.Arguments),
+			},
+		})
+	}
+	result.Latency = time.Since(startTime)
+
+	return result, nil
 }
 
-// NewAnthropicAdapter creates a new Anthropic adapter
-func NewAnthropicAdapter(apiKey string) *AnthropicAdapter {
-	return &AnthropicAdapter{
-		apiKey:     apiKey,
-		httpClient: &http.Client{Timeout: 120 * time.Second},
-		baseURL:    "https://api.anthropic.com/v1",
+// send posts a Chat Completions request and checks the response status
+func (a *OpenAIAdapter) send(ctx context.Context, reqBody map[string]any) (*http.Response, error) {
+	b, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.baseURL+"/chat/completions", bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if a.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+a.apiKey)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("openai api error: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("openai api returned status %d: %s", resp.StatusCode, string(bodyBytes))
 	}
+
+	return resp, nil
 }
 
-// Name returns the adapter name
-func (a *AnthropicAdapter) Name() string {
-	return "anthropic"
+// openAIToolCall is the wire format of a tool call in the Chat Completions API
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
 }
 
-// Execute sends a request to Anthropic and returns the result
-func (a *AnthropicAdapter) Execute(ctx context.Context, input Message, config Config) (*Result, error) {
-	// TODO: Implement Anthropic API call
-	return &Result{
-		Content: "Anthropic adapter not yet implemented",
-		Usage:   TokenUsage{},
-		Latency: 0,
-	}, nil
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    *string          `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
 }
 
-// LocalAdapter implements Executor for local models (e.g., Ollama)
-type LocalAdapter struct {
-	baseURL    string
-	httpClient *http.Client
+// buildRequest converts the conversation into a Chat Completions request body
+func (a *OpenAIAdapter) buildRequest(messages []Message, config Config) map[string]any {
+	chatMessages := make([]openAIMessage, 0, len(messages))
+	for _, msg := range messages {
+		content := msg.Content
+		m := openAIMessage{
+			Role:       msg.Role,
+			Content:    &content,
+			ToolCallID: msg.ToolCallID,
+		}
+		for _, tc := range msg.ToolCalls {
+			var call openAIToolCall
+			call.ID = tc.ID
+			call.Type = "function"
+			call.Function.Name = tc.Function.Name
+			args, _ := json.Marshal(tc.Function.Arguments)
+			call.Function.Arguments = string(args)
+			m.ToolCalls = append(m.ToolCalls, call)
+		}
+		// Assistant turns that only carry tool calls must send a null content
+		if msg.Role == "assistant" && msg.Content == "" && len(m.ToolCalls) > 0 {
+			m.Content = nil
+		}
+		chatMessages = append(chatMessages, m)
+	}
+
+	reqBody := map[string]any{
+		"model":    config.Model,
+		"messages": chatMessages,
+	}
+	if config.Temperature != nil {
+		reqBody["temperature"] = *config.Temperature
+	}
+	if config.MaxTokens > 0 {
+		reqBody["max_tokens"] = config.MaxTokens
+	}
+	if config.TopP > 0 {
+		reqBody["top_p"] = config.TopP
+	}
+
+	if len(config.Tools) > 0 {
+		tools := make([]Tool, 0, len(config.Tools))
+		for _, t := range config.Tools {
+			if t.Type == "" {
+				t.Type = "function"
+			}
+			tools = append(tools, t)
+		}
+		reqBody["tools"] = tools
+		if choice, ok := config.Extra["tool_choice"]; ok {
+			reqBody["tool_choice"] = openAIToolChoice(choice)
+		}
+		if parallel, ok := config.Extra["parallel_tool_calls"].(bool); ok {
+			reqBody["parallel_tool_calls"] = parallel
+		}
+	}
+
+	return reqBody
+}
+
+// openAIToolChoice accepts "auto", "none", "required" or a bare function name
+func openAIToolChoice(choice any) any {
+	name, ok := choice.(string)
+	if !ok {
+		return choice
+	}
+	switch name {
+	case "auto", "none", "required":
+		return name
+	}
+	return map[string]any{
+		"type":     "function",
+		"function": map[string]any{"name": name},
+	}
 }
 
-// NewLocalAdapter creates a new local model adapter
-func NewLocalAdapter(baseURL string) *LocalAdapter {
-	return &LocalAdapter{
-		baseURL:    baseURL,
-		httpClient: &http.Client{Timeout: 300 * time.Second},
+// openAIStopReason maps OpenAI finish reasons onto the normalized values
+func openAIStopReason(reason string) string {
+	switch reason {
+	case "stop":
+		return StopReasonEnd
+	case "length":
+		return StopReasonMaxTokens
+	case "tool_calls", "function_call":
+		return StopReasonToolCalls
+	default:
+		return reason
 	}
 }
 
-// Name returns the adapter name
-func (a *LocalAdapter) Name() string {
-	return "local"
+// toolCallID returns id, or a generated one for servers that leave it out,
+// since tool results are matched to their calls by ID
+func toolCallID(id string) string {
+	if id != "" {
+		return id
+	}
+	return "call_" + uuid.NewString()
 }
 
-// Execute sends a request to a local model and returns the result
-func (a *LocalAdapter) Execute(ctx context.Context, input Message, config Config) (*Result, error) {
-	// TODO: Implement local model API call (Ollama, vLLM, etc.)
-	return &Result{
-		Content: "Local adapter not yet implemented",
-		Usage:   TokenUsage{},
-		Latency: 0,
-	}, nil
+// parseArguments decodes JSON-encoded tool arguments, tolerating bad input
+func parseArguments(raw string) map[string]any {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(raw), &args); err != nil || args == nil {
+		args = make(map[string]any)
+	}
+	return args
 }
@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// openAIServer answers every request with status and response and records
+// the last request body
+func openAIServer(t *testing.T, status int, response string) (*OpenAIAdapter, *map[string]any) {
+	t.Helper()
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, response)
+	}))
+	t.Cleanup(server.Close)
+
+	a := NewOpenAIAdapter("key")
+	a.baseURL = server.URL
+	return a, &body
+}
+
+func TestOpenAIExecute(t *testing.T) {
+	a, body := openAIServer(t, http.StatusOK, `{
+		"choices": [{"message": {"role": "assistant", "content": "Hello"}, "finish_reason": "stop"}],
+		"usage": {"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5}
+	}`)
+	zero := 0.0
+	result, err := a.Execute(context.Background(), []Message{{Role: "user", Content: "hi"}}, Config{Model: "gpt", Temperature: &zero})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if result.Content != "Hello" || result.StopReason != StopReasonEnd || result.Usage.TotalTokens != 5 {
+		t.Errorf("result = %+v", result)
+	}
+	if temperature, ok := (*body)["temperature"]; !ok || temperature != 0.0 {
+		t.Errorf("temperature = %v, %v; want an explicit 0", temperature, ok)
+	}
+
+	if _, err := a.Execute(context.Background(), nil, Config{Model: "gpt"}); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if _, ok := (*body)["temperature"]; ok {
+		t.Error("temperature sent without one configured")
+	}
+}
+
+func TestOpenAIExecuteErrorStatus(t *testing.T) {
+	a, _ := openAIServer(t, http.StatusTooManyRequests, `{"error":{"message":"rate limited"}}`)
+	_, err := a.Execute(context.Background(), nil, Config{Model: "gpt"})
+	if err == nil || !strings.Contains(err.Error(), "status 429") || !strings.Contains(err.Error(), "rate limited") {
+		t.Errorf("err = %v, want the status and error body", err)
+	}
+
+	a, _ = openAIServer(t, http.StatusOK, `{"choices": []}`)
+	if _, err := a.Execute(context.Background(), nil, Config{Model: "gpt"}); err == nil {
+		t.Error("a response without choices succeeded")
+	}
+}
+
+func TestOpenAIExecuteToolCalls(t *testing.T) {
+	a, body := openAIServer(t, http.StatusOK, `{
+		"choices": [{
+			"message": {"role": "assistant", "content": "", "tool_calls": [
+				{"id": "call_a", "type": "function", "function": {"name": "search", "arguments": "{\"q\":\"go\"}"}},
+				{"type": "function", "function": {"name": "now", "arguments": ""}}
+			]},
+			"finish_reason": "tool_calls"
+		}],
+		"usage": {"prompt_tokens": 7, "completion_tokens": 4, "total_tokens": 11}
+	}`)
+	config := Config{
+		Model: "gpt",
+		Tools: []Tool{{Function: FunctionDef{Name: "search"}}, {Function: FunctionDef{Name: "now"}}},
+		Extra: map[string]any{"tool_choice": "search"},
+	}
+	result, err := a.Execute(context.Background(), []Message{{Role: "user", Content: "hi"}}, config)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	tools, _ := (*body)["tools"].([]any)
+	if len(tools) != 2 || tools[0].(map[string]any)["type"] != "function" {
+		t.Errorf("tools = %v, want both tools typed as functions", (*body)["tools"])
+	}
+	choice, _ := (*body)["tool_choice"].(map[string]any)
+	if choice["type"] != "function" || choice["function"].(map[string]any)["name"] != "search" {
+		t.Errorf("tool_choice = %v, want the search function", (*body)["tool_choice"])
+	}
+
+	if result.StopReason != StopReasonToolCalls || result.Usage.TotalTokens != 11 {
+		t.Errorf("result = %+v", result)
+	}
+	if len(result.ToolCalls) != 2 {
+		t.Fatalf("got %d tool calls, want 2", len(result.ToolCalls))
+	}
+	if call := result.ToolCalls[0]; call.ID != "call_a" || call.Type != "function" || call.Function.Arguments["q"] != "go" {
+		t.Errorf("first tool call = %+v", call)
+	}
+	if call := result.ToolCalls[1]; !strings.HasPrefix(call.ID, "call_") || call.Function.Name != "now" {
+		t.Errorf("second tool call = %+v, want a generated ID", call)
+	}
+}
+
+func TestOpenAIExecuteFunctionCall(t *testing.T) {
+	a, _ := openAIServer(t, http.StatusOK, `{
+		"choices": [{
+			"message": {"role": "assistant", "content": null, "function_call": {"name": "search", "arguments": "{\"q\":\"go\"}"}},
+			"finish_reason": "function_call"
+		}]
+	}`)
+	result, err := a.Execute(context.Background(), []Message{{Role: "user", Content: "hi"}}, Config{Model: "gpt"})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if len(result.ToolCalls) != 1 {
+		t.Fatalf("got %d tool calls, want 1", len(result.ToolCalls))
+	}
+	call := result.ToolCalls[0]
+	if !strings.HasPrefix(call.ID, "call_") || call.Type != "function" || call.Function.Arguments["q"] != "go" {
+		t.Errorf("tool call = %+v", call)
+	}
+	if result.StopReason != StopReasonToolCalls {
+		t.Errorf("stop reason = %q", result.StopReason)
+	}
+}
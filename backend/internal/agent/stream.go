@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// sseEvent is a single server-sent event
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// readSSE parses a text/event-stream body and invokes fn for every event.
+// Returning false from fn stops reading.
+func readSSE(r io.Reader, fn func(sseEvent) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	var event sseEvent
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 || event.Event != "" {
+				event.Data = strings.Join(data, "\n")
+				if !fn(event) {
+					return nil
+				}
+			}
+			event = sseEvent{}
+			data = data[:0]
+		case strings.HasPrefix(line, ":"):
+			// Comment / keep-alive
+		case strings.HasPrefix(line, "event:"):
+			event.Event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		event.Data = strings.Join(data, "\n")
+		fn(event)
+	}
+	return nil
+}
+
+// readNDJSON invokes fn for every non-empty line of a newline-delimited JSON body.
+// Returning false from fn stops reading.
+func readNDJSON(r io.Reader, fn func(line []byte) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		if !fn(line) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,249 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadSSE(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []sseEvent
+	}{
+		{
+			name: "single event",
+			body: "event: ping\ndata: {}\n\n",
+			want: []sseEvent{{Event: "ping", Data: "{}"}},
+		},
+		{
+			name: "multi-line data",
+			body: "data: a\ndata: b\n\n",
+			want: []sseEvent{{Data: "a\nb"}},
+		},
+		{
+			name: "comments and blank lines",
+			body: ": keep-alive\n\n\ndata: x\n\n",
+			want: []sseEvent{{Data: "x"}},
+		},
+		{
+			name: "no space after colon",
+			body: "data:x\n\n",
+			want: []sseEvent{{Data: "x"}},
+		},
+		{
+			name: "trailing event without blank line",
+			body: "data: one\n\ndata: two",
+			want: []sseEvent{{Data: "one"}, {Data: "two"}},
+		},
+		{
+			name: "event without data",
+			body: "event: done\n\n",
+			want: []sseEvent{{Event: "done"}},
+		},
+		{
+			name: "empty body",
+			body: "",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []sseEvent
+			err := readSSE(strings.NewReader(tt.body), func(ev sseEvent) bool {
+				got = append(got, ev)
+				return true
+			})
+			if err != nil {
+				t.Fatalf("readSSE: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSSEStops(t *testing.T) {
+	var got []string
+	err := readSSE(strings.NewReader("data: 1\n\ndata: 2\n\ndata: 3\n\n"), func(ev sseEvent) bool {
+		got = append(got, ev.Data)
+		return ev.Data != "2"
+	})
+	if err != nil {
+		t.Fatalf("readSSE: %v", err)
+	}
+	if want := []string{"1", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestReadNDJSON(t *testing.T) {
+	body := "{\"a\":1}\n\n   \n{\"b\":2}\r\n{\"c\":3}"
+	var got []string
+	err := readNDJSON(strings.NewReader(body), func(line []byte) bool {
+		got = append(got, strings.TrimSpace(string(line)))
+		return true
+	})
+	if err != nil {
+		t.Fatalf("readNDJSON: %v", err)
+	}
+	if want := []string{`{"a":1}`, `{"b":2}`, `{"c":3}`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	got = nil
+	err = readNDJSON(strings.NewReader("1\n2\n3\n"), func(line []byte) bool {
+		got = append(got, string(line))
+		return len(got) < 2
+	})
+	if err != nil {
+		t.Fatalf("readNDJSON: %v", err)
+	}
+	if want := []string{"1", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("stopped read got %v, want %v", got, want)
+	}
+}
+
+func TestReadLongLines(t *testing.T) {
+	long := strings.Repeat("x", 1<<20)
+	var got string
+	if err := readSSE(strings.NewReader("data: "+long+"\n\n"), func(ev sseEvent) bool {
+		got = ev.Data
+		return true
+	}); err != nil {
+		t.Fatalf("readSSE: %v", err)
+	}
+	if got != long {
+		t.Errorf("readSSE truncated a %d byte event to %d bytes", len(long), len(got))
+	}
+}
+
+func TestAnthropicExecuteStream(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"usage":{"input_tokens":10}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"search","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"q\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"go\"}"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":5}}`,
+		`{"type":"message_stop"}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, ev := range events {
+			fmt.Fprintf(w, "event: x\ndata: %s\n\n", ev)
+		}
+	}))
+	defer server.Close()
+
+	a := NewAnthropicAdapter("key")
+	a.SetBaseURL(server.URL)
+	var deltas []string
+	result, err := a.ExecuteStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, Config{Model: "claude"}, func(d string) {
+		deltas = append(deltas, d)
+	})
+	if err != nil {
+		t.Fatalf("ExecuteStream: %v", err)
+	}
+	if result.Content != "Hello" || !reflect.DeepEqual(deltas, []string{"Hel", "lo"}) {
+		t.Errorf("content %q from deltas %v", result.Content, deltas)
+	}
+	if result.StopReason != StopReasonToolCalls {
+		t.Errorf("stop reason = %q", result.StopReason)
+	}
+	if result.Usage.TotalTokens != 15 {
+		t.Errorf("total tokens = %d, want 15", result.Usage.TotalTokens)
+	}
+	if len(result.ToolCalls) != 1 || result.ToolCalls[0].Function.Arguments["q"] != "go" {
+		t.Errorf("tool calls = %+v", result.ToolCalls)
+	}
+}
+
+func TestOllamaStream(t *testing.T) {
+	chunks := []string{
+		`{"message":{"role":"assistant","content":"Hi"},"done":false}`,
+		`{"message":{"role":"assistant","content":" there"},"done":false}`,
+		`{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":3,"eval_count":2}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, chunk := range chunks {
+			fmt.Fprintln(w, chunk)
+		}
+	}))
+	defer server.Close()
+
+	a := NewLocalAdapter(server.URL)
+	var deltas []string
+	result, err := a.streamOllama(context.Background(), server.URL, []Message{{Role: "user", Content: "hi"}}, Config{Model: "llama"}, func(d string) {
+		deltas = append(deltas, d)
+	})
+	if err != nil {
+		t.Fatalf("streamOllama: %v", err)
+	}
+	if result.Content != "Hi there" || len(deltas) != 2 {
+		t.Errorf("content %q from deltas %v", result.Content, deltas)
+	}
+	if result.StopReason != StopReasonEnd || result.Usage.TotalTokens != 5 {
+		t.Errorf("stop reason %q, usage %+v", result.StopReason, result.Usage)
+	}
+}
+
+func TestOllamaStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"error":"model not found"}`)
+	}))
+	defer server.Close()
+
+	a := NewLocalAdapter(server.URL)
+	_, err := a.streamOllama(context.Background(), server.URL, nil, Config{Model: "missing"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "model not found") {
+		t.Errorf("err = %v, want stream error", err)
+	}
+}
+
+func TestOpenAIExecuteStream(t *testing.T) {
+	chunks := []string{
+		`{"choices":[{"delta":{"content":"Let me "}}]}`,
+		`{"choices":[{"delta":{"content":"check"}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_a","function":{"name":"search","arguments":"{\"q\""}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":":\"go\"}"}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":1,"id":"call_b","function":{"name":"now","arguments":""}}]}}]}`,
+		`{"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":7,"completion_tokens":4,"total_tokens":11}}`,
+		`[DONE]`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+	}))
+	defer server.Close()
+
+	a := NewOpenAIAdapter("key")
+	a.baseURL = server.URL
+	result, err := a.ExecuteStream(context.Background(), []Message{{Role: "user", Content: "hi"}}, Config{Model: "gpt"}, nil)
+	if err != nil {
+		t.Fatalf("ExecuteStream: %v", err)
+	}
+	if result.Content != "Let me check" || result.StopReason != StopReasonToolCalls || result.Usage.TotalTokens != 11 {
+		t.Errorf("result = %+v", result)
+	}
+	if len(result.ToolCalls) != 2 {
+		t.Fatalf("got %d tool calls, want 2", len(result.ToolCalls))
+	}
+	if call := result.ToolCalls[0]; call.ID != "call_a" || call.Function.Name != "search" || call.Function.Arguments["q"] != "go" {
+		t.Errorf("first tool call = %+v", call)
+	}
+	if call := result.ToolCalls[1]; call.ID != "call_b" || call.Function.Arguments == nil {
+		t.Errorf("second tool call = %+v", call)
+	}
+}
@@ -3,18 +3,31 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/Wangren-Academy/Agent/backend/internal/store"
+	"github.com/Wangren-Academy/Agent/backend/internal/websocket"
+	"github.com/Wangren-Academy/Agent/backend/internal/workflow"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+var (
+	errNotRunning        = errors.New("execution is not running")
+	errReplayUnavailable = errors.New("replay is not available")
+)
+
 // ExecutionHandler handles execution-related requests
 type ExecutionHandler struct {
-	db *store.PostgresStore
+	db        *store.PostgresStore
+	runs      *workflow.Runs
+	workflows *WorkflowHandler
 }
 
 // NewExecutionHandler creates a new execution handler
@@ -22,6 +35,17 @@ func NewExecutionHandler(db *store.PostgresStore) *ExecutionHandler {
 	return &ExecutionHandler{db: db}
 }
 
+// SetRuns sets the registry of running executions that control requests
+// are delivered to
+func (h *ExecutionHandler) SetRuns(runs *workflow.Runs) {
+	h.runs = runs
+}
+
+// SetWorkflows sets the workflow handler replays are started through
+func (h *ExecutionHandler) SetWorkflows(workflows *WorkflowHandler) {
+	h.workflows = workflows
+}
+
 // List returns all executions
 func (h *ExecutionHandler) List(c *gin.Context) {
 	workflowID := c.Query("workflow_id")
@@ -102,16 +126,23 @@ func (h *ExecutionHandler) Get(c *gin.Context) {
 		workflowID   uuid.UUID
 		status       string
 		snapshotJSON []byte
+		inputJSON    []byte
+		parentID     *uuid.UUID
+		parentNodeID *string
+		version      *int
+		replayOf     *uuid.UUID
 		startedAt    time.Time
 		finishedAt   *time.Time
 		createdAt    time.Time
 	)
 
 	err = h.db.Pool().QueryRow(context.Background(), `
-		SELECT workflow_id, status, snapshot, started_at, finished_at, created_at
+		SELECT workflow_id, status, snapshot, input_data, parent_execution_id, parent_node_id,
+		       workflow_version, replay_of, started_at, finished_at, created_at
 		FROM executions
 		WHERE id = $1
-	`, id).Scan(&workflowID, &status, &snapshotJSON, &startedAt, &finishedAt, &createdAt)
+	`, id).Scan(&workflowID, &status, &snapshotJSON, &inputJSON, &parentID, &parentNodeID,
+		&version, &replayOf, &startedAt, &finishedAt, &createdAt)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "execution not found"})
@@ -120,82 +151,538 @@ func (h *ExecutionHandler) Get(c *gin.Context) {
 
 	var snapshot store.Snapshot
 	json.Unmarshal(snapshotJSON, &snapshot)
+	var inputData map[string]any
+	json.Unmarshal(inputJSON, &inputData)
+
+	// Child executions started by sub-workflow nodes, for drill-down
+	rows, err := h.db.Pool().Query(context.Background(), `
+		SELECT id, workflow_id, parent_node_id, status
+		FROM executions
+		WHERE parent_execution_id = $1
+		ORDER BY created_at
+	`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	children := []map[string]any{}
+	for rows.Next() {
+		var (
+			childID     uuid.UUID
+			childWfID   uuid.UUID
+			childNodeID *string
+			childStatus string
+		)
+		if err := rows.Scan(&childID, &childWfID, &childNodeID, &childStatus); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		children = append(children, map[string]any{
+			"id":          childID,
+			"workflow_id": childWfID,
+			"node_id":     childNodeID,
+			"status":      childStatus,
+		})
+	}
+
+	approvals, err := h.approvals(context.Background(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, map[string]any{
-		"id":          id,
-		"workflow_id": workflowID,
-		"status":      status,
-		"snapshot":    snapshot,
-		"started_at":  startedAt,
-		"finished_at": finishedAt,
-		"created_at":  createdAt,
+		"id":                  id,
+		"workflow_id":         workflowID,
+		"status":              status,
+		"snapshot":            snapshot,
+		"input_data":          inputData,
+		"parent_execution_id": parentID,
+		"parent_node_id":      parentNodeID,
+		"workflow_version":    version,
+		"replay_of":           replayOf,
+		"children":            children,
+		"approvals":           approvals,
+		"started_at":          startedAt,
+		"finished_at":         finishedAt,
+		"created_at":          createdAt,
 	})
 }
 
-// Replay handles sandbox replay requests
-func (h *ExecutionHandler) Replay(c *gin.Context) {
-	id, err := uuid.Parse(c.Param("id"))
+// Diff compares two executions of the same workflow node by node: which
+// nodes a replay froze or ran again, how their outputs changed, the token,
+// latency and cost deltas, and where conditional paths diverged
+func (h *ExecutionHandler) Diff(c *gin.Context) {
+	idA, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid execution id"})
+		return
+	}
+	idB, err := uuid.Parse(c.Param("other_id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid execution id"})
 		return
 	}
 
-	var req struct {
-		ModifiedSteps []struct {
-			StepID    string `json:"step_id"`
-			NewOutput string `json:"new_output"`
-		} `json:"modified_steps"`
+	ctx := c.Request.Context()
+	summaryA, snapshotA, err := h.loadSnapshot(ctx, idA)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	summaryB, snapshotB, err := h.loadSnapshot(ctx, idB)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if summaryA["workflow_id"] != summaryB["workflow_id"] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "executions belong to different workflows"})
+		return
 	}
-	c.ShouldBindJSON(&req)
 
-	// Get original execution
-	var snapshotJSON []byte
-	err = h.db.Pool().QueryRow(context.Background(), `
-		SELECT snapshot FROM executions WHERE id = $1
-	`, id).Scan(&snapshotJSON)
+	diff := workflow.DiffSnapshots(snapshotA, snapshotB)
+	c.JSON(http.StatusOK, gin.H{
+		"execution_a":  summaryA,
+		"execution_b":  summaryB,
+		"nodes":        diff.Nodes,
+		"path":         diff.Path,
+		"total_a":      diff.TotalA,
+		"total_b":      diff.TotalB,
+		"delta":        diff.Delta,
+		"carried_over": diff.CarriedOver,
+	})
+}
+
+// loadSnapshot returns an execution's summary and snapshot
+func (h *ExecutionHandler) loadSnapshot(ctx context.Context, id uuid.UUID) (map[string]any, store.Snapshot, error) {
+	var (
+		workflowID   uuid.UUID
+		version      *int
+		status       string
+		replayOf     *uuid.UUID
+		snapshotJSON []byte
+		snapshot     store.Snapshot
+	)
+	err := h.db.Pool().QueryRow(ctx, `
+		SELECT workflow_id, workflow_version, status, replay_of, snapshot
+		FROM executions
+		WHERE id = $1
+	`, id).Scan(&workflowID, &version, &status, &replayOf, &snapshotJSON)
+	if err != nil {
+		return nil, snapshot, fmt.Errorf("execution %s not found", id)
+	}
+	json.Unmarshal(snapshotJSON, &snapshot)
 
+	return map[string]any{
+		"id":               id,
+		"workflow_id":      workflowID,
+		"workflow_version": version,
+		"status":           status,
+		"replay_of":        replayOf,
+	}, snapshot, nil
+}
+
+// Logs returns an execution's journal in sequence order. Clients fetch
+// incrementally by passing the last sequence they have as ?after=.
+func (h *ExecutionHandler) Logs(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid execution id"})
+		return
+	}
+
+	after := 0
+	if v := c.Query("after"); v != "" {
+		after, err = strconv.Atoi(v)
+		if err != nil || after < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid after sequence"})
+			return
+		}
+	}
+	limit := 500
+	if v := c.Query("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+			return
+		}
+	}
+
+	var exists bool
+	h.db.Pool().QueryRow(context.Background(), `SELECT EXISTS (SELECT 1 FROM executions WHERE id = $1)`, id).Scan(&exists)
+	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "execution not found"})
 		return
 	}
 
-	var snapshot store.Snapshot
-	json.Unmarshal(snapshotJSON, &snapshot)
+	logs, err := h.logs(context.Background(), id, after, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	last := after
+	if len(logs) > 0 {
+		last = logs[len(logs)-1].Sequence
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"execution_id":  id,
+		"logs":          logs,
+		"last_sequence": last,
+		"has_more":      len(logs) == limit,
+	})
+}
 
-	// Apply modifications to snapshot
-	modificationMap := make(map[string]string)
-	for _, mod := range req.ModifiedSteps {
-		modificationMap[mod.StepID] = mod.NewOutput
+// logs returns up to limit journal entries of an execution after a sequence
+func (h *ExecutionHandler) logs(ctx context.Context, executionID uuid.UUID, after, limit int) ([]store.ExecutionLog, error) {
+	rows, err := h.db.Pool().Query(ctx, `
+		SELECT id, node_id, step_type, content, sequence, created_at
+		FROM execution_logs
+		WHERE execution_id = $1 AND sequence > $2
+		ORDER BY sequence
+		LIMIT $3
+	`, executionID, after, limit)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	for i, node := range snapshot.Nodes {
-		for j, step := range node.Steps {
-			if newOutput, ok := modificationMap[step.StepID]; ok {
-				snapshot.Nodes[i].Steps[j].Output = newOutput
-			}
+	logs := []store.ExecutionLog{}
+	for rows.Next() {
+		entry := store.ExecutionLog{ExecutionID: executionID}
+		err := rows.Scan(&entry.ID, &entry.NodeID, &entry.StepType, &entry.Content, &entry.Sequence, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
 		}
+		logs = append(logs, entry)
+	}
+	return logs, rows.Err()
+}
+
+// EventsSince returns the events journaled for an execution after a
+// sequence number. Node checkpoints are included as node_result events,
+// since they hold the node outputs. It implements websocket.History.
+func (h *ExecutionHandler) EventsSince(executionID string, sequence int) ([]websocket.Event, error) {
+	id, err := uuid.Parse(executionID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid execution id")
 	}
 
-	// Create new execution for replay
-	newExecutionID := uuid.New()
-	workflowID := snapshot.WorkflowID
+	rows, err := h.db.Pool().Query(context.Background(), `
+		SELECT sequence, COALESCE(content->>'type', step_type), content
+		FROM execution_logs
+		WHERE execution_id = $1 AND sequence > $2
+		ORDER BY sequence
+	`, id, sequence)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	_, err = h.db.Pool().Exec(context.Background(), `
-		INSERT INTO executions (id, workflow_id, status, snapshot)
-		VALUES ($1, $2, 'replaying', $3)
-	`, newExecutionID, workflowID, snapshotJSON)
+	var events []websocket.Event
+	for rows.Next() {
+		var event websocket.Event
+		if err := rows.Scan(&event.Sequence, &event.Type, &event.Data); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
 
+// approvals lists the approval requests of an execution, pending and decided
+func (h *ExecutionHandler) approvals(ctx context.Context, executionID uuid.UUID) ([]map[string]any, error) {
+	rows, err := h.db.Pool().Query(ctx, `
+		SELECT node_id, status, pending_output, timeout_action, expires_at,
+		       action, output, comment, timed_out, requested_at, decided_at
+		FROM execution_approvals
+		WHERE execution_id = $1
+		ORDER BY requested_at
+	`, executionID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, err
+	}
+	defer rows.Close()
+
+	approvals := []map[string]any{}
+	for rows.Next() {
+		var (
+			nodeID        string
+			status        string
+			pendingOutput string
+			timeoutAction string
+			expiresAt     *time.Time
+			action        *string
+			output        *string
+			comment       *string
+			timedOut      bool
+			requestedAt   time.Time
+			decidedAt     *time.Time
+		)
+		err := rows.Scan(&nodeID, &status, &pendingOutput, &timeoutAction, &expiresAt,
+			&action, &output, &comment, &timedOut, &requestedAt, &decidedAt)
+		if err != nil {
+			return nil, err
+		}
+		approvals = append(approvals, map[string]any{
+			"node_id":        nodeID,
+			"status":         status,
+			"pending_output": pendingOutput,
+			"timeout_action": timeoutAction,
+			"expires_at":     expiresAt,
+			"action":         action,
+			"output":         output,
+			"comment":        comment,
+			"timed_out":      timedOut,
+			"requested_at":   requestedAt,
+			"decided_at":     decidedAt,
+		})
+	}
+	return approvals, rows.Err()
+}
+
+// Decide approves, rejects or edits the pending output of an approval node
+func (h *ExecutionHandler) Decide(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid execution id"})
 		return
 	}
 
-	// TODO: Trigger re-execution from modified state
+	var req workflow.ApprovalDecision
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.decide(id, c.Param("node_id"), req); err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, errNotRunning) || errors.Is(err, workflow.ErrNoPendingApproval) {
+			code = http.StatusConflict
+		}
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "decision recorded"})
+}
+
+func (h *ExecutionHandler) decide(executionID uuid.UUID, nodeID string, decision workflow.ApprovalDecision) error {
+	scheduler, err := h.scheduler(executionID)
+	if err != nil {
+		return err
+	}
+	return scheduler.Decide(nodeID, decision)
+}
+
+// scheduler returns the scheduler running an execution
+func (h *ExecutionHandler) scheduler(executionID uuid.UUID) (*workflow.Scheduler, error) {
+	if h.runs == nil {
+		return nil, errNotRunning
+	}
+	scheduler, ok := h.runs.Get(executionID)
+	if !ok {
+		return nil, errNotRunning
+	}
+	return scheduler, nil
+}
+
+// Cancel stops a running execution. Its snapshot is finalized with status
+// cancelled once the running nodes have stopped.
+func (h *ExecutionHandler) Cancel(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid execution id"})
+		return
+	}
+
+	if err := h.cancel(id); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"execution_id": id,
+		"status":       "cancelling",
+	})
+}
+
+func (h *ExecutionHandler) cancel(executionID uuid.UUID) error {
+	scheduler, err := h.scheduler(executionID)
+	if err != nil {
+		return err
+	}
+	scheduler.Cancel()
+	return nil
+}
+
+// Pause holds back nodes that have not started; the execution is paused
+// once its running nodes finish
+func (h *ExecutionHandler) Pause(c *gin.Context) {
+	h.control(c, (*workflow.Scheduler).Pause)
+}
+
+// Resume starts the nodes held while the execution was paused
+func (h *ExecutionHandler) Resume(c *gin.Context) {
+	h.control(c, (*workflow.Scheduler).Resume)
+}
+
+// control applies a pause state change to a running execution and reports
+// the resulting state
+func (h *ExecutionHandler) control(c *gin.Context, change func(*workflow.Scheduler) error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid execution id"})
+		return
+	}
+
+	scheduler, err := h.scheduler(id)
+	if err == nil {
+		err = change(scheduler)
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"execution_id": id,
+		"status":       scheduler.State(),
+	})
+}
+
+// EditOutput replaces the output of a finished node while the execution is
+// paused
+func (h *ExecutionHandler) EditOutput(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid execution id"})
+		return
+	}
+
+	var req struct {
+		Output string `json:"output"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.editOutput(id, c.Param("node_id"), req.Output); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "output updated"})
+}
+
+func (h *ExecutionHandler) editOutput(executionID uuid.UUID, nodeID, output string) error {
+	scheduler, err := h.scheduler(executionID)
+	if err != nil {
+		return err
+	}
+	return scheduler.EditOutput(nodeID, output)
+}
+
+// HandleMessage handles execution control messages sent over the websocket.
+// It implements websocket.MessageHandler.
+func (h *ExecutionHandler) HandleMessage(executionID string, msg websocket.ClientMessage) error {
+	id, err := uuid.Parse(executionID)
+	if err != nil {
+		return fmt.Errorf("invalid execution id")
+	}
+
+	switch msg.Type {
+	case "approval":
+		return h.decide(id, msg.Data.NodeID, workflow.ApprovalDecision{
+			Action:  msg.Data.Action,
+			Output:  msg.Data.NewOutput,
+			Comment: msg.Data.Comment,
+		})
+	case "cancel":
+		return h.cancel(id)
+	case "pause", "resume":
+		scheduler, err := h.scheduler(id)
+		if err != nil {
+			return err
+		}
+		if msg.Type == "pause" {
+			return scheduler.Pause()
+		}
+		return scheduler.Resume()
+	case "edit_output":
+		return h.editOutput(id, msg.Data.NodeID, msg.Data.NewOutput)
+	default:
+		return fmt.Errorf("unsupported message type: %s", msg.Type)
+	}
+}
+
+// Replay starts a what-if replay of an execution with edited step outputs.
+// The nodes downstream of the edits run again on a new execution whose
+// events stream on its own channel.
+func (h *ExecutionHandler) Replay(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid execution id"})
+		return
+	}
+
+	var req struct {
+		ModifiedSteps []StepEdit `json:"modified_steps"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	run, err := h.replay(c.Request.Context(), id, req.ModifiedSteps)
+	if err != nil {
+		code := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, errInvalidEdit):
+			code = http.StatusBadRequest
+		case errors.Is(err, errExecutionNotFound):
+			code = http.StatusNotFound
+		case errors.Is(err, errReplayUnavailable):
+			code = http.StatusServiceUnavailable
+		}
+		c.JSON(code, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusAccepted, gin.H{
 		"original_execution_id": id,
-		"new_execution_id":      newExecutionID,
+		"new_execution_id":      run.ExecutionID,
 		"status":                "replaying",
 		"modifications_applied": len(req.ModifiedSteps),
+		"frozen_nodes":          run.Frozen,
+		"rerun_nodes":           run.Rerun,
 	})
 }
+
+func (h *ExecutionHandler) replay(ctx context.Context, executionID uuid.UUID, edits []StepEdit) (*ReplayRun, error) {
+	if h.workflows == nil {
+		return nil, errReplayUnavailable
+	}
+	return h.workflows.Replay(ctx, executionID, edits)
+}
+
+// ForkExecution replays an execution with one step's output edited and
+// returns the new execution's ID. It implements websocket.MessageHandler.
+func (h *ExecutionHandler) ForkExecution(executionID, stepID, newOutput string) (string, error) {
+	id, err := uuid.Parse(executionID)
+	if err != nil {
+		return "", fmt.Errorf("invalid execution id")
+	}
+	if stepID == "" {
+		return "", fmt.Errorf("step_id is required")
+	}
+
+	run, err := h.replay(context.Background(), id, []StepEdit{{StepID: stepID, NewOutput: newOutput}})
+	if err != nil {
+		return "", err
+	}
+	return run.ExecutionID.String(), nil
+}
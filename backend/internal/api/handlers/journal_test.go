@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+	"github.com/Wangren-Academy/Agent/backend/internal/workflow"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// testDB connects to the database in TEST_DATABASE_URL, initialised with
+// sql/init.sql, and skips the test without one
+func testDB(t *testing.T) *store.PostgresStore {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := store.NewPostgresStore(url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+// testExecution inserts a workflow with one execution and returns their IDs
+func testExecution(t *testing.T, db *store.PostgresStore) (uuid.UUID, uuid.UUID) {
+	t.Helper()
+	ctx := context.Background()
+	workflowID, executionID := uuid.New(), uuid.New()
+	_, err := db.Pool().Exec(ctx, `INSERT INTO workflows (id, name) VALUES ($1, 'journal test')`, workflowID)
+	if err != nil {
+		t.Fatalf("insert workflow: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Pool().Exec(context.Background(), `DELETE FROM workflows WHERE id = $1`, workflowID)
+	})
+	_, err = db.Pool().Exec(ctx, `INSERT INTO executions (id, workflow_id) VALUES ($1, $2)`, executionID, workflowID)
+	if err != nil {
+		t.Fatalf("insert execution: %v", err)
+	}
+	return workflowID, executionID
+}
+
+// getLogs calls the Logs endpoint
+func getLogs(t *testing.T, h *ExecutionHandler, executionID uuid.UUID, query string) (int, map[string]any) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: executionID.String()}}
+	c.Request = httptest.NewRequest(http.MethodGet, "/logs?"+query, nil)
+	h.Logs(c)
+	var body map[string]any
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body
+}
+
+func TestJournalPagination(t *testing.T) {
+	db := testDB(t)
+	_, executionID := testExecution(t, db)
+	workflows := NewWorkflowHandler(db, nil)
+	executions := NewExecutionHandler(db)
+
+	// Events and checkpoints are journaled concurrently, as parallel
+	// branches do
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		nodeID := fmt.Sprint("n", i)
+		go func() {
+			defer wg.Done()
+			workflows.publish(executionID, workflow.ExecutionEvent{Type: "node_started", NodeID: nodeID})
+		}()
+		go func() {
+			defer wg.Done()
+			err := workflows.RecordNode(context.Background(), executionID, store.NodeSnapshot{NodeID: nodeID, FinalOutput: "out " + nodeID})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Paging with the returned cursor sees every entry exactly once
+	var sequences []int
+	after := 0
+	for {
+		code, body := getLogs(t, executions, executionID, fmt.Sprintf("after=%d&limit=7", after))
+		if code != http.StatusOK {
+			t.Fatalf("status %d: %v", code, body)
+		}
+		for _, entry := range body["logs"].([]any) {
+			sequences = append(sequences, int(entry.(map[string]any)["sequence"].(float64)))
+		}
+		after = int(body["last_sequence"].(float64))
+		if body["has_more"] != true {
+			break
+		}
+	}
+	if len(sequences) != 40 {
+		t.Fatalf("paged %d entries, want 40", len(sequences))
+	}
+	for i, sequence := range sequences {
+		if sequence != i+1 {
+			t.Fatalf("entry %d has sequence %d: %v", i, sequence, sequences)
+		}
+	}
+
+	events, err := executions.EventsSince(executionID.String(), 10)
+	if err != nil {
+		t.Fatalf("EventsSince: %v", err)
+	}
+	last := 10
+	outputs := 0
+	for _, event := range events {
+		if event.Sequence <= last {
+			t.Fatalf("events out of order after sequence %d: %d", last, event.Sequence)
+		}
+		last = event.Sequence
+		// Catch-up carries the node outputs
+		if event.Type == "node_result" {
+			var node store.NodeSnapshot
+			if err := json.Unmarshal(event.Data, &node); err != nil || node.FinalOutput != "out "+node.NodeID {
+				t.Errorf("node_result %s = %+v, %v", event.Data, node, err)
+			}
+			outputs++
+		}
+	}
+	if outputs == 0 {
+		t.Error("catch-up has no node results")
+	}
+
+	if code, _ := getLogs(t, executions, executionID, "after=-1"); code != http.StatusBadRequest {
+		t.Errorf("negative cursor: status %d", code)
+	}
+	if code, _ := getLogs(t, executions, uuid.New(), ""); code != http.StatusNotFound {
+		t.Errorf("unknown execution: status %d", code)
+	}
+}
+
+func TestJournalReleasesChildExecutions(t *testing.T) {
+	db := testDB(t)
+	workflowID, executionID := testExecution(t, db)
+	h := NewWorkflowHandler(db, nil)
+	ctx := context.Background()
+
+	childID, err := h.StartChildExecution(ctx, executionID, "sub", workflowID, nil)
+	if err != nil {
+		t.Fatalf("StartChildExecution: %v", err)
+	}
+	if err := h.RecordNode(ctx, childID, store.NodeSnapshot{NodeID: "a"}); err != nil {
+		t.Fatalf("RecordNode: %v", err)
+	}
+	wf := &store.Workflow{ID: workflowID}
+	dag, err := workflow.NewDAG(wf)
+	if err != nil {
+		t.Fatalf("NewDAG: %v", err)
+	}
+	sub := &workflow.SubWorkflow{WorkflowID: workflowID, Workflow: wf, DAG: dag}
+	if err := h.FinishChildExecution(ctx, childID, sub, nil, nil); err != nil {
+		t.Fatalf("FinishChildExecution: %v", err)
+	}
+
+	h.journalsMu.Lock()
+	defer h.journalsMu.Unlock()
+	if _, ok := h.journals[childID]; ok {
+		t.Error("the finished child execution's journal was kept")
+	}
+}
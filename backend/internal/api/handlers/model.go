@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ModelHandler handles model discovery requests
+type ModelHandler struct {
+	local *agent.LocalAdapter
+}
+
+// NewModelHandler creates a new model handler
+func NewModelHandler(local *agent.LocalAdapter) *ModelHandler {
+	return &ModelHandler{local: local}
+}
+
+// ListLocal returns the models available on the local model endpoint
+func (h *ModelHandler) ListLocal(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	api := c.DefaultQuery("api", agent.LocalAPIOllama)
+	models, err := h.local.ListModels(ctx, api)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"healthy": false,
+			"api":     api,
+			"models":  []string{},
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"healthy": true,
+		"api":     api,
+		"models":  models,
+	})
+}
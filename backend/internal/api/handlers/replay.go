@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+	"github.com/Wangren-Academy/Agent/backend/internal/workflow"
+
+	"github.com/google/uuid"
+)
+
+var (
+	errExecutionNotFound = errors.New("execution not found")
+	errInvalidEdit       = errors.New("invalid step edit")
+)
+
+// StepEdit replaces the output of a recorded step
+type StepEdit struct {
+	StepID    string `json:"step_id"`
+	NewOutput string `json:"new_output"`
+}
+
+// ReplayRun describes a replay that was started
+type ReplayRun struct {
+	ExecutionID uuid.UUID
+	Frozen      []string
+	Rerun       []string
+}
+
+// Replay starts a what-if run of an execution. Each edit replaces the output
+// of the node whose final step it targets. Nodes that do not depend on an
+// edited node keep their recorded results, and only the nodes downstream of
+// the edits run again; without edits every node runs again. An execution
+// still in progress is forked from the nodes it has finished so far. The
+// replay streams on the new execution's channel.
+func (h *WorkflowHandler) Replay(ctx context.Context, executionID uuid.UUID, edits []StepEdit) (*ReplayRun, error) {
+	var (
+		workflowID   uuid.UUID
+		version      *int
+		snapshotJSON []byte
+		inputJSON    []byte
+		finishedAt   *time.Time
+	)
+	err := h.db.Pool().QueryRow(ctx, `
+		SELECT workflow_id, workflow_version, snapshot, input_data, finished_at
+		FROM executions
+		WHERE id = $1
+	`, executionID).Scan(&workflowID, &version, &snapshotJSON, &inputJSON, &finishedAt)
+	if err != nil {
+		return nil, errExecutionNotFound
+	}
+
+	var snapshot store.Snapshot
+	if err := json.Unmarshal(snapshotJSON, &snapshot); err != nil {
+		return nil, fmt.Errorf("decode snapshot: %w", err)
+	}
+	recorded := snapshot.Nodes
+	if finishedAt == nil {
+		if recorded, err = h.checkpoint(ctx, executionID, snapshot.Nodes); err != nil {
+			return nil, err
+		}
+	}
+	var input map[string]any
+	json.Unmarshal(inputJSON, &input)
+
+	// Replay the workflow version the original execution ran
+	pinned := 0
+	if version != nil {
+		pinned = *version
+	}
+	wf, err := h.GetWorkflow(ctx, workflowID, pinned)
+	if err != nil {
+		return nil, err
+	}
+	dag, err := workflow.BuildDAG(ctx, h, wf)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]store.NodeSnapshot)
+	for _, node := range recorded {
+		if _, ok := dag.Nodes[node.NodeID]; ok && node.Status != workflow.NodeStatusCancelled {
+			nodes[node.NodeID] = node
+		}
+	}
+	edited, err := applyEdits(dag, nodes, edits)
+	if err != nil {
+		return nil, err
+	}
+
+	rerun := make(map[string]bool)
+	for nodeID := range edited {
+		for id := range dag.Descendants(nodeID) {
+			rerun[id] = true
+		}
+	}
+	if len(edits) == 0 {
+		for id := range dag.Nodes {
+			rerun[id] = true
+		}
+	}
+
+	run := &ReplayRun{ExecutionID: uuid.New()}
+	var frozen []store.NodeSnapshot
+	for id, node := range nodes {
+		// An edited node keeps its edited output even below another edit
+		if rerun[id] && !edited[id] {
+			continue
+		}
+		frozen = append(frozen, node)
+		run.Frozen = append(run.Frozen, id)
+	}
+	for id := range dag.Nodes {
+		if _, ok := nodes[id]; !ok || (rerun[id] && !edited[id]) {
+			run.Rerun = append(run.Rerun, id)
+		}
+	}
+	sort.Strings(run.Frozen)
+	sort.Strings(run.Rerun)
+
+	scheduler := h.newScheduler(dag, run.ExecutionID)
+	scheduler.Freeze(frozen)
+
+	// The frozen nodes are in the initial snapshot so an interrupted replay
+	// can be recovered like any other execution
+	initial := store.Snapshot{
+		WorkflowID:  workflowID,
+		ExecutionID: run.ExecutionID,
+		Nodes:       workflow.NodeSnapshots(dag, scheduler.GetResults()),
+		Edges:       wf.Edges,
+	}
+	initialJSON, _ := json.Marshal(initial)
+	_, err = h.db.Pool().Exec(ctx, `
+		INSERT INTO executions (id, workflow_id, workflow_version, status, snapshot, input_data, replay_of)
+		VALUES ($1, $2, $3, 'replaying', $4, $5, $6)
+	`, run.ExecutionID, workflowID, wf.Version, initialJSON, inputJSON, executionID)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Workflow] Replaying execution %s as %s (%d frozen, %d to rerun)",
+		executionID, run.ExecutionID, len(run.Frozen), len(run.Rerun))
+	h.start(scheduler, wf, dag, run.ExecutionID, input)
+	return run, nil
+}
+
+// applyEdits substitutes edited step outputs into the recorded nodes and
+// returns the edited node IDs. Only a node's final step can be edited, since
+// that is the output its downstream nodes received. An edited router step
+// changes the route, which must name one of its labels, and the router still
+// passes its input through. Map and sub-workflow nodes combine several runs
+// into their output, so their steps cannot be edited. Rejected edits return
+// errInvalidEdit.
+func applyEdits(dag *workflow.DAG, nodes map[string]store.NodeSnapshot, edits []StepEdit) (map[string]bool, error) {
+	owners := make(map[string]string)
+	for nodeID, node := range nodes {
+		for _, step := range node.Steps {
+			owners[step.StepID] = nodeID
+		}
+	}
+
+	edited := make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, edit := range edits {
+		if edit.StepID == "" {
+			return nil, fmt.Errorf("%w: step_id is required", errInvalidEdit)
+		}
+		if seen[edit.StepID] {
+			return nil, fmt.Errorf("%w: step %s is edited more than once", errInvalidEdit, edit.StepID)
+		}
+		seen[edit.StepID] = true
+
+		nodeID, ok := owners[edit.StepID]
+		if !ok {
+			return nil, fmt.Errorf("%w: step %s not found", errInvalidEdit, edit.StepID)
+		}
+		node := nodes[nodeID]
+		last := len(node.Steps) - 1
+		if node.Steps[last].StepID != edit.StepID {
+			return nil, fmt.Errorf("%w: step %s is not the final step of node %s; only final steps can be edited",
+				errInvalidEdit, edit.StepID, nodeID)
+		}
+
+		node.Steps = append([]store.Step(nil), node.Steps...)
+		node.Steps[last].Output = edit.NewOutput
+		switch nodeType := dag.Nodes[nodeID].Type; nodeType {
+		case workflow.NodeTypeMap, workflow.NodeTypeSubWorkflow:
+			return nil, fmt.Errorf("%w: step %s belongs to %s node %s, whose output combines several runs; edit a node after it instead",
+				errInvalidEdit, edit.StepID, nodeType, nodeID)
+		case workflow.NodeTypeRouter:
+			route, err := dag.EditedRoute(nodeID, edit.NewOutput)
+			if err != nil {
+				return nil, fmt.Errorf("%w: step %s of router %s: %w", errInvalidEdit, edit.StepID, nodeID, err)
+			}
+			node.Route = route
+			node.FinalOutput = node.Steps[last].Input
+		default:
+			node.FinalOutput = edit.NewOutput
+		}
+		node.Status = workflow.NodeStatusSuccess
+		node.Error = ""
+		node.Edited = true
+		nodes[nodeID] = node
+		edited[nodeID] = true
+	}
+	return edited, nil
+}
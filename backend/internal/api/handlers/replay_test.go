@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+	"github.com/Wangren-Academy/Agent/backend/internal/workflow"
+
+	"github.com/google/uuid"
+)
+
+// replayDAG has a transform a and agent b, a router r choosing between
+// yes and no, and a map node m and sub-workflow node sub
+func replayDAG(t *testing.T) *workflow.DAG {
+	t.Helper()
+	node := func(id, nodeType string, data map[string]any) store.NodeConfig {
+		if data == nil {
+			data = map[string]any{}
+		}
+		data["type"] = nodeType
+		return store.NodeConfig{ID: id, Data: data}
+	}
+	dag, err := workflow.NewDAG(&store.Workflow{
+		Nodes: []store.NodeConfig{
+			node("a", workflow.NodeTypeTransform, map[string]any{"template": "x"}),
+			{ID: "b", AgentID: uuid.New()},
+			{ID: "r", AgentID: uuid.New(), Data: map[string]any{"type": workflow.NodeTypeRouter}},
+			node("yes", workflow.NodeTypeTransform, map[string]any{"template": "y"}),
+			node("no", workflow.NodeTypeTransform, map[string]any{"template": "n"}),
+			{ID: "m", AgentID: uuid.New(), Data: map[string]any{"type": workflow.NodeTypeMap, "items": "{{input.list}}"}},
+			node("sub", workflow.NodeTypeSubWorkflow, map[string]any{"workflow_id": uuid.NewString()}),
+		},
+		Edges: []store.EdgeConfig{
+			{ID: "e1", Source: "r", Target: "yes", Label: "Yes"},
+			{ID: "e2", Source: "r", Target: "no", Label: "No"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewDAG: %v", err)
+	}
+	return dag
+}
+
+func replayNodes() map[string]store.NodeSnapshot {
+	return map[string]store.NodeSnapshot{
+		"a": {NodeID: "a", Status: workflow.NodeStatusSuccess, FinalOutput: "final", Steps: []store.Step{
+			{StepID: "a1", Output: "thinking"},
+			{StepID: "a2", Output: "final"},
+		}},
+		"b": {NodeID: "b", Status: workflow.NodeStatusFailed, Error: "boom", Steps: []store.Step{
+			{StepID: "b1"},
+		}},
+		"r": {NodeID: "r", Status: workflow.NodeStatusSuccess, Route: "Yes", FinalOutput: "request", Steps: []store.Step{
+			{StepID: "r1", Input: "request", Output: "route: Yes\nlooks fine"},
+		}},
+		"m": {NodeID: "m", Status: workflow.NodeStatusSuccess, FinalOutput: `["A","B"]`, Steps: []store.Step{
+			{StepID: "m1", Output: "A"},
+			{StepID: "m2", Output: "B"},
+		}},
+		"sub": {NodeID: "sub", Status: workflow.NodeStatusSuccess, FinalOutput: "child", Steps: []store.Step{
+			{StepID: "s1", Output: "child"},
+		}},
+	}
+}
+
+func TestApplyEdits(t *testing.T) {
+	nodes := replayNodes()
+	edited, err := applyEdits(replayDAG(t), nodes, []StepEdit{{StepID: "a2", NewOutput: "changed"}, {StepID: "b1", NewOutput: "fixed"}})
+	if err != nil {
+		t.Fatalf("applyEdits: %v", err)
+	}
+	if !edited["a"] || !edited["b"] || len(edited) != 2 {
+		t.Errorf("edited = %v", edited)
+	}
+	if a := nodes["a"]; a.FinalOutput != "changed" || a.Steps[1].Output != "changed" || !a.Edited {
+		t.Errorf("a = %+v", a)
+	}
+	if b := nodes["b"]; b.Status != workflow.NodeStatusSuccess || b.Error != "" || b.FinalOutput != "fixed" {
+		t.Errorf("an edited failed node should succeed with the new output: %+v", b)
+	}
+	if replayNodes()["a"].Steps[1].Output != "final" {
+		t.Error("the recorded steps were modified")
+	}
+}
+
+func TestApplyEditsRouter(t *testing.T) {
+	for _, output := range []string{"route: no\nchanged my mind", "No", " ROUTE:No "} {
+		nodes := replayNodes()
+		if _, err := applyEdits(replayDAG(t), nodes, []StepEdit{{StepID: "r1", NewOutput: output}}); err != nil {
+			t.Fatalf("applyEdits(%q): %v", output, err)
+		}
+		// The route changes and the router still passes its input on
+		r := nodes["r"]
+		if r.Route != "No" || r.FinalOutput != "request" || r.Steps[0].Output != output {
+			t.Errorf("edit %q gave %+v", output, r)
+		}
+	}
+}
+
+func TestApplyEditsRejectsUnsupportedEdits(t *testing.T) {
+	tests := []struct {
+		name  string
+		edits []StepEdit
+		err   string
+	}{
+		{"missing step id", []StepEdit{{NewOutput: "x"}}, "step_id is required"},
+		{"unknown step", []StepEdit{{StepID: "zz"}}, "not found"},
+		{"intermediate step", []StepEdit{{StepID: "a1"}}, "only final steps can be edited"},
+		{"same step twice", []StepEdit{{StepID: "a2"}, {StepID: "a2"}}, "more than once"},
+		{"unknown route", []StepEdit{{StepID: "r1", NewOutput: "route: maybe"}}, `"maybe" names none of the routes`},
+		{"map item", []StepEdit{{StepID: "m2", NewOutput: "C"}}, "map node m"},
+		{"sub-workflow", []StepEdit{{StepID: "s1", NewOutput: "other"}}, "subworkflow node sub"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := applyEdits(replayDAG(t), replayNodes(), tt.edits)
+			if !errors.Is(err, errInvalidEdit) || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want an invalid edit containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestBuildSnapshotCountsOnlyRerunNodes(t *testing.T) {
+	dag, err := workflow.NewDAG(&store.Workflow{Nodes: []store.NodeConfig{
+		{ID: "frozen", Data: map[string]any{"type": workflow.NodeTypeTransform, "template": "x"}},
+		{ID: "rerun", Data: map[string]any{"type": workflow.NodeTypeTransform, "template": "y"}},
+	}})
+	if err != nil {
+		t.Fatalf("NewDAG: %v", err)
+	}
+	results := map[string]*workflow.NodeResult{
+		"frozen": {Status: workflow.NodeStatusSuccess, Frozen: true, Steps: []store.Step{{Tokens: 100, LatencyMs: 1000}}},
+		"rerun":  {Status: workflow.NodeStatusSuccess, Steps: []store.Step{{Tokens: 10, LatencyMs: 20}}},
+	}
+
+	meta := buildSnapshot(uuid.New(), uuid.New(), dag, results, nil).ExecutionMeta
+	if meta.TotalTokens != 10 || meta.DurationMs != 20 {
+		t.Errorf("meta = %+v, want only the rerun node's usage", meta)
+	}
+	if meta.TotalCost != 10*workflow.EstimatedCostPerToken {
+		t.Errorf("cost = %v", meta.TotalCost)
+	}
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/tools"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ToolHandler handles tool-related requests
+type ToolHandler struct {
+	registry *tools.Registry
+}
+
+// NewToolHandler creates a new tool handler
+func NewToolHandler(registry *tools.Registry) *ToolHandler {
+	return &ToolHandler{registry: registry}
+}
+
+// List returns the definitions of all tools agents can be granted
+func (h *ToolHandler) List(c *gin.Context) {
+	c.JSON(http.StatusOK, h.registry.List())
+}
@@ -3,11 +3,16 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/Wangren-Academy/Agent/backend/internal/agent"
 	"github.com/Wangren-Academy/Agent/backend/internal/store"
+	"github.com/Wangren-Academy/Agent/backend/internal/tools"
 	"github.com/Wangren-Academy/Agent/backend/internal/websocket"
 	"github.com/Wangren-Academy/Agent/backend/internal/workflow"
 
@@ -20,13 +25,21 @@ type WorkflowHandler struct {
 	db       *store.PostgresStore
 	hub      *websocket.Hub
 	registry *agent.Registry
+	tools    *tools.Registry
+	http     *http.Client
+	runs     *workflow.Runs
+
+	// journals holds the log state of each execution being journaled
+	journalsMu sync.Mutex
+	journals   map[uuid.UUID]*journal
 }
 
 // NewWorkflowHandler creates a new workflow handler
-func NewWorkflowHandler(db *store.PostgresStore) *WorkflowHandler {
+func NewWorkflowHandler(db *store.PostgresStore, registry *agent.Registry) *WorkflowHandler {
 	return &WorkflowHandler{
 		db:       db,
-		registry: agent.NewRegistry(),
+		registry: registry,
+		journals: make(map[uuid.UUID]*journal),
 	}
 }
 
@@ -35,6 +48,21 @@ func (h *WorkflowHandler) SetHub(hub *websocket.Hub) {
 	h.hub = hub
 }
 
+// SetTools sets the tool registry available to agents
+func (h *WorkflowHandler) SetTools(registry *tools.Registry) {
+	h.tools = registry
+}
+
+// SetHTTPClient sets the client HTTP nodes send requests with
+func (h *WorkflowHandler) SetHTTPClient(client *http.Client) {
+	h.http = client
+}
+
+// SetRuns sets the registry running executions are tracked in
+func (h *WorkflowHandler) SetRuns(runs *workflow.Runs) {
+	h.runs = runs
+}
+
 // List returns all workflows
 func (h *WorkflowHandler) List(c *gin.Context) {
 	rows, err := h.db.Pool().Query(context.Background(), `
@@ -100,21 +128,34 @@ func (h *WorkflowHandler) Create(c *gin.Context) {
 		return
 	}
 
+	if err := h.validateWorkflow(c.Request.Context(), uuid.Nil, req.Nodes, req.Edges); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	nodesJSON, _ := json.Marshal(req.Nodes)
 	edgesJSON, _ := json.Marshal(req.Edges)
 
-	var id uuid.UUID
+	var (
+		id      uuid.UUID
+		version int
+	)
 	err := h.db.Pool().QueryRow(context.Background(), `
 		INSERT INTO workflows (name, description, nodes, edges)
 		VALUES ($1, $2, $3, $4)
-		RETURNING id
-	`, req.Name, req.Description, nodesJSON, edgesJSON).Scan(&id)
+		RETURNING id, version
+	`, req.Name, req.Description, nodesJSON, edgesJSON).Scan(&id, &version)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if err := h.saveVersion(context.Background(), id, version, nodesJSON, edgesJSON); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
 		"id":          id,
 		"name":        req.Name,
@@ -190,10 +231,16 @@ func (h *WorkflowHandler) Update(c *gin.Context) {
 		return
 	}
 
+	if err := h.validateWorkflow(c.Request.Context(), id, req.Nodes, req.Edges); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	nodesJSON, _ := json.Marshal(req.Nodes)
 	edgesJSON, _ := json.Marshal(req.Edges)
 
-	_, err = h.db.Pool().Exec(context.Background(), `
+	var version int
+	err = h.db.Pool().QueryRow(context.Background(), `
 		UPDATE workflows
 		SET name = COALESCE($2, name),
 		    description = COALESCE($3, description),
@@ -201,13 +248,19 @@ func (h *WorkflowHandler) Update(c *gin.Context) {
 		    edges = COALESCE($5, edges),
 		    version = version + 1
 		WHERE id = $1
-	`, id, req.Name, req.Description, nodesJSON, edgesJSON)
+		RETURNING version
+	`, id, req.Name, req.Description, nodesJSON, edgesJSON).Scan(&version)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if err := h.saveVersion(context.Background(), id, version, nodesJSON, edgesJSON); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "workflow updated"})
 }
 
@@ -241,17 +294,10 @@ func (h *WorkflowHandler) Execute(c *gin.Context) {
 	}
 	c.ShouldBindJSON(&req)
 
-	// Create execution record
-	executionID := uuid.New()
-	_, err = h.db.Pool().Exec(context.Background(), `
-		INSERT INTO executions (id, workflow_id, status, snapshot)
-		VALUES ($1, $2, 'running', '{}')
-	`, executionID, workflowID)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	if req.InputData == nil {
+		req.InputData = map[string]any{}
 	}
+	inputJSON, _ := json.Marshal(req.InputData)
 
 	// Get workflow
 	var (
@@ -259,13 +305,14 @@ func (h *WorkflowHandler) Execute(c *gin.Context) {
 		description string
 		nodesJSON   []byte
 		edgesJSON   []byte
+		version     int
 	)
 	err = h.db.Pool().QueryRow(context.Background(), `
-		SELECT name, description, nodes, edges FROM workflows WHERE id = $1
-	`, workflowID).Scan(&name, &description, &nodesJSON, &edgesJSON)
+		SELECT name, description, nodes, edges, version FROM workflows WHERE id = $1
+	`, workflowID).Scan(&name, &description, &nodesJSON, &edgesJSON, &version)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "workflow not found"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "workflow not found"})
 		return
 	}
 
@@ -275,34 +322,80 @@ func (h *WorkflowHandler) Execute(c *gin.Context) {
 	json.Unmarshal(edgesJSON, &edges)
 
 	wf := &store.Workflow{
-		ID:    workflowID,
-		Name:  name,
-		Nodes: nodes,
-		Edges: edges,
+		ID:          workflowID,
+		Name:        name,
+		Description: description,
+		Nodes:       nodes,
+		Edges:       edges,
+		Version:     version,
 	}
 
-	// Build DAG and scheduler
-	dag, err := workflow.NewDAG(wf)
+	// Build the DAG before recording the execution, so a workflow that
+	// cannot run leaves no execution behind
+	dag, err := workflow.BuildDAG(c.Request.Context(), h, wf)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Create execution record
+	executionID := uuid.New()
+	_, err = h.db.Pool().Exec(context.Background(), `
+		INSERT INTO executions (id, workflow_id, workflow_version, status, snapshot, input_data)
+		VALUES ($1, $2, $3, 'running', '{}', $4)
+	`, executionID, workflowID, version, inputJSON)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	scheduler := h.newScheduler(dag, executionID)
+	h.start(scheduler, wf, dag, executionID, req.InputData)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"execution_id": executionID,
+		"status":       "running",
+	})
+}
+
+// newScheduler creates a scheduler wired to the handler's agents, tools,
+// HTTP client and run registry
+func (h *WorkflowHandler) newScheduler(dag *workflow.DAG, executionID uuid.UUID) *workflow.Scheduler {
 	agentHandler := &AgentHandler{db: h.db}
 	scheduler := workflow.NewScheduler(dag, agentHandler, h.registry, executionID)
+	scheduler.SetRecorder(h)
+	scheduler.SetHTTPClient(h.http)
+	scheduler.SetRuns(h.runs)
+	if h.tools != nil {
+		scheduler.SetTools(h.tools.NewSession())
+	}
+	return scheduler
+}
 
-	// Start execution in background
-	go func() {
-		ctx := context.Background()
-		err := scheduler.Run(ctx, req.InputData)
+// start runs an execution in the background, journals and streams its
+// events and writes the final snapshot once it finishes
+func (h *WorkflowHandler) start(scheduler *workflow.Scheduler, wf *store.Workflow, dag *workflow.DAG, executionID uuid.UUID, input map[string]any) {
+	if h.runs != nil {
+		h.runs.Add(executionID, scheduler)
+	}
 
-		status := "success"
-		if err != nil {
-			status = "failed"
+	// The scheduler closes its event channel when Run returns
+	streamed := make(chan struct{})
+	go func() {
+		defer close(streamed)
+		for event := range scheduler.Events() {
+			h.publish(executionID, event)
 		}
+	}()
+
+	go func() {
+		ctx := context.Background()
+		err := scheduler.Run(ctx, input)
+		status := executionStatus(err)
 
 		// Build snapshot
-		snapshot := buildSnapshot(workflowID, executionID, scheduler.GetResults(), edges)
+		snapshot := buildSnapshot(wf.ID, executionID, dag, scheduler.GetResults(), wf.Edges)
 
 		snapshotJSON, _ := json.Marshal(snapshot)
 		now := time.Now()
@@ -311,35 +404,490 @@ func (h *WorkflowHandler) Execute(c *gin.Context) {
 			SET status = $1, snapshot = $2, finished_at = $3
 			WHERE id = $4
 		`, status, snapshotJSON, now, executionID)
+		// The run stays reachable until its final status is stored, so
+		// controls never find it gone while the row still says running
+		if h.runs != nil {
+			h.runs.Remove(executionID)
+		}
+		h.expireApprovals(ctx, executionID)
+
+		<-streamed
+		finished := workflow.ExecutionEvent{
+			Type:      "execution_complete",
+			State:     status,
+			Timestamp: now,
+		}
+		if err != nil {
+			finished.Error = err.Error()
+		}
+		h.publish(executionID, finished)
+		h.forgetJournal(executionID)
 	}()
+}
+
+// publish appends an event to the execution's log and streams it to
+// subscribed clients with its sequence number. Token deltas are only
+// streamed; the completed step carries the full output. A node's result is
+// journaled once, by its node_result checkpoint, so node_complete is
+// journaled without it and clients catching up read it from node_result.
+func (h *WorkflowHandler) publish(executionID uuid.UUID, event workflow.ExecutionEvent) {
+	sequence := 0
+	if event.Type != "token_delta" {
+		// Steps are logged under their own type, e.g. tool_call
+		entryType := event.Type
+		if event.Step != nil && event.Step.Type != "" {
+			entryType = event.Step.Type
+		}
+		entry := event
+		entry.Result = nil
+		var err error
+		sequence, err = h.appendLog(context.Background(), executionID, event.NodeID, entryType, entry)
+		if err != nil {
+			log.Printf("[Workflow] Failed to log %s event of execution %s: %v", event.Type, executionID, err)
+		}
+	}
 
-	// Stream events via WebSocket
 	if h.hub != nil {
-		go func() {
-			for event := range scheduler.Events() {
-				h.hub.BroadcastToExecution(executionID.String(), event.Type, event)
-			}
-		}()
+		h.hub.BroadcastEvent(executionID.String(), event.Type, sequence, event)
+	}
+}
+
+// RecoverExecutions picks up the executions that were unfinished when the
+// backend stopped. Executions waiting for approval or paused are resumed in
+// that state. Executions interrupted while running are resumed when
+// resumeInterrupted is set and marked failed otherwise. Finished nodes are
+// restored from their checkpoints, so only the remaining nodes run; nodes
+// that were running when the backend stopped run again.
+func (h *WorkflowHandler) RecoverExecutions(ctx context.Context, resumeInterrupted bool) error {
+	rows, err := h.db.Pool().Query(ctx, `
+		SELECT id, workflow_id, workflow_version, status, snapshot, input_data
+		FROM executions
+		WHERE status IN ('running', 'replaying', 'resuming', 'waiting_for_input', 'pausing', 'paused')
+		  AND finished_at IS NULL AND parent_execution_id IS NULL
+	`)
+	if err != nil {
+		return err
 	}
 
-	c.JSON(http.StatusAccepted, gin.H{
-		"execution_id": executionID,
-		"status":       "running",
-	})
+	type unfinished struct {
+		id, workflowID uuid.UUID
+		version        *int
+		status         string
+		snapshot       store.Snapshot
+		input          map[string]any
+	}
+	var executions []unfinished
+	for rows.Next() {
+		var (
+			e            unfinished
+			snapshotJSON []byte
+			inputJSON    []byte
+		)
+		if err := rows.Scan(&e.id, &e.workflowID, &e.version, &e.status, &snapshotJSON, &inputJSON); err != nil {
+			rows.Close()
+			return err
+		}
+		json.Unmarshal(snapshotJSON, &e.snapshot)
+		json.Unmarshal(inputJSON, &e.input)
+		executions = append(executions, e)
+	}
+	rows.Close()
+
+	for _, e := range executions {
+		interrupted := e.status == "running" || e.status == "replaying" || e.status == "resuming"
+		if interrupted && !resumeInterrupted {
+			log.Printf("[Workflow] Marking interrupted execution %s failed", e.id)
+			h.failExecution(ctx, e.id)
+			continue
+		}
+
+		nodes, err := h.checkpoint(ctx, e.id, e.snapshot.Nodes)
+		if err == nil {
+			paused := e.status == "pausing" || e.status == "paused"
+			err = h.resume(ctx, e.id, e.workflowID, e.version, nodes, e.input, paused)
+		}
+		if err != nil {
+			log.Printf("[Workflow] Cannot resume execution %s: %v", e.id, err)
+			h.failExecution(ctx, e.id)
+			continue
+		}
+		log.Printf("[Workflow] Resumed %s execution %s from %d finished node(s)", e.status, e.id, len(nodes))
+	}
+	return nil
+}
+
+// failExecution marks an execution that cannot continue as failed
+func (h *WorkflowHandler) failExecution(ctx context.Context, executionID uuid.UUID) {
+	_, err := h.db.Pool().Exec(ctx, `
+		UPDATE executions SET status = 'failed', finished_at = $2 WHERE id = $1
+	`, executionID, time.Now())
+	if err != nil {
+		log.Printf("[Workflow] Failed to mark execution %s failed: %v", executionID, err)
+	}
+	h.expireApprovals(ctx, executionID)
 }
 
-func buildSnapshot(workflowID, executionID uuid.UUID, results map[string]*workflow.NodeResult, edges []store.EdgeConfig) store.Snapshot {
-	nodeSnapshots := make([]store.NodeSnapshot, 0)
+// checkpoint returns the latest checkpointed result of every finished node,
+// falling back to the snapshot for nodes without one
+func (h *WorkflowHandler) checkpoint(ctx context.Context, executionID uuid.UUID, snapshot []store.NodeSnapshot) ([]store.NodeSnapshot, error) {
+	rows, err := h.db.Pool().Query(ctx, `
+		SELECT DISTINCT ON (node_id) content
+		FROM execution_logs
+		WHERE execution_id = $1 AND step_type = 'node_result'
+		ORDER BY node_id, sequence DESC
+	`, executionID)
+	if err != nil {
+		return nil, fmt.Errorf("load checkpoint: %w", err)
+	}
+	defer rows.Close()
+
+	latest := make(map[string]store.NodeSnapshot)
+	for _, node := range snapshot {
+		latest[node.NodeID] = node
+	}
+	for rows.Next() {
+		var content []byte
+		if err := rows.Scan(&content); err != nil {
+			return nil, fmt.Errorf("load checkpoint: %w", err)
+		}
+		var node store.NodeSnapshot
+		if err := json.Unmarshal(content, &node); err != nil {
+			return nil, fmt.Errorf("decode checkpoint: %w", err)
+		}
+		latest[node.NodeID] = node
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load checkpoint: %w", err)
+	}
+
+	nodes := make([]store.NodeSnapshot, 0, len(latest))
+	for _, node := range latest {
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// resume restarts one execution from its restored node results, paused if
+// requested. It runs the workflow version the execution started with, or the
+// latest for executions that did not record one. Child executions left
+// unfinished are abandoned; their sub-workflow nodes start new ones.
+func (h *WorkflowHandler) resume(ctx context.Context, executionID, workflowID uuid.UUID, version *int, nodes []store.NodeSnapshot, input map[string]any, paused bool) error {
+	pinned := 0
+	if version != nil {
+		pinned = *version
+	}
+	wf, err := h.GetWorkflow(ctx, workflowID, pinned)
+	if err != nil {
+		return err
+	}
+	dag, err := workflow.BuildDAG(ctx, h, wf)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.db.Pool().Exec(ctx, `
+		WITH abandoned AS (
+			UPDATE executions SET status = 'failed', finished_at = $2
+			WHERE parent_execution_id = $1 AND finished_at IS NULL
+			RETURNING id
+		)
+		UPDATE execution_approvals SET status = 'expired'
+		WHERE status = 'pending' AND execution_id IN (SELECT id FROM abandoned)
+	`, executionID, time.Now())
+	if err != nil {
+		return fmt.Errorf("abandon child executions: %w", err)
+	}
+
+	scheduler := h.newScheduler(dag, executionID)
+	scheduler.Restore(nodes)
+	if paused {
+		scheduler.Pause()
+	}
+	h.start(scheduler, wf, dag, executionID, input)
+	return nil
+}
+
+// validateWorkflow checks the graph structure, prompt template references
+// and sub-workflow inclusion before a workflow is saved
+func (h *WorkflowHandler) validateWorkflow(ctx context.Context, id uuid.UUID, nodes []store.NodeConfig, edges []store.EdgeConfig) error {
+	if err := workflow.RequireEdgeIDs(edges); err != nil {
+		return err
+	}
+	_, err := workflow.BuildDAG(ctx, h, &store.Workflow{ID: id, Nodes: nodes, Edges: edges})
+	return err
+}
+
+// saveVersion records a workflow's graph under its version number so
+// sub-workflow nodes can pin it
+func (h *WorkflowHandler) saveVersion(ctx context.Context, id uuid.UUID, version int, nodesJSON, edgesJSON []byte) error {
+	_, err := h.db.Pool().Exec(ctx, `
+		INSERT INTO workflow_versions (workflow_id, version, nodes, edges)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (workflow_id, version) DO UPDATE SET nodes = $3, edges = $4
+	`, id, version, nodesJSON, edgesJSON)
+	return err
+}
+
+// GetWorkflow loads a workflow at a version, or the latest when version is 0.
+// It implements workflow.WorkflowStore.
+func (h *WorkflowHandler) GetWorkflow(ctx context.Context, id uuid.UUID, version int) (*store.Workflow, error) {
+	wf := &store.Workflow{ID: id}
+	var nodesJSON, edgesJSON []byte
+	err := h.db.Pool().QueryRow(ctx, `
+		SELECT name, description, nodes, edges, version FROM workflows WHERE id = $1
+	`, id).Scan(&wf.Name, &wf.Description, &nodesJSON, &edgesJSON, &wf.Version)
+	if err != nil {
+		return nil, fmt.Errorf("workflow not found")
+	}
+
+	if version != 0 && version != wf.Version {
+		err = h.db.Pool().QueryRow(ctx, `
+			SELECT nodes, edges FROM workflow_versions WHERE workflow_id = $1 AND version = $2
+		`, id, version).Scan(&nodesJSON, &edgesJSON)
+		if err != nil {
+			return nil, fmt.Errorf("version %d not found", version)
+		}
+		wf.Version = version
+	}
+
+	if err := json.Unmarshal(nodesJSON, &wf.Nodes); err != nil {
+		return nil, fmt.Errorf("decode nodes: %w", err)
+	}
+	if err := json.Unmarshal(edgesJSON, &wf.Edges); err != nil {
+		return nil, fmt.Errorf("decode edges: %w", err)
+	}
+	return wf, nil
+}
+
+// StartChildExecution creates the execution row of a sub-workflow run,
+// linked to the parent execution. It implements workflow.ExecutionRecorder.
+func (h *WorkflowHandler) StartChildExecution(ctx context.Context, parentID uuid.UUID, nodeID string, workflowID uuid.UUID, input map[string]any) (uuid.UUID, error) {
+	inputJSON, _ := json.Marshal(input)
+	executionID := uuid.New()
+	_, err := h.db.Pool().Exec(ctx, `
+		INSERT INTO executions (id, workflow_id, status, snapshot, input_data, parent_execution_id, parent_node_id)
+		VALUES ($1, $2, 'running', '{}', $3, $4, $5)
+	`, executionID, workflowID, inputJSON, parentID, nodeID)
+	return executionID, err
+}
+
+// FinishChildExecution stores the outcome and snapshot of a sub-workflow run
+func (h *WorkflowHandler) FinishChildExecution(ctx context.Context, executionID uuid.UUID, sub *workflow.SubWorkflow, results map[string]*workflow.NodeResult, runErr error) error {
+	// Nothing more is journaled for a finished child
+	defer h.forgetJournal(executionID)
+	status := executionStatus(runErr)
+	snapshot := buildSnapshot(sub.WorkflowID, executionID, sub.DAG, results, sub.Workflow.Edges)
+	snapshotJSON, _ := json.Marshal(snapshot)
+	_, err := h.db.Pool().Exec(ctx, `
+		UPDATE executions
+		SET status = $1, snapshot = $2, finished_at = $3
+		WHERE id = $4
+	`, status, snapshotJSON, time.Now(), executionID)
+	if err != nil {
+		return err
+	}
+	h.expireApprovals(ctx, executionID)
+	return nil
+}
+
+// executionStatus maps the error returned by Scheduler.Run to the final
+// execution status
+func executionStatus(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, workflow.ErrCancelled):
+		return "cancelled"
+	default:
+		return "failed"
+	}
+}
+
+// expireApprovals closes the approval requests an execution left pending
+// when it finished, e.g. because it was cancelled while waiting
+func (h *WorkflowHandler) expireApprovals(ctx context.Context, executionID uuid.UUID) {
+	_, err := h.db.Pool().Exec(ctx, `
+		UPDATE execution_approvals SET status = 'expired'
+		WHERE execution_id = $1 AND status = 'pending'
+	`, executionID)
+	if err != nil {
+		log.Printf("[Workflow] Failed to expire approvals of execution %s: %v", executionID, err)
+	}
+}
+
+// RequestApproval stores a pending approval and the node results so far, and
+// marks the execution waiting_for_input. A request already pending for the
+// node, left over from before a restart, keeps its deadline.
+func (h *WorkflowHandler) RequestApproval(ctx context.Context, executionID uuid.UUID, req *workflow.ApprovalRequest, nodes []store.NodeSnapshot) error {
+	err := h.db.Pool().QueryRow(ctx, `
+		INSERT INTO execution_approvals (execution_id, node_id, pending_output, timeout_action, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (execution_id, node_id) DO UPDATE
+		SET pending_output = EXCLUDED.pending_output,
+		    timeout_action = EXCLUDED.timeout_action,
+		    expires_at = CASE WHEN execution_approvals.status = 'pending'
+		                      THEN execution_approvals.expires_at ELSE EXCLUDED.expires_at END,
+		    requested_at = CASE WHEN execution_approvals.status = 'pending'
+		                        THEN execution_approvals.requested_at ELSE NOW() END,
+		    status = 'pending', action = NULL, output = NULL, comment = NULL,
+		    timed_out = FALSE, decided_at = NULL
+		RETURNING expires_at
+	`, executionID, req.NodeID, req.Output, req.TimeoutAction, req.ExpiresAt).Scan(&req.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	nodesJSON, _ := json.Marshal(nodes)
+	_, err = h.db.Pool().Exec(ctx, `
+		UPDATE executions
+		SET status = 'waiting_for_input', snapshot = jsonb_set(snapshot, '{nodes}', $2)
+		WHERE id = $1
+	`, executionID, nodesJSON)
+	return err
+}
+
+// ResolveApproval records a decision and sets the execution back to running
+// once no other approval is pending
+func (h *WorkflowHandler) ResolveApproval(ctx context.Context, executionID uuid.UUID, nodeID string, decision workflow.ApprovalDecision) error {
+	_, err := h.db.Pool().Exec(ctx, `
+		UPDATE execution_approvals
+		SET status = 'decided', action = $3, output = $4, comment = $5, timed_out = $6, decided_at = NOW()
+		WHERE execution_id = $1 AND node_id = $2
+	`, executionID, nodeID, decision.Action, decision.Output, decision.Comment, decision.TimedOut)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.db.Pool().Exec(ctx, `
+		UPDATE executions SET status = 'running'
+		WHERE id = $1 AND status = 'waiting_for_input' AND NOT EXISTS (
+			SELECT 1 FROM execution_approvals WHERE execution_id = $1 AND status = 'pending'
+		)
+	`, executionID)
+	return err
+}
+
+// RecordNode checkpoints a finished node in the execution's log and streams
+// it as a node_result event, which carries the node's output for clients
+// catching up as well as live ones
+func (h *WorkflowHandler) RecordNode(ctx context.Context, executionID uuid.UUID, node store.NodeSnapshot) error {
+	sequence, err := h.appendLog(ctx, executionID, node.NodeID, "node_result", node)
+	if err != nil {
+		return err
+	}
+	if h.hub != nil {
+		h.hub.BroadcastEvent(executionID.String(), "node_result", sequence, node)
+	}
+	return nil
+}
+
+// appendLog adds an entry to an execution's log under the next sequence
+// number
+func (h *WorkflowHandler) appendLog(ctx context.Context, executionID uuid.UUID, nodeID, entryType string, content any) (int, error) {
+	contentJSON, err := json.Marshal(content)
+	if err != nil {
+		return 0, fmt.Errorf("encode log entry: %w", err)
+	}
+	load := func() (int, error) {
+		var last int
+		err := h.db.Pool().QueryRow(ctx, `
+			SELECT COALESCE(MAX(sequence), 0) FROM execution_logs WHERE execution_id = $1
+		`, executionID).Scan(&last)
+		if err != nil {
+			return 0, fmt.Errorf("load log sequence: %w", err)
+		}
+		return last, nil
+	}
+	insert := func(sequence int) error {
+		_, err := h.db.Pool().Exec(ctx, `
+			INSERT INTO execution_logs (execution_id, node_id, step_type, content, sequence)
+			VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+		`, executionID, nodeID, entryType, contentJSON, sequence)
+		return err
+	}
+	return h.journal(executionID).append(load, insert)
+}
+
+// journal returns the log state of an execution
+func (h *WorkflowHandler) journal(executionID uuid.UUID) *journal {
+	h.journalsMu.Lock()
+	defer h.journalsMu.Unlock()
+	j, ok := h.journals[executionID]
+	if !ok {
+		j = &journal{}
+		h.journals[executionID] = j
+	}
+	return j
+}
+
+// forgetJournal drops an execution's log state once nothing more is
+// journaled for it
+func (h *WorkflowHandler) forgetJournal(executionID uuid.UUID) {
+	h.journalsMu.Lock()
+	defer h.journalsMu.Unlock()
+	delete(h.journals, executionID)
+}
+
+// journal serializes the log writes of one execution, so entries commit in
+// sequence order and a reader never moves its cursor past an entry that is
+// still being written
+type journal struct {
+	mu     sync.Mutex
+	last   int
+	loaded bool
+}
+
+// append writes an entry under the next sequence number with insert. The
+// first entry, including one of an execution resumed after a restart,
+// continues after the last sequence reported by load. A failed insert does
+// not use up its number.
+func (j *journal) append(load func() (int, error), insert func(sequence int) error) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.loaded {
+		last, err := load()
+		if err != nil {
+			return 0, err
+		}
+		j.last = last
+		j.loaded = true
+	}
+	sequence := j.last + 1
+	if err := insert(sequence); err != nil {
+		return 0, err
+	}
+	j.last = sequence
+	return sequence, nil
+}
+
+// RecordState stores the pause state of an execution and its node results
+// so far. A running execution with pending approvals stays waiting_for_input.
+func (h *WorkflowHandler) RecordState(ctx context.Context, executionID uuid.UUID, state string, nodes []store.NodeSnapshot) error {
+	nodesJSON, _ := json.Marshal(nodes)
+	_, err := h.db.Pool().Exec(ctx, `
+		UPDATE executions
+		SET status = CASE
+		        WHEN $2 = 'running' AND EXISTS (
+		            SELECT 1 FROM execution_approvals WHERE execution_id = $1 AND status = 'pending'
+		        ) THEN 'waiting_for_input'
+		        ELSE $2 END,
+		    snapshot = jsonb_set(snapshot, '{nodes}', $3)
+		WHERE id = $1 AND finished_at IS NULL
+	`, executionID, state, nodesJSON)
+	return err
+}
+
+func buildSnapshot(workflowID, executionID uuid.UUID, dag *workflow.DAG, results map[string]*workflow.NodeResult, edges []store.EdgeConfig) store.Snapshot {
+	nodeSnapshots := workflow.NodeSnapshots(dag, results)
 	totalTokens := 0
 	var totalDuration int64 = 0
 
-	for nodeID, result := range results {
-		nodeSnapshots = append(nodeSnapshots, store.NodeSnapshot{
-			NodeID:      uuid.MustParse(nodeID),
-			AgentName:   nodeID, // TODO: get actual agent name
-			Steps:       result.Steps,
-			FinalOutput: result.Output,
-		})
+	// Frozen nodes were carried over from the replayed execution, which
+	// already spent their tokens
+	for _, result := range results {
+		if result.Frozen {
+			continue
+		}
 		for _, step := range result.Steps {
 			totalTokens += step.Tokens
 			totalDuration += step.LatencyMs
@@ -353,7 +901,7 @@ func buildSnapshot(workflowID, executionID uuid.UUID, results map[string]*workfl
 		Edges:       edges,
 		ExecutionMeta: store.MetaInfo{
 			TotalTokens: totalTokens,
-			TotalCost:   float64(totalTokens) * 0.00001, // Rough estimate
+			TotalCost:   float64(totalTokens) * workflow.EstimatedCostPerToken,
 			DurationMs:  totalDuration,
 		},
 	}
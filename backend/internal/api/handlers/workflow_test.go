@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJournalAppendsInOrder(t *testing.T) {
+	j := &journal{}
+	loads := 0
+	load := func() (int, error) {
+		loads++
+		return 7, nil
+	}
+	// insert runs while the journal is held, so it sees entries in the
+	// order they commit
+	var committed []int
+	insert := func(sequence int) error {
+		time.Sleep(time.Duration(sequence%3) * time.Millisecond)
+		committed = append(committed, sequence)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := j.append(load, insert); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if loads != 1 {
+		t.Errorf("loaded the last sequence %d times, want once", loads)
+	}
+	if len(committed) != 30 {
+		t.Fatalf("committed %d entries, want 30", len(committed))
+	}
+	for i, sequence := range committed {
+		if sequence != 8+i {
+			t.Fatalf("entry %d committed as %d; want sequences from 8 in commit order: %v", i, sequence, committed)
+		}
+	}
+}
+
+func TestJournalFailures(t *testing.T) {
+	j := &journal{}
+	if _, err := j.append(func() (int, error) { return 0, errors.New("db down") }, nil); err == nil {
+		t.Fatal("append succeeded without the last sequence")
+	}
+
+	load := func() (int, error) { return 0, nil }
+	if _, err := j.append(load, func(int) error { return errors.New("insert failed") }); err == nil {
+		t.Fatal("append succeeded with a failed insert")
+	}
+	sequence, err := j.append(load, func(int) error { return nil })
+	if err != nil || sequence != 1 {
+		t.Errorf("append = %d, %v; want 1, since the failed insert does not use up its number", sequence, err)
+	}
+}
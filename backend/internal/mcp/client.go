@@ -0,0 +1,124 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ProtocolVersion is the MCP revision this client speaks
+const ProtocolVersion = "2025-03-26"
+
+// Client is a Model Context Protocol client bound to one server
+type Client struct {
+	name      string
+	transport Transport
+}
+
+// ToolInfo describes a tool exposed by an MCP server
+type ToolInfo struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// CallResult is the result of an MCP tools/call request
+type CallResult struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text,omitempty"`
+	} `json:"content"`
+	IsError bool `json:"isError"`
+}
+
+// Text concatenates the textual content of the result
+func (r *CallResult) Text() string {
+	parts := make([]string, 0, len(r.Content))
+	for _, c := range r.Content {
+		if c.Type == "text" {
+			parts = append(parts, c.Text)
+		} else {
+			parts = append(parts, fmt.Sprintf("[%s content]", c.Type))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// NewClient creates a client over the given transport
+func NewClient(name string, transport Transport) *Client {
+	return &Client{name: name, transport: transport}
+}
+
+// Name returns the configured server name
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Initialize performs the MCP handshake
+func (c *Client) Initialize(ctx context.Context) error {
+	params := map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo": map[string]any{
+			"name":    "agentforge",
+			"version": "1.0.0",
+		},
+	}
+	if _, err := c.transport.Call(ctx, "initialize", params); err != nil {
+		return fmt.Errorf("initialize %s: %w", c.name, err)
+	}
+	if err := c.transport.Notify(ctx, "notifications/initialized", nil); err != nil {
+		return fmt.Errorf("initialized notification %s: %w", c.name, err)
+	}
+	return nil
+}
+
+// ListTools returns every tool the server exposes, following pagination
+func (c *Client) ListTools(ctx context.Context) ([]ToolInfo, error) {
+	var all []ToolInfo
+	cursor := ""
+	for {
+		var params map[string]any
+		if cursor != "" {
+			params = map[string]any{"cursor": cursor}
+		}
+		raw, err := c.transport.Call(ctx, "tools/list", params)
+		if err != nil {
+			return nil, fmt.Errorf("list tools %s: %w", c.name, err)
+		}
+		var page struct {
+			Tools      []ToolInfo `json:"tools"`
+			NextCursor string     `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return nil, fmt.Errorf("decode tools/list: %w", err)
+		}
+		all = append(all, page.Tools...)
+		if page.NextCursor == "" {
+			return all, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CallTool invokes a tool on the server
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]any) (*CallResult, error) {
+	raw, err := c.transport.Call(ctx, "tools/call", map[string]any{
+		"name":      name,
+		"arguments": args,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("call %s/%s: %w", c.name, name, err)
+	}
+	var result CallResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("decode tools/call: %w", err)
+	}
+	return &result, nil
+}
+
+// Close shuts down the transport
+func (c *Client) Close() error {
+	return c.transport.Close()
+}
@@ -0,0 +1,185 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
+	"github.com/Wangren-Academy/Agent/backend/internal/tools"
+)
+
+// TestMain turns the test binary into a fake MCP server when it is started
+// by startFakeServer
+func TestMain(m *testing.M) {
+	if os.Getenv("MCP_FAKE_SERVER") == "1" {
+		serveFake()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// serveFake answers MCP requests on stdin/stdout. It exposes "echo", a tool
+// failing with an error result, a tool whose name is too long to register
+// and a second page of tools/list.
+func serveFake() {
+	out := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(os.Stdin)
+	initialized := false
+	for scanner.Scan() {
+		var req struct {
+			ID     *int64         `json:"id"`
+			Method string         `json:"method"`
+			Params map[string]any `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			continue
+		}
+		if req.ID == nil {
+			if req.Method == "notifications/initialized" {
+				initialized = true
+			}
+			continue
+		}
+
+		// Interleave a server notification, which the client must ignore
+		out.Encode(map[string]any{"jsonrpc": "2.0", "method": "notifications/message", "params": map[string]any{}})
+
+		var result any
+		var rpcErr *rpcError
+		switch req.Method {
+		case "initialize":
+			result = map[string]any{
+				"protocolVersion": req.Params["protocolVersion"],
+				"capabilities":    map[string]any{"tools": map[string]any{}},
+				"serverInfo":      map[string]any{"name": "fake", "version": "0"},
+			}
+		case "tools/list":
+			if !initialized {
+				rpcErr = &rpcError{Code: -32002, Message: "not initialized"}
+				break
+			}
+			if req.Params["cursor"] == "page2" {
+				result = map[string]any{"tools": []map[string]any{
+					{"name": "fail", "description": "Always fails"},
+					{"name": strings.Repeat("x", 70)},
+				}}
+				break
+			}
+			result = map[string]any{
+				"tools": []map[string]any{{
+					"name":        "echo",
+					"description": "Echoes text",
+					"inputSchema": map[string]any{"type": "object", "properties": map[string]any{"text": map[string]any{"type": "string"}}},
+				}},
+				"nextCursor": "page2",
+			}
+		case "tools/call":
+			args, _ := req.Params["arguments"].(map[string]any)
+			switch req.Params["name"] {
+			case "echo":
+				result = map[string]any{"content": []map[string]any{{"type": "text", "text": fmt.Sprint(args["text"])}}}
+			case "fail":
+				result = map[string]any{"content": []map[string]any{{"type": "text", "text": "boom"}}, "isError": true}
+			default:
+				rpcErr = &rpcError{Code: -32602, Message: "unknown tool"}
+			}
+		default:
+			rpcErr = &rpcError{Code: -32601, Message: "method not found"}
+		}
+
+		resp := map[string]any{"jsonrpc": "2.0", "id": *req.ID}
+		if rpcErr != nil {
+			resp["error"] = rpcErr
+		} else {
+			resp["result"] = result
+		}
+		out.Encode(resp)
+	}
+}
+
+func startFakeServer(t *testing.T) *Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := Connect(ctx, ServerConfig{
+		Name:    "fake",
+		Command: os.Args[0],
+		Env:     map[string]string{"MCP_FAKE_SERVER": "1"},
+	})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestStdioRoundTrip(t *testing.T) {
+	client := startFakeServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	infos, err := client.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	if len(infos) != 3 || infos[0].Name != "echo" || infos[1].Name != "fail" {
+		t.Fatalf("tools = %+v", infos)
+	}
+
+	result, err := client.CallTool(ctx, "echo", map[string]any{"text": "hi"})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if result.IsError || result.Text() != "hi" {
+		t.Errorf("echo result = %+v", result)
+	}
+
+	result, err = client.CallTool(ctx, "fail", nil)
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if !result.IsError || result.Text() != "boom" {
+		t.Errorf("fail result = %+v", result)
+	}
+
+	_, err = client.CallTool(ctx, "missing", nil)
+	if err == nil || !strings.Contains(err.Error(), "unknown tool") {
+		t.Errorf("missing tool err = %v", err)
+	}
+}
+
+func TestRegisterTools(t *testing.T) {
+	client := startFakeServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	registry := tools.NewRegistry()
+	names, err := RegisterTools(ctx, registry, client)
+	if err != nil {
+		t.Fatalf("RegisterTools: %v", err)
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, ","); got != "fake__echo,fake__fail" {
+		t.Fatalf("registered %s; the overlong name should be skipped", got)
+	}
+
+	out, err := registry.Invoke(ctx, agent.ToolCall{Function: agent.FunctionCall{
+		Name:      "fake__echo",
+		Arguments: map[string]any{"text": "hello"},
+	}})
+	if err != nil || out != "hello" {
+		t.Errorf("echo = %q, %v", out, err)
+	}
+
+	_, err = registry.Invoke(ctx, agent.ToolCall{Function: agent.FunctionCall{Name: "fake__fail"}})
+	if err == nil || err.Error() != "boom" {
+		t.Errorf("error result surfaced as %v, want boom", err)
+	}
+}
@@ -0,0 +1,125 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
+	"github.com/Wangren-Academy/Agent/backend/internal/tools"
+)
+
+// ServerConfig describes how to reach one MCP server. Either Command (stdio)
+// or URL (streamable HTTP) must be set.
+type ServerConfig struct {
+	Name    string            `json:"name"`
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Config is the MCP servers configuration file
+type Config struct {
+	Servers []ServerConfig `json:"servers"`
+}
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// validToolName is the function name format model providers accept
+var validToolName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// LoadConfig reads an MCP servers configuration file
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read mcp config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("parse mcp config: %w", err)
+	}
+	for _, s := range cfg.Servers {
+		if !validName.MatchString(s.Name) {
+			return nil, fmt.Errorf("invalid mcp server name: %q", s.Name)
+		}
+		if (s.Command == "") == (s.URL == "") {
+			return nil, fmt.Errorf("mcp server %s: exactly one of command or url is required", s.Name)
+		}
+	}
+	return &cfg, nil
+}
+
+// Connect starts or dials the server and performs the handshake
+func Connect(ctx context.Context, cfg ServerConfig) (*Client, error) {
+	var transport Transport
+	if cfg.Command != "" {
+		t, err := NewStdioTransport(cfg.Command, cfg.Args, cfg.Env)
+		if err != nil {
+			return nil, err
+		}
+		transport = t
+	} else {
+		transport = NewHTTPTransport(cfg.URL, cfg.Headers)
+	}
+
+	client := NewClient(cfg.Name, transport)
+	if err := client.Initialize(ctx); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// ToolName returns the registry name of a server's tool. Tools are
+// namespaced as "<server>__<tool>" so different servers cannot collide.
+func ToolName(server, tool string) string {
+	return server + "__" + tool
+}
+
+// RegisterTools discovers the server's tools and registers proxies for them.
+// Tools whose namespaced name model providers would reject are skipped.
+func RegisterTools(ctx context.Context, registry *tools.Registry, client *Client) ([]string, error) {
+	infos, err := client.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		toolName := info.Name
+		name := ToolName(client.Name(), toolName)
+		if !validToolName.MatchString(name) {
+			log.Printf("[MCP] Skipping tool %q of %s: %q is not a valid tool name", toolName, client.Name(), name)
+			continue
+		}
+		schema := info.InputSchema
+		if schema == nil {
+			schema = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+
+		registry.Register(&tools.Tool{
+			Definition: agent.FunctionDef{
+				Name:        name,
+				Description: info.Description,
+				Parameters:  schema,
+			},
+			Handler: func(ctx context.Context, args map[string]any) (string, error) {
+				result, err := client.CallTool(ctx, toolName, args)
+				if err != nil {
+					return "", err
+				}
+				if result.IsError {
+					return "", fmt.Errorf("%s", result.Text())
+				}
+				return result.Text(), nil
+			},
+		})
+		names = append(names, name)
+	}
+	return names, nil
+}
@@ -0,0 +1,332 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Transport carries JSON-RPC messages to an MCP server
+type Transport interface {
+	// Call sends a request and waits for its result
+	Call(ctx context.Context, method string, params any) (json.RawMessage, error)
+	// Notify sends a notification that expects no response
+	Notify(ctx context.Context, method string, params any) error
+	Close() error
+}
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      *int64 `json:"id,omitempty"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id"`
+	Method  string          `json:"method,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+// StdioTransport talks to an MCP server subprocess over stdin/stdout using
+// newline-delimited JSON-RPC messages
+type StdioTransport struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	nextID atomic.Int64
+
+	pending map[int64]chan rpcResponse
+	mu      sync.Mutex
+	writeMu sync.Mutex
+	closed  chan struct{}
+	err     error
+}
+
+// NewStdioTransport starts the server process and begins reading its output
+func NewStdioTransport(command string, args []string, env map[string]string) (*StdioTransport, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdout pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", command, err)
+	}
+
+	t := &StdioTransport{
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[int64]chan rpcResponse),
+		closed:  make(chan struct{}),
+	}
+	go t.readLoop(stdout)
+	return t, nil
+}
+
+func (t *StdioTransport) readLoop(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var resp rpcResponse
+		if err := json.Unmarshal(line, &resp); err != nil {
+			log.Printf("[MCP] Ignoring invalid message: %v", err)
+			continue
+		}
+		// Server-initiated requests and notifications are not supported
+		if resp.ID == nil || resp.Method != "" {
+			continue
+		}
+		t.mu.Lock()
+		ch, ok := t.pending[*resp.ID]
+		delete(t.pending, *resp.ID)
+		t.mu.Unlock()
+		if ok {
+			ch <- resp
+		}
+	}
+
+	t.mu.Lock()
+	t.err = fmt.Errorf("mcp server exited")
+	if err := scanner.Err(); err != nil {
+		t.err = fmt.Errorf("mcp server read error: %w", err)
+	}
+	t.mu.Unlock()
+	close(t.closed)
+}
+
+func (t *StdioTransport) write(msg rpcRequest) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.stdin.Write(append(b, '\n'))
+	return err
+}
+
+// Call sends a request and waits for its result
+func (t *StdioTransport) Call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	id := t.nextID.Add(1)
+	ch := make(chan rpcResponse, 1)
+
+	t.mu.Lock()
+	t.pending[id] = ch
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+	}()
+
+	if err := t.write(rpcRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: params}); err != nil {
+		return nil, fmt.Errorf("write request: %w", err)
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		return resp.Result, nil
+	case <-t.closed:
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		return nil, t.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Notify sends a notification that expects no response
+func (t *StdioTransport) Notify(ctx context.Context, method string, params any) error {
+	return t.write(rpcRequest{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// Close stops the server process
+func (t *StdioTransport) Close() error {
+	t.stdin.Close()
+	done := make(chan error, 1)
+	go func() { done <- t.cmd.Wait() }()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.cmd.Process.Kill()
+		<-done
+	}
+	return nil
+}
+
+// HTTPTransport talks to an MCP server over the streamable HTTP transport.
+// Each request is POSTed to the endpoint; the reply may be plain JSON or an
+// SSE stream carrying the response.
+type HTTPTransport struct {
+	url        string
+	headers    map[string]string
+	httpClient *http.Client
+	nextID     atomic.Int64
+
+	sessionID string
+	mu        sync.Mutex
+}
+
+// NewHTTPTransport creates a transport for the given MCP endpoint
+func NewHTTPTransport(url string, headers map[string]string) *HTTPTransport {
+	return &HTTPTransport{
+		url:        url,
+		headers:    headers,
+		httpClient: &http.Client{Timeout: 120 * time.Second},
+	}
+}
+
+func (t *HTTPTransport) post(ctx context.Context, msg rpcRequest) (*http.Response, error) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", t.url, bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	t.mu.Unlock()
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("mcp http error: %w", err)
+	}
+	if sid := resp.Header.Get("Mcp-Session-Id"); sid != "" {
+		t.mu.Lock()
+		t.sessionID = sid
+		t.mu.Unlock()
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("mcp server returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+	return resp, nil
+}
+
+// Call sends a request and waits for its result
+func (t *HTTPTransport) Call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	id := t.nextID.Add(1)
+	resp, err := t.post(ctx, rpcRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result rpcResponse
+	found := false
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() && !found {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			var msg rpcResponse
+			if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &msg); err != nil {
+				continue
+			}
+			if msg.ID != nil && *msg.ID == id && msg.Method == "" {
+				result, found = msg, true
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("read stream: %w", err)
+		}
+	} else {
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+		found = true
+	}
+
+	if !found {
+		return nil, fmt.Errorf("mcp server closed stream without a response")
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return result.Result, nil
+}
+
+// Notify sends a notification that expects no response
+func (t *HTTPTransport) Notify(ctx context.Context, method string, params any) error {
+	resp, err := t.post(ctx, rpcRequest{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Close ends the HTTP session
+func (t *HTTPTransport) Close() error {
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+	if sessionID == "" {
+		return nil
+	}
+
+	req, err := http.NewRequest("DELETE", t.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Mcp-Session-Id", sessionID)
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -42,9 +42,30 @@ type Position struct {
 }
 
 type EdgeConfig struct {
-	ID     string `json:"id"`
-	Source string `json:"source"`
-	Target string `json:"target"`
+	ID        string         `json:"id"`
+	Source    string         `json:"source"`
+	Target    string         `json:"target"`
+	Label     string         `json:"label,omitempty"`
+	Condition *EdgeCondition `json:"condition,omitempty"`
+	Loop      *EdgeLoop      `json:"loop,omitempty"`
+}
+
+// EdgeLoop marks an edge as a loop back-edge from its source (typically a
+// critic) to an upstream node. The loop body runs again until Exit matches
+// the source's output or MaxIterations is reached.
+type EdgeLoop struct {
+	MaxIterations int            `json:"max_iterations"`
+	Exit          *EdgeCondition `json:"exit,omitempty"`
+}
+
+// EdgeCondition gates an edge on the output of its source node
+type EdgeCondition struct {
+	Type          string `json:"type"` // contains, regex, json or label
+	Value         string `json:"value,omitempty"`
+	Path          string `json:"path,omitempty"`     // json: field path inside the output
+	Operator      string `json:"operator,omitempty"` // json: eq, ne, gt, gte, lt, lte, contains, exists
+	CaseSensitive bool   `json:"case_sensitive,omitempty"`
+	Negate        bool   `json:"negate,omitempty"`
 }
 
 type WorkflowNode struct {
@@ -58,19 +79,24 @@ type WorkflowNode struct {
 }
 
 type Execution struct {
-	ID         uuid.UUID      `json:"id"`
-	WorkflowID uuid.UUID      `json:"workflow_id"`
-	Status     string         `json:"status"`
-	Snapshot   map[string]any `json:"snapshot"`
-	StartedAt  time.Time      `json:"started_at"`
-	FinishedAt *time.Time     `json:"finished_at,omitempty"`
-	CreatedAt  time.Time      `json:"created_at"`
+	ID                uuid.UUID      `json:"id"`
+	WorkflowID        uuid.UUID      `json:"workflow_id"`
+	Status            string         `json:"status"`
+	Snapshot          map[string]any `json:"snapshot"`
+	InputData         map[string]any `json:"input_data,omitempty"`
+	ParentExecutionID *uuid.UUID     `json:"parent_execution_id,omitempty"`
+	ParentNodeID      string         `json:"parent_node_id,omitempty"`
+	WorkflowVersion   *int           `json:"workflow_version,omitempty"`
+	ReplayOf          *uuid.UUID     `json:"replay_of,omitempty"`
+	StartedAt         time.Time      `json:"started_at"`
+	FinishedAt        *time.Time     `json:"finished_at,omitempty"`
+	CreatedAt         time.Time      `json:"created_at"`
 }
 
 type ExecutionLog struct {
 	ID          uuid.UUID      `json:"id"`
 	ExecutionID uuid.UUID      `json:"execution_id"`
-	NodeID      *uuid.UUID     `json:"node_id,omitempty"`
+	NodeID      *string        `json:"node_id,omitempty"`
 	StepType    string         `json:"step_type"`
 	Content     map[string]any `json:"content"`
 	Sequence    int            `json:"sequence"`
@@ -86,10 +112,17 @@ type Snapshot struct {
 }
 
 type NodeSnapshot struct {
-	NodeID      uuid.UUID `json:"node_id"`
-	AgentName   string    `json:"agent_name"`
-	Steps       []Step    `json:"steps"`
-	FinalOutput string    `json:"final_output"`
+	NodeID           string `json:"node_id"`
+	AgentName        string `json:"agent_name"`
+	Status           string `json:"status,omitempty"`
+	Edited           bool   `json:"edited,omitempty"`
+	Frozen           bool   `json:"frozen,omitempty"`
+	Error            string `json:"error,omitempty"`
+	Route            string `json:"route,omitempty"`
+	ChildExecutionID string `json:"child_execution_id,omitempty"`
+	Iteration        int    `json:"iteration,omitempty"`
+	Steps            []Step `json:"steps"`
+	FinalOutput      string `json:"final_output"`
 }
 
 type Step struct {
@@ -104,6 +137,9 @@ type Step struct {
 	Tool      string         `json:"tool,omitempty"`
 	Arguments map[string]any `json:"arguments,omitempty"`
 	Result    string         `json:"result,omitempty"`
+	Item      *int           `json:"item,omitempty"`
+	Iteration int            `json:"iteration,omitempty"`
+	SubNodeID string         `json:"sub_node_id,omitempty"`
 }
 
 type MetaInfo struct {
@@ -0,0 +1,55 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
+)
+
+// BuiltinOptions configures the built-in tools
+type BuiltinOptions struct {
+	// HTTPAllowlist lists the hosts http_fetch may reach
+	HTTPAllowlist []string
+}
+
+// RegisterBuiltins adds the built-in tools to the registry
+func RegisterBuiltins(r *Registry, opts BuiltinOptions) {
+	r.Register(NewHTTPFetchTool(opts.HTTPAllowlist))
+	r.Register(NewJSONPathTool())
+	r.Register(NewCalculatorTool())
+	r.Register(NewCurrentTimeTool())
+	r.Register(NewScratchpadTool())
+}
+
+// NewCurrentTimeTool creates the current_time tool
+func NewCurrentTimeTool() *Tool {
+	return &Tool{
+		Definition: agent.FunctionDef{
+			Name:        "current_time",
+			Description: "Return the current date and time in RFC 3339 format.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"timezone": map[string]any{
+						"type":        "string",
+						"description": "IANA time zone name, e.g. Asia/Shanghai. Defaults to UTC.",
+					},
+				},
+			},
+		},
+		Timeout: time.Second,
+		Handler: func(ctx context.Context, args map[string]any) (string, error) {
+			loc := time.UTC
+			if tz, ok := args["timezone"].(string); ok && tz != "" {
+				l, err := time.LoadLocation(tz)
+				if err != nil {
+					return "", fmt.Errorf("unknown timezone: %s", tz)
+				}
+				loc = l
+			}
+			return time.Now().In(loc).Format(time.RFC3339), nil
+		},
+	}
+}
@@ -0,0 +1,61 @@
+package tools
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		expr string
+		want float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"2 ^ 3 ^ 2", 512},
+		{"-2 ^ 2", -4},
+		{"10 % 4", 2},
+		{"1.5e2 + 1e-1", 150.1},
+		{"sqrt(16) + abs(-3)", 7},
+		{"max(1, 5, 3) - min(4, 2)", 3},
+		{"pow(2, 10)", 1024},
+		{"round(pi * 100)", 314},
+	}
+	for _, tt := range tests {
+		got, err := Calculate(tt.expr)
+		if err != nil || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Calculate(%q) = %v, %v; want %v", tt.expr, got, err, tt.want)
+		}
+	}
+}
+
+func TestCalculateErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"", "unexpected end of expression"},
+		{"1 +", "unexpected end of expression"},
+		{"(1 + 2", "missing closing parenthesis"},
+		{"1 + 2)", `unexpected ')' at position 5`},
+		{"2 $ 3", `unexpected '$' at position 2`},
+		{"1 / 0", "division by zero"},
+		{"5 % 0", "division by zero"},
+		{"foo", "unknown identifier: foo"},
+		{"foo(1)", "unknown function: foo"},
+		{"sqrt(1, 2)", "sqrt expects 1 argument"},
+		{"pow(2)", "pow expects 2 arguments"},
+		{"max()", "max expects at least 1 argument"},
+		{"max(1, 2", "missing closing parenthesis for max"},
+		{"1.2.3", "invalid syntax"},
+		{"sqrt(-1)", "not a finite number"},
+		{"10 ^ 400", "not a finite number"},
+	}
+	for _, tt := range tests {
+		_, err := Calculate(tt.expr)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Calculate(%q) error = %v, want %q", tt.expr, err, tt.err)
+		}
+	}
+}
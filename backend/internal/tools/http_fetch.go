@@ -0,0 +1,148 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
+)
+
+// maxFetchBytes caps how much of a response body is returned to the model
+const maxFetchBytes = 64 * 1024
+
+// HostAllowed reports whether host matches the allowlist. An entry of the
+// form "*.example.com" also matches subdomains.
+func HostAllowed(allowlist []string, host string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range allowlist {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if strings.HasPrefix(entry, "*.") {
+			if host == entry[2:] || strings.HasSuffix(host, entry[1:]) {
+				return true
+			}
+		} else if host == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// allowlistTransport refuses requests, including redirects, to hosts
+// outside the allowlist
+type allowlistTransport struct {
+	allowlist []string
+	base      http.RoundTripper
+}
+
+func (t *allowlistTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !HostAllowed(t.allowlist, req.URL.Hostname()) {
+		return nil, fmt.Errorf("host not in allowlist: %s", req.URL.Hostname())
+	}
+	return t.base.RoundTrip(req)
+}
+
+// NewAllowlistClient returns an HTTP client that can only reach allowlisted
+// hosts and follows at most five redirects
+func NewAllowlistClient(allowlist []string) *http.Client {
+	return &http.Client{
+		Transport: &allowlistTransport{allowlist: allowlist, base: http.DefaultTransport},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return fmt.Errorf("too many redirects")
+			}
+			return nil
+		},
+	}
+}
+
+// NewHTTPFetchTool creates the http_fetch tool. Only hosts in the allowlist
+// may be fetched. An empty allowlist denies every request.
+func NewHTTPFetchTool(allowlist []string) *Tool {
+	client := NewAllowlistClient(allowlist)
+
+	return &Tool{
+		Definition: agent.FunctionDef{
+			Name:        "http_fetch",
+			Description: "Fetch a URL over HTTP(S) and return the response body. Only allowlisted hosts can be reached.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"url": map[string]any{
+						"type":        "string",
+						"description": "Absolute http or https URL",
+					},
+					"method": map[string]any{
+						"type": "string",
+						"enum": []string{"GET", "POST"},
+					},
+					"body": map[string]any{
+						"type":        "string",
+						"description": "Request body for POST requests",
+					},
+				},
+				"required": []string{"url"},
+			},
+		},
+		Timeout: 20 * time.Second,
+		Handler: func(ctx context.Context, args map[string]any) (string, error) {
+			rawURL, err := stringArg(args, "url")
+			if err != nil {
+				return "", err
+			}
+			u, err := url.Parse(rawURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return "", fmt.Errorf("invalid url: %s", rawURL)
+			}
+			if !HostAllowed(allowlist, u.Hostname()) {
+				return "", fmt.Errorf("host not in allowlist: %s", u.Hostname())
+			}
+
+			method := "GET"
+			if m, ok := args["method"].(string); ok && m != "" {
+				method = strings.ToUpper(m)
+			}
+			if method != "GET" && method != "POST" {
+				return "", fmt.Errorf("unsupported method: %s", method)
+			}
+
+			var body io.Reader
+			if b, ok := args["body"].(string); ok && method == "POST" {
+				body = strings.NewReader(b)
+			}
+
+			req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+			if err != nil {
+				return "", fmt.Errorf("create request: %w", err)
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				return "", fmt.Errorf("fetch %s: %w", u.Host, err)
+			}
+			defer resp.Body.Close()
+
+			data, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchBytes+1))
+			if err != nil {
+				return "", fmt.Errorf("read response: %w", err)
+			}
+			truncated := len(data) > maxFetchBytes
+			if truncated {
+				data = data[:maxFetchBytes]
+			}
+
+			out := fmt.Sprintf("HTTP %d\n\n%s", resp.StatusCode, data)
+			if truncated {
+				out += "\n\n[truncated]"
+			}
+			return out, nil
+		},
+	}
+}
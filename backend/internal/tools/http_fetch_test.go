@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHostAllowed(t *testing.T) {
+	allowlist := []string{"api.example.com", " *.Trusted.org ", ""}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"api.example.com", true},
+		{"API.Example.com", true},
+		{"example.com", false},
+		{"evil.api.example.com", false},
+		{"api.example.com.evil.net", false},
+		{"trusted.org", true},
+		{"docs.trusted.org", true},
+		{"a.b.trusted.org", true},
+		{"untrusted.org", false},
+		{"trusted.org.evil.net", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := HostAllowed(allowlist, tt.host); got != tt.want {
+			t.Errorf("HostAllowed(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+	if HostAllowed(nil, "api.example.com") {
+		t.Error("an empty allowlist allowed a host")
+	}
+}
+
+func TestAllowlistClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			// Same server, but under a host name that is not allowlisted
+			http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	client := NewAllowlistClient([]string{"127.0.0.1"})
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("allowlisted host: %v", err)
+	}
+	resp.Body.Close()
+
+	// Redirects are checked as well
+	to := "http://localhost:" + u.Port() + "/"
+	_, err = client.Get(server.URL + "/redirect?to=" + url.QueryEscape(to))
+	if err == nil || !strings.Contains(err.Error(), "host not in allowlist: localhost") {
+		t.Errorf("redirect to another host: err = %v", err)
+	}
+
+	_, err = NewAllowlistClient(nil).Get(server.URL)
+	if err == nil || !strings.Contains(err.Error(), "host not in allowlist") {
+		t.Errorf("empty allowlist: err = %v", err)
+	}
+}
+
+func TestHTTPFetchTool(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Repeat("x", maxFetchBytes+10))
+	}))
+	defer server.Close()
+	tool := NewHTTPFetchTool([]string{"127.0.0.1"})
+
+	out, err := tool.Handler(context.Background(), map[string]any{"url": server.URL})
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if !strings.HasPrefix(out, "HTTP 200\n\n") || !strings.HasSuffix(out, "\n\n[truncated]") {
+		t.Errorf("output is not a truncated 200 response: %.40q...", out)
+	}
+
+	for _, args := range []map[string]any{
+		{"url": "http://localhost/"},
+		{"url": "file:///etc/passwd"},
+		{"url": server.URL, "method": "DELETE"},
+		{},
+	} {
+		if _, err := tool.Handler(context.Background(), args); err == nil {
+			t.Errorf("fetch %v succeeded", args)
+		}
+	}
+}
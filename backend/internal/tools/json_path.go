@@ -0,0 +1,127 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
+)
+
+// NewJSONPathTool creates the json_path tool
+func NewJSONPathTool() *Tool {
+	return &Tool{
+		Definition: agent.FunctionDef{
+			Name:        "json_path",
+			Description: "Extract a value from a JSON document using a path such as $.items[0].name.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"json": map[string]any{
+						"type":        "string",
+						"description": "JSON document",
+					},
+					"path": map[string]any{
+						"type":        "string",
+						"description": "Dot/bracket path, e.g. $.data.items[2].id",
+					},
+				},
+				"required": []string{"json", "path"},
+			},
+		},
+		Handler: func(ctx context.Context, args map[string]any) (string, error) {
+			doc, err := stringArg(args, "json")
+			if err != nil {
+				return "", err
+			}
+			path, _ := args["path"].(string)
+
+			var value any
+			if err := json.Unmarshal([]byte(doc), &value); err != nil {
+				return "", fmt.Errorf("invalid json: %w", err)
+			}
+
+			result, err := ExtractPath(value, path)
+			if err != nil {
+				return "", err
+			}
+			if s, ok := result.(string); ok {
+				return s, nil
+			}
+			b, _ := json.Marshal(result)
+			return string(b), nil
+		},
+	}
+}
+
+// ExtractPath walks a decoded JSON value along a dot/bracket path.
+// A leading "$" is optional; "a.b[0]", "a.b.0" and `a["b"][0]` are equivalent.
+func ExtractPath(value any, path string) (any, error) {
+	segments, err := splitPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	current := value
+	for _, seg := range segments {
+		switch v := current.(type) {
+		case map[string]any:
+			next, ok := v[seg]
+			if !ok {
+				return nil, fmt.Errorf("path %q: key %q not found", path, seg)
+			}
+			current = next
+		case []any:
+			idx, err := strconv.Atoi(seg)
+			if err != nil {
+				return nil, fmt.Errorf("path %q: %q is not an array index", path, seg)
+			}
+			if idx < 0 {
+				idx += len(v)
+			}
+			if idx < 0 || idx >= len(v) {
+				return nil, fmt.Errorf("path %q: index %s out of range", path, seg)
+			}
+			current = v[idx]
+		default:
+			return nil, fmt.Errorf("path %q: cannot descend into %q", path, seg)
+		}
+	}
+	return current, nil
+}
+
+func splitPath(path string) ([]string, error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+
+	var segments []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			segments = append(segments, cur.String())
+			cur.Reset()
+		}
+	}
+
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; c {
+		case '.':
+			flush()
+		case '[':
+			flush()
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("path %q: unterminated '['", path)
+			}
+			inner := strings.Trim(path[i+1:i+end], `"'`)
+			segments = append(segments, inner)
+			i += end
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+	return segments, nil
+}
@@ -0,0 +1,53 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestJSONPathTool(t *testing.T) {
+	doc := `{"data": {"items": [{"id": 1, "name": "a"}, {"id": 2, "name": "b"}], "a.b": true}}`
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"$.data.items[0].name", "a"},
+		{"data.items.1.id", "2"},
+		{`$["data"]['items'][-1]`, `{"id":2,"name":"b"}`},
+		{`data["a.b"]`, "true"},
+		{"$", `{"data":{"a.b":true,"items":[{"id":1,"name":"a"},{"id":2,"name":"b"}]}}`},
+	}
+	tool := NewJSONPathTool()
+	for _, tt := range tests {
+		out, err := tool.Handler(context.Background(), map[string]any{"json": doc, "path": tt.path})
+		if err != nil || out != tt.want {
+			t.Errorf("path %q = %s, %v; want %s", tt.path, out, err, tt.want)
+		}
+	}
+}
+
+func TestJSONPathErrors(t *testing.T) {
+	doc := `{"items": [1, 2], "name": "x"}`
+	tests := []struct {
+		json string
+		path string
+		err  string
+	}{
+		{`{"items": [`, "items", "invalid json"},
+		{"", "items", "missing required argument: json"},
+		{doc, "items[0", "unterminated '['"},
+		{doc, "missing", `key "missing" not found`},
+		{doc, "items.first", `"first" is not an array index`},
+		{doc, "items[2]", "index 2 out of range"},
+		{doc, "items[-3]", "index -3 out of range"},
+		{doc, "name.length", `cannot descend into "length"`},
+	}
+	tool := NewJSONPathTool()
+	for _, tt := range tests {
+		_, err := tool.Handler(context.Background(), map[string]any{"json": tt.json, "path": tt.path})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("json %q, path %q: error = %v, want %q", tt.json, tt.path, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
+)
+
+// DefaultTimeout is applied to tools that do not declare their own timeout
+const DefaultTimeout = 30 * time.Second
+
+// Handler executes a tool with decoded JSON arguments and returns its result
+type Handler func(ctx context.Context, args map[string]any) (string, error)
+
+// Tool is an executable tool exposed to agents
+type Tool struct {
+	Definition agent.FunctionDef
+	Handler    Handler
+	Timeout    time.Duration
+}
+
+// Registry manages all available tools
+type Registry struct {
+	tools map[string]*Tool
+	mu    sync.RWMutex
+}
+
+// NewRegistry creates a new tool registry
+func NewRegistry() *Registry {
+	return &Registry{
+		tools: make(map[string]*Tool),
+	}
+}
+
+// Register adds a tool to the registry, replacing any tool with the same name
+func (r *Registry) Register(t *Tool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tools[t.Definition.Name] = t
+}
+
+// Get retrieves a tool by name
+func (r *Registry) Get(name string) (*Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+// List returns the definitions of all registered tools sorted by name
+func (r *Registry) List() []agent.FunctionDef {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	defs := make([]agent.FunctionDef, 0, len(r.tools))
+	for _, t := range r.tools {
+		defs = append(defs, t.Definition)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+// Definitions returns the agent tool definitions for the named tools
+func (r *Registry) Definitions(names []string) ([]agent.Tool, error) {
+	defs := make([]agent.Tool, 0, len(names))
+	for _, name := range names {
+		t, ok := r.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown tool: %s", name)
+		}
+		defs = append(defs, agent.Tool{Type: "function", Function: t.Definition})
+	}
+	return defs, nil
+}
+
+// Invoke runs a tool call with the tool's timeout applied
+func (r *Registry) Invoke(ctx context.Context, call agent.ToolCall) (string, error) {
+	t, ok := r.Get(call.Function.Name)
+	if !ok {
+		return "", fmt.Errorf("unknown tool: %s", call.Function.Name)
+	}
+
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args := call.Function.Arguments
+	if args == nil {
+		args = make(map[string]any)
+	}
+
+	out, err := t.Handler(ctx, args)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("tool %s timed out after %v", t.Definition.Name, timeout)
+	}
+	return out, err
+}
+
+// Session scopes tool invocations to a single execution. State kept by
+// tools such as the scratchpad lives for as long as the session does.
+type Session struct {
+	registry   *Registry
+	scratchpad *Scratchpad
+}
+
+// NewSession creates a tool session for one execution
+func (r *Registry) NewSession() *Session {
+	return &Session{
+		registry:   r,
+		scratchpad: NewScratchpad(),
+	}
+}
+
+// Definitions returns the agent tool definitions for the named tools
+func (s *Session) Definitions(names []string) ([]agent.Tool, error) {
+	return s.registry.Definitions(names)
+}
+
+// Invoke runs a tool call within the session
+func (s *Session) Invoke(ctx context.Context, call agent.ToolCall) (string, error) {
+	ctx = context.WithValue(ctx, scratchpadKey{}, s.scratchpad)
+	return s.registry.Invoke(ctx, call)
+}
+
+// stringArg reads a required string argument
+func stringArg(args map[string]any, key string) (string, error) {
+	v, ok := args[key].(string)
+	if !ok || v == "" {
+		return "", fmt.Errorf("missing required argument: %s", key)
+	}
+	return v, nil
+}
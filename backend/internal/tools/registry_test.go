@@ -0,0 +1,58 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
+)
+
+func TestInvokeTimeout(t *testing.T) {
+	r := NewRegistry()
+	r.Register(&Tool{
+		Definition: agent.FunctionDef{Name: "slow"},
+		Timeout:    20 * time.Millisecond,
+		Handler: func(ctx context.Context, args map[string]any) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		},
+	})
+
+	start := time.Now()
+	_, err := r.Invoke(context.Background(), agent.ToolCall{Function: agent.FunctionCall{Name: "slow"}})
+	if err == nil || !strings.Contains(err.Error(), "tool slow timed out after 20ms") {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Invoke returned after %v", elapsed)
+	}
+
+	// A cancelled caller is not reported as a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = r.Invoke(ctx, agent.ToolCall{Function: agent.FunctionCall{Name: "slow"}})
+	if err != context.Canceled {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestInvoke(t *testing.T) {
+	r := NewRegistry()
+	RegisterBuiltins(r, BuiltinOptions{})
+	out, err := r.Invoke(context.Background(), agent.ToolCall{Function: agent.FunctionCall{
+		Name:      "calculator",
+		Arguments: map[string]any{"expression": "6 * 7"},
+	}})
+	if err != nil || out != "42" {
+		t.Errorf("calculator = %q, %v", out, err)
+	}
+
+	if _, err := r.Invoke(context.Background(), agent.ToolCall{Function: agent.FunctionCall{Name: "missing"}}); err == nil {
+		t.Error("invoking an unknown tool succeeded")
+	}
+	if _, err := r.Definitions([]string{"calculator", "missing"}); err == nil {
+		t.Error("definitions for an unknown tool succeeded")
+	}
+}
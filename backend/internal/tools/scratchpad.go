@@ -0,0 +1,101 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
+)
+
+type scratchpadKey struct{}
+
+// Scratchpad is a key-value store shared by the agents of one execution
+type Scratchpad struct {
+	values map[string]string
+	mu     sync.RWMutex
+}
+
+// NewScratchpad creates an empty scratchpad
+func NewScratchpad() *Scratchpad {
+	return &Scratchpad{values: make(map[string]string)}
+}
+
+// NewScratchpadTool creates the scratchpad tool
+func NewScratchpadTool() *Tool {
+	return &Tool{
+		Definition: agent.FunctionDef{
+			Name:        "scratchpad",
+			Description: "Read and write notes shared by all agents in the current execution.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"action": map[string]any{
+						"type": "string",
+						"enum": []string{"get", "set", "delete", "list"},
+					},
+					"key":   map[string]any{"type": "string"},
+					"value": map[string]any{"type": "string"},
+				},
+				"required": []string{"action"},
+			},
+		},
+		Handler: scratchpadHandler,
+	}
+}
+
+func scratchpadHandler(ctx context.Context, args map[string]any) (string, error) {
+	pad, ok := ctx.Value(scratchpadKey{}).(*Scratchpad)
+	if !ok {
+		return "", fmt.Errorf("scratchpad is only available within an execution")
+	}
+
+	action, err := stringArg(args, "action")
+	if err != nil {
+		return "", err
+	}
+
+	switch action {
+	case "list":
+		pad.mu.RLock()
+		keys := make([]string, 0, len(pad.values))
+		for k := range pad.values {
+			keys = append(keys, k)
+		}
+		pad.mu.RUnlock()
+		sort.Strings(keys)
+		b, _ := json.Marshal(keys)
+		return string(b), nil
+	}
+
+	key, err := stringArg(args, "key")
+	if err != nil {
+		return "", err
+	}
+
+	switch action {
+	case "get":
+		pad.mu.RLock()
+		v, ok := pad.values[key]
+		pad.mu.RUnlock()
+		if !ok {
+			return "", fmt.Errorf("key not found: %s", key)
+		}
+		return v, nil
+	case "set":
+		value, _ := args["value"].(string)
+		pad.mu.Lock()
+		pad.values[key] = value
+		pad.mu.Unlock()
+		return "ok", nil
+	case "delete":
+		pad.mu.Lock()
+		delete(pad.values, key)
+		pad.mu.Unlock()
+		return "ok", nil
+	default:
+		return "", fmt.Errorf("unknown action: %s", action)
+	}
+}
@@ -0,0 +1,127 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// memoryHistory is a journal kept in memory
+type memoryHistory struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (m *memoryHistory) add(eventType string, data any) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	raw, _ := json.Marshal(data)
+	sequence := len(m.events) + 1
+	m.events = append(m.events, Event{Sequence: sequence, Type: eventType, Data: raw})
+	return sequence
+}
+
+func (m *memoryHistory) EventsSince(executionID string, sequence int) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var events []Event
+	for _, event := range m.events {
+		if event.Sequence > sequence {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+type received struct {
+	Type     string         `json:"type"`
+	Sequence int            `json:"sequence"`
+	Data     map[string]any `json:"data"`
+}
+
+// dial connects to an execution's events from a cursor
+func dial(t *testing.T, server *httptest.Server, since string) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/executions/exec?since=" + since
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	return conn
+}
+
+// readUntil reads messages until one of the given type arrives
+func readUntil(t *testing.T, conn *websocket.Conn, eventType string) []received {
+	t.Helper()
+	var messages []received
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", eventType, err)
+		}
+		// The write pump batches queued messages on separate lines
+		for _, line := range strings.Split(string(data), "\n") {
+			var message received
+			if err := json.Unmarshal([]byte(line), &message); err != nil {
+				t.Fatalf("decode %q: %v", line, err)
+			}
+			messages = append(messages, message)
+			if message.Type == eventType {
+				return messages
+			}
+		}
+	}
+}
+
+func TestReconnectReceivesNodeOutputs(t *testing.T) {
+	hub := NewHub()
+	history := &memoryHistory{}
+	hub.SetHistory(history)
+	go hub.Run()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws/executions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ServeWS(hub, w, r)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// A node completes while the client is connected. Events sent before
+	// it registers reach it through the catch-up from 0.
+	conn := dial(t, server, "0")
+	publish := func(eventType string, data map[string]any) {
+		hub.BroadcastEvent("exec", eventType, history.add(eventType, data), data)
+	}
+	publish("node_complete", map[string]any{"node_id": "a"})
+	publish("node_result", map[string]any{"node_id": "a", "final_output": "first"})
+	messages := readUntil(t, conn, "node_result")
+	cursor := messages[len(messages)-1].Sequence
+	conn.Close()
+
+	// Another completes while it is away
+	publish("node_complete", map[string]any{"node_id": "b"})
+	publish("node_result", map[string]any{"node_id": "b", "final_output": "second"})
+
+	// Reconnecting from the cursor delivers the missed output only
+	conn = dial(t, server, "2")
+	defer conn.Close()
+	if cursor != 2 {
+		t.Fatalf("cursor = %d, want 2", cursor)
+	}
+	messages = readUntil(t, conn, "node_result")
+	last := messages[len(messages)-1]
+	if last.Data["node_id"] != "b" || last.Data["final_output"] != "second" || last.Sequence != 4 {
+		t.Errorf("caught up with %+v, want node b's output", last)
+	}
+	for _, message := range messages {
+		if message.Data["node_id"] == "a" {
+			t.Errorf("event before the cursor sent again: %+v", message)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -14,6 +16,7 @@ const (
 	pongWait       = 60 * time.Second
 	pingPeriod     = (pongWait * 9) / 10
 	maxMessageSize = 512 * 1024 // 512KB
+	maxPending     = 1024       // live messages held back during catch-up
 )
 
 var upgrader = websocket.Upgrader{
@@ -30,6 +33,29 @@ type Client struct {
 	conn        *websocket.Conn
 	send        chan []byte
 	executionID string
+
+	// While the client catches up on the journaled events of the execution
+	// in catchingUp, live messages are held back in pending. resync asks the
+	// write pump to catch up. closed is set once send is closed.
+	mu         sync.Mutex
+	catchingUp string
+	pending    []queuedMessage
+	resync     chan resync
+	closed     bool
+}
+
+// queuedMessage is a live message held back during catch-up
+type queuedMessage struct {
+	sequence int
+	message  []byte
+}
+
+// resync asks the write pump to send the events of an execution journaled
+// after since, preceded by notice when set
+type resync struct {
+	executionID string
+	since       int
+	notice      []byte
 }
 
 // ClientMessage represents a message from the client
@@ -38,6 +64,9 @@ type ClientMessage struct {
 	Data struct {
 		StepID    string `json:"step_id,omitempty"`
 		NewOutput string `json:"new_output,omitempty"`
+		NodeID    string `json:"node_id,omitempty"`
+		Action    string `json:"action,omitempty"`
+		Comment   string `json:"comment,omitempty"`
 	} `json:"data"`
 }
 
@@ -60,8 +89,20 @@ func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		conn:        conn,
 		send:        make(chan []byte, 256),
 		executionID: executionID,
+		resync:      make(chan resync, 1),
+	}
+
+	// With a since cursor the events journaled after it are sent before
+	// live ones; since=0 replays the whole timeline
+	if v := r.URL.Query().Get("since"); v != "" {
+		if since, err := strconv.Atoi(v); err == nil && since >= 0 {
+			client.catchingUp = executionID
+			client.resync <- resync{executionID: executionID, since: since}
+		} else {
+			log.Printf("[WebSocket] Ignoring invalid since cursor %q", v)
+		}
 	}
-	hub.register <- client
+	hub.register(client)
 
 	// Start read and write pumps
 	go client.writePump()
@@ -136,6 +177,11 @@ func (c *Client) writePump() {
 				return
 			}
 
+		case r := <-c.resync:
+			if err := c.catchUp(r); err != nil {
+				return
+			}
+
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -145,20 +191,197 @@ func (c *Client) writePump() {
 	}
 }
 
+// catchUp writes the journaled events of an execution after a cursor, then
+// the live messages held back meanwhile, skipping those the journal already
+// contained. Messages queued on send afterwards follow in order.
+func (c *Client) catchUp(r resync) error {
+	messages := [][]byte{}
+	if r.notice != nil {
+		messages = append(messages, r.notice)
+	}
+
+	last := r.since
+	events, err := []Event(nil), errNoHistory
+	if c.hub.history != nil {
+		events, err = c.hub.history.EventsSince(r.executionID, r.since)
+	}
+	if err != nil {
+		log.Printf("[WebSocket] Cannot load events of execution %s: %v", r.executionID, err)
+		message, _ := json.Marshal(map[string]any{
+			"type": "error",
+			"data": map[string]string{"request": "since", "message": err.Error()},
+		})
+		messages = append(messages, message)
+	}
+	for _, event := range events {
+		message, err := encodeEvent(r.executionID, event.Type, event.Sequence, event.Data)
+		if err != nil {
+			continue
+		}
+		messages = append(messages, message)
+		last = event.Sequence
+	}
+
+	// Messages held back for an execution the client has since switched
+	// to are left for that execution's catch-up
+	var pending []queuedMessage
+	c.mu.Lock()
+	if c.catchingUp == r.executionID {
+		pending = c.pending
+		c.pending = nil
+		c.catchingUp = ""
+	}
+	c.mu.Unlock()
+
+	for _, queued := range pending {
+		if queued.sequence == 0 || queued.sequence > last {
+			messages = append(messages, queued.message)
+		}
+	}
+	for _, message := range messages {
+		c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver queues a live message for the client, holding it back while the
+// client catches up. It reports false when the client cannot keep up.
+func (c *Client) deliver(sequence int, message []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return true
+	}
+	if c.catchingUp != "" {
+		if len(c.pending) >= maxPending {
+			return false
+		}
+		c.pending = append(c.pending, queuedMessage{sequence: sequence, message: message})
+		return true
+	}
+	select {
+	case c.send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
 // handleMessage processes messages from the client
 func (c *Client) handleMessage(msg ClientMessage) {
 	switch msg.Type {
 	case "modify_step":
-		// Handle step modification during replay
-		log.Printf("[WebSocket] Modify step request: step=%s", msg.Data.StepID)
-		// This would trigger the replay engine to modify and recalculate
+		// Fork a replay with the step's output edited and follow it
+		c.fork(msg)
+
+	case "approval":
+		// Approve, reject or edit the output of a waiting approval node
+		c.dispatch(msg)
+
+	case "cancel", "pause", "resume", "edit_output":
+		// Control the execution this client is subscribed to
+		c.dispatch(msg)
 
 	case "ping":
 		// Respond to ping
 		response, _ := json.Marshal(map[string]string{"type": "pong"})
-		c.send <- response
+		c.reply(response)
 
 	default:
 		log.Printf("[WebSocket] Unknown message type: %s", msg.Type)
 	}
 }
+
+// dispatch passes an execution control message to the hub's handler and
+// reports failures back to the client
+func (c *Client) dispatch(msg ClientMessage) {
+	err := errNoHandler
+	if c.hub.handler != nil {
+		err = c.hub.handler.HandleMessage(c.executionID, msg)
+	}
+	if err != nil {
+		c.sendError(msg.Type, err)
+	}
+}
+
+// fork replays the subscribed execution with a step's output edited, then
+// switches the client to the new execution: it is sent the new ID followed
+// by every event of the replay so far, then live ones
+func (c *Client) fork(msg ClientMessage) {
+	if c.hub.handler == nil {
+		c.sendError(msg.Type, errNoHandler)
+		return
+	}
+	executionID, err := c.hub.handler.ForkExecution(c.executionID, msg.Data.StepID, msg.Data.NewOutput)
+	if err != nil {
+		c.sendError(msg.Type, err)
+		return
+	}
+
+	log.Printf("[WebSocket] Step %s of execution %s edited, following replay %s", msg.Data.StepID, c.executionID, executionID)
+	notice, _ := json.Marshal(map[string]any{
+		"type":         "execution_forked",
+		"execution_id": executionID,
+		"data": map[string]string{
+			"original_execution_id": c.executionID,
+			"execution_id":          executionID,
+			"step_id":               msg.Data.StepID,
+		},
+	})
+
+	// Stop the old execution's messages and drop those still held back,
+	// so none are filtered against the new execution's cursor, before
+	// following the new execution
+	c.hub.subscribe(c, "")
+	c.mu.Lock()
+	c.pending = nil
+	c.catchingUp = executionID
+	c.mu.Unlock()
+	c.hub.subscribe(c, executionID)
+
+	select {
+	case c.resync <- resync{executionID: executionID, notice: notice}:
+	case <-time.After(writeWait):
+		// The write pump has stopped; drop the connection
+		log.Printf("[WebSocket] Client not keeping up, closing connection")
+		c.conn.Close()
+	}
+}
+
+// sendError reports a failed request back to the client
+func (c *Client) sendError(request string, err error) {
+	log.Printf("[WebSocket] %s request failed: %v", request, err)
+	response, _ := json.Marshal(map[string]any{
+		"type": "error",
+		"data": map[string]string{"request": request, "message": err.Error()},
+	})
+	c.reply(response)
+}
+
+// reply sends a response to a client request unless the client is gone or
+// not keeping up
+func (c *Client) reply(message []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.send <- message:
+	default:
+		log.Printf("[WebSocket] Client not keeping up, dropping response")
+	}
+}
+
+// close closes the client's send channel once
+func (c *Client) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
@@ -0,0 +1,79 @@
+package websocket
+
+import (
+	"errors"
+	"testing"
+)
+
+type forkHandler struct{}
+
+func (forkHandler) HandleMessage(executionID string, msg ClientMessage) error {
+	return errors.New("not supported")
+}
+
+func (forkHandler) ForkExecution(executionID, stepID, newOutput string) (string, error) {
+	return "new", nil
+}
+
+func newTestClient(hub *Hub, executionID string) *Client {
+	c := &Client{
+		hub:         hub,
+		send:        make(chan []byte, 1),
+		executionID: executionID,
+		resync:      make(chan resync, 1),
+	}
+	hub.register(c)
+	return c
+}
+
+func TestForkSwitchesExecution(t *testing.T) {
+	hub := NewHub()
+	hub.SetHandler(forkHandler{})
+	c := newTestClient(hub, "old")
+	c.catchingUp = "old"
+	hub.BroadcastEvent("old", "node_complete", 5, nil)
+
+	msg := ClientMessage{Type: "modify_step"}
+	msg.Data.StepID = "s1"
+	c.fork(msg)
+
+	if c.executionID != "new" || c.catchingUp != "new" {
+		t.Fatalf("client follows %q, catching up on %q; want new", c.executionID, c.catchingUp)
+	}
+	if len(c.pending) != 0 {
+		t.Errorf("%d messages of the old execution still held back", len(c.pending))
+	}
+	if r := <-c.resync; r.executionID != "new" || r.since != 0 || r.notice == nil {
+		t.Errorf("resync = %+v, want the new execution from the start with a notice", r)
+	}
+
+	// Only the new execution's messages are held back until it caught up
+	hub.BroadcastEvent("old", "node_complete", 6, nil)
+	hub.BroadcastEvent("new", "node_started", 1, nil)
+	if len(c.pending) != 1 || c.pending[0].sequence != 1 {
+		t.Errorf("pending = %+v, want the new execution's event", c.pending)
+	}
+}
+
+func TestClosedClient(t *testing.T) {
+	hub := NewHub()
+	c := newTestClient(hub, "exec")
+	c.close()
+	c.close()
+
+	// Responses and events for a closed client are dropped
+	c.sendError("cancel", errors.New("failed"))
+	c.handleMessage(ClientMessage{Type: "ping"})
+	if !c.deliver(1, []byte("{}")) {
+		t.Error("deliver to a closed client reported a slow client")
+	}
+}
+
+func TestReplyDoesNotBlock(t *testing.T) {
+	c := newTestClient(NewHub(), "exec")
+	c.send <- []byte("queued")
+	c.sendError("cancel", errors.New("failed"))
+	if got := string(<-c.send); got != "queued" {
+		t.Errorf("send = %s", got)
+	}
+}
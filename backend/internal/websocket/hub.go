@@ -2,16 +2,45 @@ package websocket
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"sync"
 )
 
+var (
+	errNoHandler = errors.New("execution control is not available")
+	errNoHistory = errors.New("event history is not available")
+)
+
+// MessageHandler handles client messages that control an execution, such as
+// approval decisions
+type MessageHandler interface {
+	HandleMessage(executionID string, msg ClientMessage) error
+	// ForkExecution replays an execution with a step's output edited and
+	// returns the new execution's ID
+	ForkExecution(executionID, stepID, newOutput string) (string, error)
+}
+
+// History loads the events journaled for an execution, so clients that
+// connect late can catch up
+type History interface {
+	EventsSince(executionID string, sequence int) ([]Event, error)
+}
+
+// Event is an execution event as journaled under its sequence number
+type Event struct {
+	Sequence int
+	Type     string
+	Data     json.RawMessage
+}
+
 // Hub maintains the set of active clients and broadcasts messages
 type Hub struct {
 	clients    map[*Client]bool
 	broadcast  chan []byte
-	register   chan *Client
 	unregister chan *Client
+	handler    MessageHandler
+	history    History
 	mu         sync.RWMutex
 }
 
@@ -20,43 +49,83 @@ func NewHub() *Hub {
 	return &Hub{
 		clients:    make(map[*Client]bool),
 		broadcast:  make(chan []byte, 256),
-		register:   make(chan *Client),
 		unregister: make(chan *Client),
 	}
 }
 
+// SetHandler sets the handler for execution control messages. It must be
+// called before clients connect.
+func (h *Hub) SetHandler(handler MessageHandler) {
+	h.handler = handler
+}
+
+// SetHistory sets the journal clients catch up from. It must be called
+// before clients connect.
+func (h *Hub) SetHistory(history History) {
+	h.history = history
+}
+
+// register adds a client. It returns once the client receives broadcasts,
+// so a client catching up cannot miss events sent after its backlog loads.
+func (h *Hub) register(client *Client) {
+	h.mu.Lock()
+	h.clients[client] = true
+	total := len(h.clients)
+	h.mu.Unlock()
+	log.Printf("[WebSocket] Client connected. Total: %d", total)
+}
+
 // Run starts the hub's main loop
 func (h *Hub) Run() {
 	for {
 		select {
-		case client := <-h.register:
-			h.mu.Lock()
-			h.clients[client] = true
-			h.mu.Unlock()
-			log.Printf("[WebSocket] Client connected. Total: %d", len(h.clients))
-
 		case client := <-h.unregister:
 			h.mu.Lock()
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
-				close(client.send)
+				client.close()
 			}
+			total := len(h.clients)
 			h.mu.Unlock()
-			log.Printf("[WebSocket] Client disconnected. Total: %d", len(h.clients))
+			log.Printf("[WebSocket] Client disconnected. Total: %d", total)
 
 		case message := <-h.broadcast:
+			var slow []*Client
 			h.mu.RLock()
 			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+				if !client.deliver(0, message) {
+					slow = append(slow, client)
 				}
 			}
 			h.mu.RUnlock()
+			h.drop(slow)
+		}
+	}
+}
+
+// drop disconnects clients that could not keep up. Deliveries only hold the
+// read lock, so they collect such clients and drop them afterwards.
+func (h *Hub) drop(clients []*Client) {
+	if len(clients) == 0 {
+		return
+	}
+	h.mu.Lock()
+	for _, client := range clients {
+		if _, ok := h.clients[client]; ok {
+			delete(h.clients, client)
+			client.close()
 		}
 	}
+	h.mu.Unlock()
+	log.Printf("[WebSocket] Dropped %d client(s) not keeping up", len(clients))
+}
+
+// subscribe moves a client to another execution's events. Only the client's
+// read loop changes its subscription.
+func (h *Hub) subscribe(client *Client, executionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	client.executionID = executionID
 }
 
 // Broadcast sends a message to all connected clients
@@ -75,27 +144,39 @@ func (h *Hub) Broadcast(eventType string, data any) error {
 
 // BroadcastToExecution sends a message to clients subscribed to a specific execution
 func (h *Hub) BroadcastToExecution(executionID string, eventType string, data any) error {
-	message := map[string]any{
-		"type":         eventType,
-		"execution_id": executionID,
-		"data":         data,
-	}
-	jsonData, err := json.Marshal(message)
+	return h.BroadcastEvent(executionID, eventType, 0, data)
+}
+
+// BroadcastEvent sends an execution event journaled under sequence to the
+// clients subscribed to the execution. Clients use the sequence as their
+// cursor when reconnecting; events that are not journaled have none.
+func (h *Hub) BroadcastEvent(executionID string, eventType string, sequence int, data any) error {
+	jsonData, err := encodeEvent(executionID, eventType, sequence, data)
 	if err != nil {
 		return err
 	}
 
+	var slow []*Client
 	h.mu.RLock()
 	for client := range h.clients {
-		if client.executionID == executionID {
-			select {
-			case client.send <- jsonData:
-			default:
-				close(client.send)
-				delete(h.clients, client)
-			}
+		if client.executionID == executionID && !client.deliver(sequence, jsonData) {
+			slow = append(slow, client)
 		}
 	}
 	h.mu.RUnlock()
+	h.drop(slow)
 	return nil
 }
+
+// encodeEvent builds the message clients receive for an execution event
+func encodeEvent(executionID string, eventType string, sequence int, data any) ([]byte, error) {
+	message := map[string]any{
+		"type":         eventType,
+		"execution_id": executionID,
+		"data":         data,
+	}
+	if sequence > 0 {
+		message["sequence"] = sequence
+	}
+	return json.Marshal(message)
+}
@@ -0,0 +1,49 @@
+package websocket
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestBroadcastDropsSlowClientsConcurrently(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	// Every client has a full send buffer, so every delivery fails
+	var clients []*Client
+	for i := 0; i < 40; i++ {
+		c := newTestClient(hub, fmt.Sprint("exec", i%8))
+		c.send <- []byte("queued")
+		clients = append(clients, c)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(executionID string) {
+			defer wg.Done()
+			for seq := 1; seq <= 20; seq++ {
+				hub.BroadcastEvent(executionID, "node_started", seq, nil)
+			}
+		}(fmt.Sprint("exec", i))
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		hub.Broadcast("notice", nil)
+	}()
+	wg.Wait()
+
+	hub.mu.RLock()
+	remaining := len(hub.clients)
+	hub.mu.RUnlock()
+	if remaining != 0 {
+		t.Errorf("%d slow clients still registered", remaining)
+	}
+	for _, c := range clients {
+		if !c.closed {
+			t.Error("slow client not closed")
+		}
+	}
+}
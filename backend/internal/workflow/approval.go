@@ -0,0 +1,227 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// NodeTypeApproval pauses the execution until a reviewer decides on the
+// node's pending output
+const NodeTypeApproval = "approval"
+
+// Reviewer actions on a pending approval
+const (
+	ApprovalApprove = "approve"
+	ApprovalReject  = "reject"
+	ApprovalEdit    = "edit"
+)
+
+// ErrNoPendingApproval is returned when a decision targets a node that is
+// not waiting for one
+var ErrNoPendingApproval = errors.New("no approval pending for this node")
+
+// ApprovalConfig configures an approval node. Without a timeout the node
+// waits until a reviewer decides.
+type ApprovalConfig struct {
+	Timeout       time.Duration
+	TimeoutAction string
+}
+
+// ApprovalRequest is the output an approval node holds back for review
+type ApprovalRequest struct {
+	NodeID        string     `json:"node_id"`
+	Output        string     `json:"output"`
+	TimeoutAction string     `json:"timeout_action"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+}
+
+// ApprovalDecision is a reviewer's answer to an approval request. Output
+// replaces the pending output when Action is edit.
+type ApprovalDecision struct {
+	Action   string `json:"action"`
+	Output   string `json:"output,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+	TimedOut bool   `json:"timed_out,omitempty"`
+}
+
+// parseApprovalConfig reads data.timeout_seconds and data.timeout_action,
+// which defaults to reject
+func parseApprovalConfig(data map[string]any) (*ApprovalConfig, error) {
+	cfg := &ApprovalConfig{TimeoutAction: ApprovalReject}
+	if t, ok := data["timeout_seconds"].(float64); ok && t > 0 {
+		cfg.Timeout = time.Duration(t * float64(time.Second))
+	}
+	if action, ok := data["timeout_action"].(string); ok && action != "" {
+		if action != ApprovalApprove && action != ApprovalReject {
+			return nil, fmt.Errorf("timeout_action must be %q or %q", ApprovalApprove, ApprovalReject)
+		}
+		cfg.TimeoutAction = action
+	}
+	return cfg, nil
+}
+
+// runApprovalNode holds the node's input back until a reviewer approves,
+// rejects or edits it, or the timeout applies the default action. Approved
+// and edited outputs flow downstream; a rejection fails the node.
+func (s *Scheduler) runApprovalNode(ctx context.Context, node *Node) (*nodeRun, error) {
+	start := time.Now()
+	pending, err := s.approvalInput(node)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &ApprovalRequest{
+		NodeID:        node.ID,
+		Output:        pending,
+		TimeoutAction: node.Approval.TimeoutAction,
+	}
+	if node.Approval.Timeout > 0 {
+		expiresAt := start.Add(node.Approval.Timeout)
+		req.ExpiresAt = &expiresAt
+	}
+
+	decisions := make(chan ApprovalDecision, 1)
+	s.mu.Lock()
+	s.approvals[node.ID] = decisions
+	nodes := NodeSnapshots(s.dag, s.results)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.approvals, node.ID)
+		s.mu.Unlock()
+	}()
+
+	if s.recorder != nil {
+		if err := s.recorder.RequestApproval(ctx, s.executionID, req, nodes); err != nil {
+			return nil, fmt.Errorf("request approval: %w", err)
+		}
+	}
+	s.eventChan <- ExecutionEvent{
+		Type:      "approval_requested",
+		NodeID:    node.ID,
+		Approval:  req,
+		Timestamp: time.Now(),
+	}
+	log.Printf("[Scheduler] Node %s waiting for approval", node.ID)
+
+	var timeout <-chan time.Time
+	if req.ExpiresAt != nil {
+		timer := time.NewTimer(time.Until(*req.ExpiresAt))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var decision ApprovalDecision
+	select {
+	case decision = <-decisions:
+	case <-timeout:
+		// A decision that arrived together with the timeout wins
+		s.mu.Lock()
+		if _, waiting := s.approvals[node.ID]; waiting {
+			delete(s.approvals, node.ID)
+			decision = ApprovalDecision{Action: req.TimeoutAction, TimedOut: true}
+		} else {
+			decision = <-decisions
+		}
+		s.mu.Unlock()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	output := pending
+	if decision.Action == ApprovalEdit {
+		output = decision.Output
+	}
+
+	if s.recorder != nil {
+		if err := s.recorder.ResolveApproval(context.WithoutCancel(ctx), s.executionID, node.ID, decision); err != nil {
+			log.Printf("[Scheduler] Failed to record approval of node %s: %v", node.ID, err)
+		}
+	}
+	s.eventChan <- ExecutionEvent{
+		Type:      "approval_resolved",
+		NodeID:    node.ID,
+		Decision:  &decision,
+		Timestamp: time.Now(),
+	}
+	log.Printf("[Scheduler] Node %s approval: %s (timed out: %v)", node.ID, decision.Action, decision.TimedOut)
+
+	run := &nodeRun{Output: output}
+	s.recordStep(node.ID, run, store.Step{
+		StepID:    uuid.NewString(),
+		Type:      "result",
+		Tool:      NodeTypeApproval,
+		Input:     pending,
+		Output:    output,
+		Arguments: map[string]any{"action": decision.Action, "comment": decision.Comment, "timed_out": decision.TimedOut},
+		LatencyMs: time.Since(start).Milliseconds(),
+		Timestamp: start,
+	})
+
+	if decision.Action == ApprovalReject {
+		switch {
+		case decision.TimedOut:
+			return run, fmt.Errorf("approval timed out")
+		case decision.Comment != "":
+			return run, fmt.Errorf("rejected by reviewer: %s", decision.Comment)
+		default:
+			return run, fmt.Errorf("rejected by reviewer")
+		}
+	}
+	return run, nil
+}
+
+// approvalInput renders the output held back for review: the prompt
+// template when set, otherwise the outputs arriving over taken edges, or the
+// workflow input for entry nodes
+func (s *Scheduler) approvalInput(node *Node) (string, error) {
+	if node.Template != "" {
+		return renderTemplate(node.Template, s.nodeResolver(node.ID))
+	}
+
+	var outputs []string
+	s.mu.RLock()
+	for _, edge := range s.dag.IncomingEdges(node.ID) {
+		if !s.active[edge.ID] {
+			continue
+		}
+		if result, ok := s.results[edge.Source]; ok && result != nil {
+			outputs = append(outputs, result.Output)
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(outputs) == 0 && len(s.input) > 0 {
+		return formatFields(s.input), nil
+	}
+	return strings.Join(outputs, "\n\n"), nil
+}
+
+// Decide delivers a reviewer's decision to an approval node waiting in this
+// execution
+func (s *Scheduler) Decide(nodeID string, decision ApprovalDecision) error {
+	switch decision.Action {
+	case ApprovalApprove, ApprovalReject, ApprovalEdit:
+	default:
+		return fmt.Errorf("unknown approval action %q", decision.Action)
+	}
+	decision.TimedOut = false
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	decisions, ok := s.approvals[nodeID]
+	if !ok {
+		return ErrNoPendingApproval
+	}
+	delete(s.approvals, nodeID)
+	decisions <- decision
+	return nil
+}
@@ -0,0 +1,156 @@
+package workflow
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+	"github.com/Wangren-Academy/Agent/backend/internal/tools"
+)
+
+// Condition types supported on edges
+const (
+	ConditionContains = "contains"
+	ConditionRegex    = "regex"
+	ConditionJSON     = "json"
+	ConditionLabel    = "label"
+)
+
+// Condition is a compiled edge condition
+type Condition struct {
+	store.EdgeCondition
+	re *regexp.Regexp
+}
+
+// compileCondition validates an edge condition and prepares it for evaluation
+func compileCondition(c *store.EdgeCondition) (*Condition, error) {
+	if c == nil {
+		return nil, nil
+	}
+	cond := &Condition{EdgeCondition: *c}
+
+	switch c.Type {
+	case ConditionContains, ConditionLabel:
+		if c.Value == "" {
+			return nil, fmt.Errorf("%s condition requires a value", c.Type)
+		}
+	case ConditionRegex:
+		pattern := c.Value
+		if !c.CaseSensitive {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex condition: %w", err)
+		}
+		cond.re = re
+	case ConditionJSON:
+		if c.Path == "" {
+			return nil, fmt.Errorf("json condition requires a path")
+		}
+		switch c.Operator {
+		case "", "eq", "ne", "gt", "gte", "lt", "lte", "contains", "exists":
+		default:
+			return nil, fmt.Errorf("unknown json condition operator: %s", c.Operator)
+		}
+	default:
+		return nil, fmt.Errorf("unknown condition type: %q", c.Type)
+	}
+	return cond, nil
+}
+
+// Evaluate reports whether the edge should be followed for the given output
+func (c *Condition) Evaluate(output string) bool {
+	if c == nil {
+		return true
+	}
+	matched := c.match(output)
+	if c.Negate {
+		return !matched
+	}
+	return matched
+}
+
+func (c *Condition) match(output string) bool {
+	switch c.Type {
+	case ConditionContains:
+		if c.CaseSensitive {
+			return strings.Contains(output, c.Value)
+		}
+		return strings.Contains(strings.ToLower(output), strings.ToLower(c.Value))
+	case ConditionRegex:
+		return c.re.MatchString(output)
+	case ConditionLabel:
+		return c.equalFold(outputLabel(output), c.Value)
+	case ConditionJSON:
+		doc, err := decodeOutput(output)
+		if err != nil {
+			return false
+		}
+		value, err := tools.ExtractPath(doc, c.Path)
+		if c.Operator == "exists" {
+			return err == nil
+		}
+		if err != nil {
+			return false
+		}
+		return c.compare(value)
+	}
+	return false
+}
+
+// compare applies the json operator to an extracted value. Numbers are
+// compared numerically; everything else is compared as text.
+func (c *Condition) compare(value any) bool {
+	actual := formatValue(value)
+	switch c.Operator {
+	case "", "eq":
+		return c.equalFold(actual, c.Value)
+	case "ne":
+		return !c.equalFold(actual, c.Value)
+	case "contains":
+		if c.CaseSensitive {
+			return strings.Contains(actual, c.Value)
+		}
+		return strings.Contains(strings.ToLower(actual), strings.ToLower(c.Value))
+	}
+
+	a, errA := strconv.ParseFloat(actual, 64)
+	b, errB := strconv.ParseFloat(c.Value, 64)
+	if errA != nil || errB != nil {
+		return false
+	}
+	switch c.Operator {
+	case "gt":
+		return a > b
+	case "gte":
+		return a >= b
+	case "lt":
+		return a < b
+	case "lte":
+		return a <= b
+	}
+	return false
+}
+
+func (c *Condition) equalFold(a, b string) bool {
+	if c.CaseSensitive {
+		return a == b
+	}
+	return strings.EqualFold(a, b)
+}
+
+// outputLabel extracts a classifier label from a node output: either the
+// "label" field of a JSON object or the trimmed text itself
+func outputLabel(output string) string {
+	if doc, err := decodeOutput(output); err == nil {
+		if obj, ok := doc.(map[string]any); ok {
+			if label, ok := obj["label"].(string); ok {
+				return strings.TrimSpace(label)
+			}
+		}
+	}
+	return strings.Trim(strings.TrimSpace(output), `"'.`)
+}
@@ -0,0 +1,186 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Execution states reported while a scheduler runs. Pause moves a running
+// execution to pausing until its running nodes finish, then to paused;
+// Resume moves it through resuming back to running.
+const (
+	ExecutionRunning  = "running"
+	ExecutionPausing  = "pausing"
+	ExecutionPaused   = "paused"
+	ExecutionResuming = "resuming"
+)
+
+// heldNode is a node that became ready while the execution was paused
+type heldNode struct {
+	ctx    context.Context
+	nodeID string
+}
+
+// State returns the execution's pause state
+func (s *Scheduler) State() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state
+}
+
+// Pause stops new nodes from starting. Nodes already running finish, after
+// which the execution is paused until Resume.
+func (s *Scheduler) Pause() error {
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+		return fmt.Errorf("execution has finished")
+	}
+	if s.state != ExecutionRunning {
+		s.mu.Unlock()
+		return fmt.Errorf("cannot pause a %s execution", s.state)
+	}
+	s.state = ExecutionPausing
+	if s.inFlight == 0 {
+		s.state = ExecutionPaused
+	}
+	s.mu.Unlock()
+
+	log.Printf("[Scheduler] Pausing execution %s", s.executionID)
+	s.recordState()
+	return nil
+}
+
+// Resume starts the nodes held while the execution was paused
+func (s *Scheduler) Resume() error {
+	s.mu.Lock()
+	if s.state != ExecutionPaused && s.state != ExecutionPausing {
+		s.mu.Unlock()
+		return fmt.Errorf("execution is not paused")
+	}
+	s.state = ExecutionResuming
+	held := s.held
+	s.held = nil
+	s.mu.Unlock()
+	s.recordState()
+
+	log.Printf("[Scheduler] Resuming execution %s (%d held node(s))", s.executionID, len(held))
+	for _, h := range held {
+		s.start(h.ctx, h.nodeID)
+	}
+
+	s.mu.Lock()
+	s.state = ExecutionRunning
+	s.mu.Unlock()
+	s.recordState()
+	return nil
+}
+
+// EditOutput replaces the output of a finished node while the execution is
+// paused, so the nodes after it receive the edited output. Edges already
+// evaluated keep their decision, and nodes downstream must not have run yet.
+func (s *Scheduler) EditOutput(nodeID, output string) error {
+	s.mu.Lock()
+	if s.state != ExecutionPaused {
+		s.mu.Unlock()
+		return fmt.Errorf("outputs can only be edited while paused")
+	}
+	result, ok := s.results[nodeID]
+	if !ok || result.Status != NodeStatusSuccess {
+		s.mu.Unlock()
+		return fmt.Errorf("node %s has no output to edit", nodeID)
+	}
+	for _, downstreamID := range s.dag.Nodes[nodeID].Downstream {
+		if s.started[downstreamID] && !s.isHeld(downstreamID) {
+			s.mu.Unlock()
+			return fmt.Errorf("downstream node %s has already run", downstreamID)
+		}
+	}
+	result.Output = output
+	result.Edited = true
+	edited := *result
+	s.eventChan <- ExecutionEvent{
+		Type:      "output_edited",
+		NodeID:    nodeID,
+		Result:    &edited,
+		Timestamp: time.Now(),
+	}
+	s.mu.Unlock()
+
+	log.Printf("[Scheduler] Output of node %s edited", nodeID)
+	s.checkpoint(nodeID)
+	s.recordState()
+	return nil
+}
+
+// Cancel stops the execution. Running nodes are interrupted, including
+// in-flight model and HTTP calls, and nodes that have not run yet, held ones
+// included, are marked cancelled.
+func (s *Scheduler) Cancel() {
+	s.mu.Lock()
+	s.cancelled = true
+	if s.cancel != nil {
+		s.cancel()
+	}
+	held := s.held
+	s.held = nil
+	s.mu.Unlock()
+
+	for _, h := range held {
+		s.start(h.ctx, h.nodeID)
+	}
+}
+
+// isHeld reports whether a node is waiting for Resume. Callers must hold s.mu.
+func (s *Scheduler) isHeld(nodeID string) bool {
+	for _, h := range s.held {
+		if h.nodeID == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeStopped completes a pause once the last running node has finished
+func (s *Scheduler) nodeStopped() {
+	s.mu.Lock()
+	s.inFlight--
+	paused := s.inFlight == 0 && s.state == ExecutionPausing
+	if paused {
+		s.state = ExecutionPaused
+	}
+	s.mu.Unlock()
+
+	if paused {
+		log.Printf("[Scheduler] Execution %s paused", s.executionID)
+		s.recordState()
+	}
+}
+
+// recordState notifies clients of the current pause state and persists it
+// with the node results so far. Calls are serialized so the last one
+// recorded is the latest state.
+func (s *Scheduler) recordState() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	s.mu.Lock()
+	state := s.state
+	nodes := NodeSnapshots(s.dag, s.results)
+	if !s.finished {
+		s.eventChan <- ExecutionEvent{
+			Type:      "execution_state",
+			State:     state,
+			Timestamp: time.Now(),
+		}
+	}
+	s.mu.Unlock()
+
+	if s.recorder != nil {
+		if err := s.recorder.RecordState(context.Background(), s.executionID, state, nodes); err != nil {
+			log.Printf("[Scheduler] Failed to record state of execution %s: %v", s.executionID, err)
+		}
+	}
+}
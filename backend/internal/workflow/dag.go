@@ -1,30 +1,66 @@
 package workflow
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/Wangren-Academy/Agent/backend/internal/store"
 
 	"github.com/google/uuid"
 )
 
+// Node types, set through data.type on a node. Nodes without a type are agents.
+const (
+	NodeTypeAgent       = "agent"
+	NodeTypeRouter      = "router"
+	NodeTypeMap         = "map"
+	NodeTypeSubWorkflow = "subworkflow"
+)
+
+// defaultMapConcurrency bounds how many items a map node runs at once
+const defaultMapConcurrency = 4
+
 // Node represents a node in the workflow DAG
 type Node struct {
-	ID         string
-	AgentID    uuid.UUID
-	AgentName  string
-	Position   store.Position
-	InputMap   map[string]string
-	Config     map[string]any
-	DependsOn  []string
-	Downstream []string
+	ID          string
+	Type        string
+	Name        string
+	AgentID     uuid.UUID
+	AgentName   string
+	Template    string
+	Position    store.Position
+	InputMap    map[string]string
+	Format      string
+	Map         *MapConfig
+	SubWorkflow *SubWorkflow
+	HTTP        *HTTPConfig
+	Expr        *Expression
+	Approval    *ApprovalConfig
+	Config      map[string]any
+	DependsOn   []string
+	Downstream  []string
+}
+
+// MapConfig configures a map node, which runs its agent or sub-graph once
+// per element of a JSON array
+type MapConfig struct {
+	// Items references the array, e.g. "nodes.splitter.output.documents" or
+	// "input.urls". Empty means the output of the node's single upstream node.
+	Items       string
+	Concurrency int
+	// Subgraph, when set, runs per item with {"item": ..., "index": ...} as
+	// its workflow input instead of the node's agent
+	Subgraph *DAG
 }
 
 // Edge represents a connection between nodes
 type Edge struct {
-	ID     string
-	Source string
-	Target string
+	ID        string
+	Source    string
+	Target    string
+	Label     string
+	Condition *Condition
 }
 
 // DAG represents the workflow as a Directed Acyclic Graph
@@ -33,6 +69,50 @@ type DAG struct {
 	Edges     []*Edge
 	InDegrees map[string]int
 	OutEdges  map[string][]string
+	Loops     []*Loop
+	names     map[string]string
+	incoming  map[string][]*Edge
+	outgoing  map[string][]*Edge
+	loopOf    map[string]*Loop
+}
+
+// withEdgeIDs returns edges with IDs filled in for edges saved before edge
+// IDs were required. The generated IDs depend only on the edge list, so a
+// workflow's edges keep them across loads.
+func withEdgeIDs(edges []store.EdgeConfig) []store.EdgeConfig {
+	taken := make(map[string]bool, len(edges))
+	missing := false
+	for _, edge := range edges {
+		taken[edge.ID] = true
+		missing = missing || edge.ID == ""
+	}
+	if !missing {
+		return edges
+	}
+
+	out := make([]store.EdgeConfig, len(edges))
+	for i, edge := range edges {
+		if edge.ID == "" {
+			edge.ID = edge.Source + "->" + edge.Target
+			for n := 2; taken[edge.ID]; n++ {
+				edge.ID = fmt.Sprintf("%s->%s#%d", edge.Source, edge.Target, n)
+			}
+			taken[edge.ID] = true
+		}
+		out[i] = edge
+	}
+	return out
+}
+
+// RequireEdgeIDs returns an error for the first edge without an ID. Saved
+// workflows must name every edge; NewDAG only fills IDs in for old ones.
+func RequireEdgeIDs(edges []store.EdgeConfig) error {
+	for _, edge := range edges {
+		if edge.ID == "" {
+			return fmt.Errorf("edge from %s to %s has no id", edge.Source, edge.Target)
+		}
+	}
+	return nil
 }
 
 // NewDAG creates a new DAG from workflow configuration
@@ -42,33 +122,93 @@ func NewDAG(workflow *store.Workflow) (*DAG, error) {
 		Edges:     make([]*Edge, 0),
 		InDegrees: make(map[string]int),
 		OutEdges:  make(map[string][]string),
+		names:     make(map[string]string),
+		incoming:  make(map[string][]*Edge),
+		outgoing:  make(map[string][]*Edge),
+		loopOf:    make(map[string]*Loop),
 	}
 
 	// Add nodes
 	for _, nodeConfig := range workflow.Nodes {
+		if _, exists := dag.Nodes[nodeConfig.ID]; exists {
+			return nil, fmt.Errorf("duplicate node id: %s", nodeConfig.ID)
+		}
+		inputMap, err := parseInputMapping(nodeConfig.Data)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", nodeConfig.ID, err)
+		}
+		nodeType, _ := nodeConfig.Data["type"].(string)
+		if nodeType == "" {
+			nodeType = NodeTypeAgent
+		}
+		agentName, _ := nodeConfig.Data["agent_name"].(string)
+		name, _ := nodeConfig.Data["name"].(string)
+		template, _ := nodeConfig.Data["prompt_template"].(string)
+		if name != "" {
+			if _, exists := dag.names[name]; exists {
+				return nil, fmt.Errorf("duplicate node name: %s", name)
+			}
+			dag.names[name] = nodeConfig.ID
+		}
 		node := &Node{
 			ID:         nodeConfig.ID,
+			Type:       nodeType,
+			Name:       name,
 			AgentID:    nodeConfig.AgentID,
+			AgentName:  agentName,
+			Template:   template,
 			Position:   nodeConfig.Position,
+			InputMap:   inputMap,
 			Config:     nodeConfig.Data,
 			DependsOn:  make([]string, 0),
 			Downstream: make([]string, 0),
 		}
+		if err := node.parseTypeConfig(nodeConfig.Data); err != nil {
+			return nil, fmt.Errorf("node %s: %w", nodeConfig.ID, err)
+		}
+		if node.SubWorkflow != nil && node.SubWorkflow.WorkflowID == workflow.ID {
+			return nil, fmt.Errorf("node %s: workflow cannot include itself", nodeConfig.ID)
+		}
 		dag.Nodes[node.ID] = node
 		dag.InDegrees[node.ID] = 0
 		dag.OutEdges[node.ID] = make([]string, 0)
 	}
 
-	// Add edges
-	for _, edgeConfig := range workflow.Edges {
+	// Add edges. Loop back-edges are kept apart so the graph stays acyclic.
+	// Edge state is tracked by edge ID, so IDs must be unique.
+	var loopEdges []store.EdgeConfig
+	edgeIDs := make(map[string]bool)
+	for _, edgeConfig := range withEdgeIDs(workflow.Edges) {
+		if edgeIDs[edgeConfig.ID] {
+			return nil, fmt.Errorf("duplicate edge id: %s", edgeConfig.ID)
+		}
+		edgeIDs[edgeConfig.ID] = true
+		if edgeConfig.Loop != nil {
+			loopEdges = append(loopEdges, edgeConfig)
+			continue
+		}
+		condition, err := compileCondition(edgeConfig.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("edge %s: %w", edgeConfig.ID, err)
+		}
 		edge := &Edge{
-			ID:     edgeConfig.ID,
-			Source: edgeConfig.Source,
-			Target: edgeConfig.Target,
+			ID:        edgeConfig.ID,
+			Source:    edgeConfig.Source,
+			Target:    edgeConfig.Target,
+			Label:     edgeConfig.Label,
+			Condition: condition,
+		}
+		if _, ok := dag.Nodes[edge.Source]; !ok {
+			return nil, fmt.Errorf("edge %s references unknown source node %s", edge.ID, edge.Source)
+		}
+		if _, ok := dag.Nodes[edge.Target]; !ok {
+			return nil, fmt.Errorf("edge %s references unknown target node %s", edge.ID, edge.Target)
 		}
 		dag.Edges = append(dag.Edges, edge)
 
 		// Build adjacency lists
+		dag.incoming[edge.Target] = append(dag.incoming[edge.Target], edge)
+		dag.outgoing[edge.Source] = append(dag.outgoing[edge.Source], edge)
 		dag.OutEdges[edge.Source] = append(dag.OutEdges[edge.Source], edge.Target)
 		dag.Nodes[edge.Target].DependsOn = append(dag.Nodes[edge.Target].DependsOn, edge.Source)
 		dag.InDegrees[edge.Target]++
@@ -80,9 +220,303 @@ func NewDAG(workflow *store.Workflow) (*DAG, error) {
 		return nil, err
 	}
 
+	for _, edgeConfig := range loopEdges {
+		if err := dag.addLoop(edgeConfig); err != nil {
+			return nil, fmt.Errorf("loop edge %s: %w", edgeConfig.ID, err)
+		}
+	}
+
+	if err := dag.validateTemplates(); err != nil {
+		return nil, err
+	}
+
+	if err := dag.validateRouters(); err != nil {
+		return nil, err
+	}
+
+	if err := dag.validateMaps(); err != nil {
+		return nil, err
+	}
+
 	return dag, nil
 }
 
+// parseTypeConfig validates the node type and reads its type-specific data
+func (n *Node) parseTypeConfig(data map[string]any) error {
+	var err error
+	switch n.Type {
+	case NodeTypeAgent, NodeTypeRouter:
+	case NodeTypeMap:
+		n.Map, err = parseMapConfig(data)
+	case NodeTypeSubWorkflow:
+		n.SubWorkflow, err = parseSubWorkflow(data)
+	case NodeTypeTransform:
+		if tpl, ok := data["template"].(string); ok && tpl != "" {
+			n.Template = tpl
+		}
+		if n.Template == "" {
+			return fmt.Errorf("transform node requires a template")
+		}
+		n.Format, _ = data["format"].(string)
+		if n.Format != "" && n.Format != "text" && n.Format != "json" {
+			return fmt.Errorf("unknown transform format %q", n.Format)
+		}
+	case NodeTypeHTTP:
+		n.HTTP, err = parseHTTPConfig(data)
+	case NodeTypeExpression:
+		src, _ := data["expression"].(string)
+		n.Expr, err = compileExpression(src)
+	case NodeTypeApproval:
+		n.Approval, err = parseApprovalConfig(data)
+	default:
+		return fmt.Errorf("unknown node type %q", n.Type)
+	}
+	return err
+}
+
+// templates returns every template string the node renders
+func (n *Node) templates() []string {
+	var tpls []string
+	if n.Template != "" {
+		tpls = append(tpls, n.Template)
+	}
+	if n.HTTP != nil {
+		tpls = append(tpls, n.HTTP.URL, n.HTTP.Body)
+		for _, v := range n.HTTP.Headers {
+			tpls = append(tpls, v)
+		}
+	}
+	return tpls
+}
+
+// IncomingEdges returns the edges ending at a node
+func (d *DAG) IncomingEdges(nodeID string) []*Edge {
+	return d.incoming[nodeID]
+}
+
+// OutgoingEdges returns the edges starting at a node
+func (d *DAG) OutgoingEdges(nodeID string) []*Edge {
+	return d.outgoing[nodeID]
+}
+
+// ResolveNode maps a node name or ID to its ID
+func (d *DAG) ResolveNode(ref string) (string, bool) {
+	if id, ok := d.names[ref]; ok {
+		return id, true
+	}
+	if _, ok := d.Nodes[ref]; ok {
+		return ref, true
+	}
+	return "", false
+}
+
+// Ancestors returns every node the given node transitively depends on
+func (d *DAG) Ancestors(nodeID string) map[string]bool {
+	ancestors := make(map[string]bool)
+	stack := append([]string(nil), d.Nodes[nodeID].DependsOn...)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if ancestors[id] {
+			continue
+		}
+		ancestors[id] = true
+		stack = append(stack, d.Nodes[id].DependsOn...)
+	}
+	return ancestors
+}
+
+// Descendants returns every node that transitively depends on the given node
+func (d *DAG) Descendants(nodeID string) map[string]bool {
+	descendants := make(map[string]bool)
+	stack := append([]string(nil), d.Nodes[nodeID].Downstream...)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if descendants[id] {
+			continue
+		}
+		descendants[id] = true
+		stack = append(stack, d.Nodes[id].Downstream...)
+	}
+	return descendants
+}
+
+// validateTemplates checks that every template and expression parses and
+// only references nodes upstream of the node using it
+func (d *DAG) validateTemplates() error {
+	for nodeID, node := range d.Nodes {
+		for _, tpl := range node.templates() {
+			refs, err := parseTemplate(tpl)
+			if err != nil {
+				return fmt.Errorf("node %s: %w", nodeID, err)
+			}
+			for _, ref := range refs {
+				if err := d.checkRef(nodeID, ref); err != nil {
+					return fmt.Errorf("node %s: template %w", nodeID, err)
+				}
+			}
+		}
+		if node.Expr != nil {
+			for _, name := range node.Expr.refs {
+				ref := templateRef{Raw: "nodes." + name, Kind: "nodes", Node: name}
+				if err := d.checkRef(nodeID, ref); err != nil {
+					return fmt.Errorf("node %s: expression %w", nodeID, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkRef checks that a reference used by a node is resolvable: node
+// references must point upstream, item references need a map node and loop
+// references a node inside a loop
+func (d *DAG) checkRef(nodeID string, ref templateRef) error {
+	switch ref.Kind {
+	case "loop":
+		if d.loopOf[nodeID] == nil {
+			return fmt.Errorf("references {{%s}} outside a loop", ref.Raw)
+		}
+	case "item":
+		if d.Nodes[nodeID].Type != NodeTypeMap {
+			return fmt.Errorf("references {{%s}} outside a map node", ref.Raw)
+		}
+	case "nodes":
+		refID, ok := d.ResolveNode(ref.Node)
+		if !ok {
+			return fmt.Errorf("references unknown node %q", ref.Node)
+		}
+		if !d.Ancestors(nodeID)[refID] {
+			return fmt.Errorf("references node %q which is not upstream", ref.Node)
+		}
+	}
+	return nil
+}
+
+// validateRouters checks that every router has outgoing edges with unique,
+// non-empty labels for the model to choose from
+func (d *DAG) validateRouters() error {
+	for nodeID, node := range d.Nodes {
+		if node.Type != NodeTypeRouter {
+			continue
+		}
+		edges := d.OutgoingEdges(nodeID)
+		if len(edges) == 0 {
+			return fmt.Errorf("router %s has no outgoing edges", nodeID)
+		}
+		seen := make(map[string]bool)
+		for _, edge := range edges {
+			label := strings.ToLower(strings.TrimSpace(edge.Label))
+			if label == "" {
+				return fmt.Errorf("router %s: edge %s needs a label", nodeID, edge.ID)
+			}
+			if seen[label] {
+				return fmt.Errorf("router %s: duplicate edge label %q", nodeID, edge.Label)
+			}
+			seen[label] = true
+		}
+	}
+	return nil
+}
+
+// validateMaps checks that every map node can locate its items
+func (d *DAG) validateMaps() error {
+	for nodeID, node := range d.Nodes {
+		if node.Type != NodeTypeMap {
+			continue
+		}
+		if node.Map.Items == "" {
+			if len(node.DependsOn) != 1 {
+				return fmt.Errorf("map %s: items is required unless the node has exactly one upstream node", nodeID)
+			}
+			continue
+		}
+		ref, err := parseRef(node.Map.Items)
+		if err != nil || ref.Kind == "item" {
+			return fmt.Errorf("map %s: invalid items reference %q", nodeID, node.Map.Items)
+		}
+		if err := d.checkRef(nodeID, ref); err != nil {
+			return fmt.Errorf("map %s: items %w", nodeID, err)
+		}
+	}
+	return nil
+}
+
+// RouteLabels returns the labels of a router's outgoing edges
+func (d *DAG) RouteLabels(nodeID string) []string {
+	edges := d.OutgoingEdges(nodeID)
+	labels := make([]string, 0, len(edges))
+	for _, edge := range edges {
+		labels = append(labels, strings.TrimSpace(edge.Label))
+	}
+	return labels
+}
+
+// parseInputMapping reads data.input_mapping, a map of label to workflow
+// input field path
+func parseInputMapping(data map[string]any) (map[string]string, error) {
+	raw, ok := data["input_mapping"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("input_mapping must be an object")
+	}
+	mapping := make(map[string]string, len(fields))
+	for label, v := range fields {
+		path, ok := v.(string)
+		if !ok || path == "" {
+			return nil, fmt.Errorf("input_mapping %q must be a field path string", label)
+		}
+		mapping[label] = path
+	}
+	return mapping, nil
+}
+
+// parseMapConfig reads data.items, data.concurrency and data.subgraph for a
+// map node. The sub-graph is validated as a workflow of its own.
+func parseMapConfig(data map[string]any) (*MapConfig, error) {
+	cfg := &MapConfig{Concurrency: defaultMapConcurrency}
+	if items, ok := data["items"]; ok && items != nil {
+		ref, ok := items.(string)
+		if !ok {
+			return nil, fmt.Errorf("items must be a reference string")
+		}
+		cfg.Items = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(ref), "{{"), "}}"))
+	}
+	if n, ok := data["concurrency"].(float64); ok {
+		if n < 1 {
+			return nil, fmt.Errorf("concurrency must be at least 1")
+		}
+		cfg.Concurrency = int(n)
+	}
+	if raw, ok := data["subgraph"]; ok && raw != nil {
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subgraph: %w", err)
+		}
+		var sub store.Workflow
+		if err := json.Unmarshal(b, &sub); err != nil {
+			return nil, fmt.Errorf("invalid subgraph: %w", err)
+		}
+		if len(sub.Nodes) == 0 {
+			return nil, fmt.Errorf("subgraph has no nodes")
+		}
+		if cfg.Subgraph, err = NewDAG(&sub); err != nil {
+			return nil, fmt.Errorf("subgraph: %w", err)
+		}
+		// Items share the map's execution, so their approvals could not be told apart
+		for nodeID, node := range cfg.Subgraph.Nodes {
+			if node.Type == NodeTypeApproval {
+				return nil, fmt.Errorf("subgraph: approval node %s is not supported inside a map", nodeID)
+			}
+		}
+	}
+	return cfg, nil
+}
+
 // Validate checks if the DAG is valid (no cycles)
 func (d *DAG) Validate() error {
 	visited := make(map[string]bool)
@@ -0,0 +1,334 @@
+package workflow
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+)
+
+func transformNode(id, template string) store.NodeConfig {
+	return typedNode(id, NodeTypeTransform, map[string]any{"template": template})
+}
+
+func TestNewDAGValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		nodes []store.NodeConfig
+		edges []store.EdgeConfig
+		err   string
+	}{
+		{
+			name:  "duplicate node id",
+			nodes: []store.NodeConfig{transformNode("a", "x"), transformNode("a", "y")},
+			err:   "duplicate node id",
+		},
+		{
+			name:  "duplicate edge id",
+			nodes: []store.NodeConfig{transformNode("a", "x"), transformNode("b", "y"), transformNode("c", "z")},
+			edges: []store.EdgeConfig{edge("e", "a", "b"), edge("e", "a", "c")},
+			err:   "duplicate edge id",
+		},
+		{
+			name:  "duplicate loop edge id",
+			nodes: []store.NodeConfig{transformNode("a", "x"), transformNode("b", "y")},
+			edges: []store.EdgeConfig{
+				edge("e", "a", "b"),
+				{ID: "e", Source: "b", Target: "a", Loop: &store.EdgeLoop{MaxIterations: 2}},
+			},
+			err: "duplicate edge id",
+		},
+		{
+			name:  "unknown target",
+			nodes: []store.NodeConfig{transformNode("a", "x")},
+			edges: []store.EdgeConfig{edge("e", "a", "missing")},
+			err:   "unknown target node",
+		},
+		{
+			name:  "cycle",
+			nodes: []store.NodeConfig{transformNode("a", "x"), transformNode("b", "y")},
+			edges: []store.EdgeConfig{edge("e1", "a", "b"), edge("e2", "b", "a")},
+			err:   "cycle",
+		},
+		{
+			name:  "unknown node type",
+			nodes: []store.NodeConfig{typedNode("a", "teleport", nil)},
+			err:   "unknown node type",
+		},
+		{
+			name:  "template references a downstream node",
+			nodes: []store.NodeConfig{transformNode("a", "{{nodes.b.output}}"), transformNode("b", "y")},
+			edges: []store.EdgeConfig{edge("e", "a", "b")},
+			err:   "not upstream",
+		},
+		{
+			name:  "bad condition",
+			nodes: []store.NodeConfig{transformNode("a", "x"), transformNode("b", "y")},
+			edges: []store.EdgeConfig{{ID: "e", Source: "a", Target: "b", Condition: &store.EdgeCondition{Type: "regex", Value: "("}}},
+			err:   "invalid regex",
+		},
+		{
+			name:  "router edge without label",
+			nodes: []store.NodeConfig{typedNode("r", NodeTypeRouter, nil), transformNode("b", "y")},
+			edges: []store.EdgeConfig{edge("e", "r", "b")},
+			err:   "needs a label",
+		},
+		{
+			name:  "valid",
+			nodes: []store.NodeConfig{transformNode("a", "x"), transformNode("b", "{{nodes.a.output}}")},
+			edges: []store.EdgeConfig{edge("e", "a", "b")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDAG(&store.Workflow{Nodes: tt.nodes, Edges: tt.edges})
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLegacyEdgeIDs(t *testing.T) {
+	wf := &store.Workflow{
+		Nodes: []store.NodeConfig{transformNode("a", "x"), transformNode("b", "y"), transformNode("c", "z")},
+		Edges: []store.EdgeConfig{
+			edge("", "a", "b"),
+			edge("a->c", "b", "c"),
+			edge("", "a", "c"),
+			{Source: "c", Target: "a", Loop: &store.EdgeLoop{MaxIterations: 2}},
+		},
+	}
+	want := []string{"a->b", "a->c", "a->c#2", "c->a"}
+	for load := 0; load < 2; load++ {
+		dag, err := NewDAG(wf)
+		if err != nil {
+			t.Fatalf("NewDAG: %v", err)
+		}
+		var ids []string
+		for _, edge := range dag.Edges {
+			ids = append(ids, edge.ID)
+		}
+		for _, loop := range dag.Loops {
+			ids = append(ids, loop.EdgeID)
+		}
+		sort.Strings(ids)
+		if strings.Join(ids, " ") != strings.Join(want, " ") {
+			t.Errorf("load %d: edge ids %v, want %v", load, ids, want)
+		}
+	}
+	if wf.Edges[0].ID != "" {
+		t.Error("NewDAG modified the workflow's edges")
+	}
+
+	// New and updated workflows must name their edges
+	if err := RequireEdgeIDs(wf.Edges); err == nil || !strings.Contains(err.Error(), "edge from a to b has no id") {
+		t.Errorf("RequireEdgeIDs = %v", err)
+	}
+	if err := RequireEdgeIDs([]store.EdgeConfig{edge("e", "a", "b")}); err != nil {
+		t.Errorf("RequireEdgeIDs = %v", err)
+	}
+}
+
+func TestDAGTraversal(t *testing.T) {
+	// a -> b -> d, a -> c -> d, e on its own
+	dag, err := NewDAG(&store.Workflow{
+		Nodes: []store.NodeConfig{
+			transformNode("a", "x"), transformNode("b", "x"), transformNode("c", "x"),
+			transformNode("d", "x"), transformNode("e", "x"),
+		},
+		Edges: []store.EdgeConfig{
+			edge("ab", "a", "b"), edge("ac", "a", "c"), edge("bd", "b", "d"), edge("cd", "c", "d"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewDAG: %v", err)
+	}
+
+	order := dag.TopologicalSort()
+	pos := make(map[string]int)
+	for i, id := range order {
+		pos[id] = i
+	}
+	if len(order) != 5 {
+		t.Fatalf("topological order %v misses nodes", order)
+	}
+	for _, e := range dag.Edges {
+		if pos[e.Source] > pos[e.Target] {
+			t.Errorf("%s sorted after %s in %v", e.Source, e.Target, order)
+		}
+	}
+
+	keys := func(m map[string]bool) string {
+		ids := make([]string, 0, len(m))
+		for id := range m {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return strings.Join(ids, ",")
+	}
+	if got := keys(dag.Ancestors("d")); got != "a,b,c" {
+		t.Errorf("ancestors of d = %s", got)
+	}
+	if got := keys(dag.Descendants("a")); got != "b,c,d" {
+		t.Errorf("descendants of a = %s", got)
+	}
+
+	ready := dag.GetReadyNodes(map[string]bool{"a": true, "b": true})
+	sort.Strings(ready)
+	if got := strings.Join(ready, ","); got != "c,e" {
+		t.Errorf("ready nodes = %s, want c,e", got)
+	}
+}
+
+func TestConditionEvaluate(t *testing.T) {
+	tests := []struct {
+		name   string
+		cond   store.EdgeCondition
+		output string
+		want   bool
+	}{
+		{"contains", store.EdgeCondition{Type: "contains", Value: "ok"}, "all OK", true},
+		{"contains case sensitive", store.EdgeCondition{Type: "contains", Value: "ok", CaseSensitive: true}, "all OK", false},
+		{"contains negated", store.EdgeCondition{Type: "contains", Value: "ok", Negate: true}, "all OK", false},
+		{"regex", store.EdgeCondition{Type: "regex", Value: `^score: \d+$`}, "Score: 42", true},
+		{"regex no match", store.EdgeCondition{Type: "regex", Value: `^\d+$`}, "n/a", false},
+		{"label text", store.EdgeCondition{Type: "label", Value: "approve"}, " Approve. ", true},
+		{"label json", store.EdgeCondition{Type: "label", Value: "reject"}, `{"label": "reject"}`, true},
+		{"label mismatch", store.EdgeCondition{Type: "label", Value: "reject"}, "rejected", false},
+		{"json eq", store.EdgeCondition{Type: "json", Path: "status", Value: "done"}, `{"status":"DONE"}`, true},
+		{"json ne", store.EdgeCondition{Type: "json", Path: "status", Operator: "ne", Value: "done"}, `{"status":"open"}`, true},
+		{"json gt", store.EdgeCondition{Type: "json", Path: "score", Operator: "gt", Value: "0.5"}, `{"score":0.7}`, true},
+		{"json lte", store.EdgeCondition{Type: "json", Path: "score", Operator: "lte", Value: "0.5"}, `{"score":0.7}`, false},
+		{"json gt on text", store.EdgeCondition{Type: "json", Path: "score", Operator: "gt", Value: "1"}, `{"score":"high"}`, false},
+		{"json nested", store.EdgeCondition{Type: "json", Path: "a.b", Operator: "contains", Value: "x"}, `{"a":{"b":"xyz"}}`, true},
+		{"json exists", store.EdgeCondition{Type: "json", Path: "a", Operator: "exists"}, `{"a":null}`, true},
+		{"json missing", store.EdgeCondition{Type: "json", Path: "b", Operator: "exists"}, `{"a":1}`, false},
+		{"json invalid output", store.EdgeCondition{Type: "json", Path: "a"}, "not json", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cond, err := compileCondition(&tt.cond)
+			if err != nil {
+				t.Fatalf("compileCondition: %v", err)
+			}
+			if got := cond.Evaluate(tt.output); got != tt.want {
+				t.Errorf("Evaluate(%q) = %v, want %v", tt.output, got, tt.want)
+			}
+		})
+	}
+
+	var none *Condition
+	if !none.Evaluate("anything") {
+		t.Error("an edge without a condition should always be taken")
+	}
+}
+
+func TestConditionalBranches(t *testing.T) {
+	// check -> pass when the output contains "ok", check -> fix otherwise;
+	// both join into report, which runs as long as one branch ran
+	wf := &store.Workflow{
+		Nodes: []store.NodeConfig{
+			transformNode("check", "{{input.result}}"),
+			transformNode("pass", "passed"),
+			transformNode("fix", "fixed"),
+			transformNode("report", "done"),
+			transformNode("after_fix", "after"),
+		},
+		Edges: []store.EdgeConfig{
+			{ID: "ok", Source: "check", Target: "pass", Condition: &store.EdgeCondition{Type: "contains", Value: "ok"}},
+			{ID: "not_ok", Source: "check", Target: "fix", Condition: &store.EdgeCondition{Type: "contains", Value: "ok", Negate: true}},
+			edge("pass_report", "pass", "report"),
+			edge("fix_report", "fix", "report"),
+			edge("fix_after", "fix", "after_fix"),
+		},
+	}
+
+	tests := []struct {
+		result string
+		ran    []string
+		skip   []string
+	}{
+		{"ok", []string{"check", "pass", "report"}, []string{"fix", "after_fix"}},
+		{"failed", []string{"check", "fix", "report", "after_fix"}, []string{"pass"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.result, func(t *testing.T) {
+			run := runScheduler(t, newTestScheduler(t, wf, nil, nil), map[string]any{"result": tt.result})
+			if run.err != nil {
+				t.Fatalf("Run: %v", run.err)
+			}
+			for _, id := range tt.ran {
+				if run.status(id) != NodeStatusSuccess {
+					t.Errorf("%s = %s, want success", id, run.status(id))
+				}
+			}
+			for _, id := range tt.skip {
+				if run.status(id) != NodeStatusSkipped {
+					t.Errorf("%s = %s, want skipped", id, run.status(id))
+				}
+			}
+		})
+	}
+}
+
+func TestRouterTakesChosenRoute(t *testing.T) {
+	agents := newTestAgents()
+	router := agents.add("router", nil)
+	exec := newFakeExecutor(func(system string, messages []agent.Message) *agent.Result {
+		return &agent.Result{ToolCalls: []agent.ToolCall{{
+			ID:       "call_1",
+			Function: agent.FunctionCall{Name: routeToolName, Arguments: map[string]any{"route": "billing"}},
+		}}}
+	})
+	wf := &store.Workflow{
+		Nodes: []store.NodeConfig{
+			agentNode("r", router, map[string]any{"type": NodeTypeRouter}),
+			transformNode("billing", "billing"),
+			transformNode("support", "support"),
+		},
+		Edges: []store.EdgeConfig{
+			{ID: "e1", Source: "r", Target: "billing", Label: "Billing"},
+			{ID: "e2", Source: "r", Target: "support", Label: "Support"},
+		},
+	}
+	run := runScheduler(t, newTestScheduler(t, wf, agents, exec), nil)
+	if run.err != nil {
+		t.Fatalf("Run: %v", run.err)
+	}
+	if run.status("billing") != NodeStatusSuccess || run.status("support") != NodeStatusSkipped {
+		t.Errorf("billing = %s, support = %s", run.status("billing"), run.status("support"))
+	}
+}
+
+func TestFrozenRouterTakesEditedRoute(t *testing.T) {
+	// A replay restores an edited router with its new route; only that
+	// branch runs
+	agents := newTestAgents()
+	router := agents.add("router", nil)
+	wf := &store.Workflow{
+		Nodes: []store.NodeConfig{
+			agentNode("r", router, map[string]any{"type": NodeTypeRouter}),
+			transformNode("billing", "billing {{nodes.r.output}}"),
+			transformNode("support", "support"),
+		},
+		Edges: []store.EdgeConfig{
+			{ID: "e1", Source: "r", Target: "billing", Label: "Billing"},
+			{ID: "e2", Source: "r", Target: "support", Label: "Support"},
+		},
+	}
+	s := newTestScheduler(t, wf, agents, nil)
+	s.Freeze([]store.NodeSnapshot{{NodeID: "r", Status: NodeStatusSuccess, Route: "Billing", Edited: true, FinalOutput: "refund"}})
+	run := runScheduler(t, s, nil)
+	if run.err != nil {
+		t.Fatalf("Run: %v", run.err)
+	}
+	if run.output("billing") != "billing refund" || run.status("support") != NodeStatusSkipped {
+		t.Errorf("billing = %q, support = %s", run.output("billing"), run.status("support"))
+	}
+}
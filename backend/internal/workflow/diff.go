@@ -0,0 +1,288 @@
+package workflow
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+)
+
+// EstimatedCostPerToken is the rough cost estimate applied to token counts
+const EstimatedCostPerToken = 0.00001
+
+// Node changes between two executions
+const (
+	NodeRerun   = "rerun"
+	NodeFrozen  = "frozen"
+	NodeEdited  = "edited"
+	NodeAdded   = "added"
+	NodeRemoved = "removed"
+)
+
+// maxDiffCells bounds the line comparison; larger outputs are reported as
+// replaced as a whole
+const maxDiffCells = 1 << 20
+
+// Usage sums the tokens, latency and estimated cost of steps
+type Usage struct {
+	Tokens    int     `json:"tokens"`
+	LatencyMs int64   `json:"latency_ms"`
+	Cost      float64 `json:"cost"`
+}
+
+// DiffLine is one line of a textual diff. Op is equal, insert or delete.
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// NodeDiff compares one node across two executions. Change is frozen when
+// a replay carried the other execution's result over, edited when it carried
+// it over with an edited output, rerun when the node ran again, and added or
+// removed when only the second or first execution has it. Delta is zero for
+// carried-over nodes, since neither execution spent anything on them anew.
+type NodeDiff struct {
+	NodeID        string     `json:"node_id"`
+	Change        string     `json:"change"`
+	StatusA       string     `json:"status_a,omitempty"`
+	StatusB       string     `json:"status_b,omitempty"`
+	OutputChanged bool       `json:"output_changed"`
+	OutputDiff    []DiffLine `json:"output_diff,omitempty"`
+	UsageA        Usage      `json:"usage_a"`
+	UsageB        Usage      `json:"usage_b"`
+	Delta         Usage      `json:"delta"`
+}
+
+// Divergence is a node both executions ran that continued along different
+// branches
+type Divergence struct {
+	NodeID string   `json:"node_id"`
+	RouteA string   `json:"route_a,omitempty"`
+	RouteB string   `json:"route_b,omitempty"`
+	NextA  []string `json:"next_a"`
+	NextB  []string `json:"next_b"`
+}
+
+// PathDiff lists the nodes only one execution ran and where the paths split
+type PathDiff struct {
+	OnlyA      []string     `json:"only_a"`
+	OnlyB      []string     `json:"only_b"`
+	Divergence []Divergence `json:"divergence"`
+}
+
+// SnapshotDiff compares two executions of a workflow. TotalA, TotalB and
+// Delta leave out frozen and edited nodes, whose usage is reported once in
+// CarriedOver.
+type SnapshotDiff struct {
+	Nodes       []NodeDiff `json:"nodes"`
+	Path        PathDiff   `json:"path"`
+	TotalA      Usage      `json:"total_a"`
+	TotalB      Usage      `json:"total_b"`
+	Delta       Usage      `json:"delta"`
+	CarriedOver Usage      `json:"carried_over"`
+}
+
+// DiffSnapshots compares the node results of two executions. Deltas are B
+// minus A.
+func DiffSnapshots(a, b store.Snapshot) *SnapshotDiff {
+	nodesA := snapshotNodes(a)
+	nodesB := snapshotNodes(b)
+
+	ids := make([]string, 0, len(nodesA)+len(nodesB))
+	for id := range nodesA {
+		ids = append(ids, id)
+	}
+	for id := range nodesB {
+		if _, ok := nodesA[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	diff := &SnapshotDiff{
+		Nodes: make([]NodeDiff, 0, len(ids)),
+		Path:  PathDiff{OnlyA: []string{}, OnlyB: []string{}, Divergence: []Divergence{}},
+	}
+	for _, id := range ids {
+		nodeA, inA := nodesA[id]
+		nodeB, inB := nodesB[id]
+		d := NodeDiff{
+			NodeID:  id,
+			StatusA: nodeA.Status,
+			StatusB: nodeB.Status,
+			UsageA:  stepUsage(nodeA.Steps),
+			UsageB:  stepUsage(nodeB.Steps),
+		}
+		switch {
+		case !inA:
+			d.Change = NodeAdded
+		case !inB:
+			d.Change = NodeRemoved
+		case carriedOver(nodeA, nodeB) && nodeA.FinalOutput != nodeB.FinalOutput:
+			d.Change = NodeEdited
+		case carriedOver(nodeA, nodeB):
+			d.Change = NodeFrozen
+		default:
+			d.Change = NodeRerun
+		}
+		if nodeA.FinalOutput != nodeB.FinalOutput {
+			d.OutputChanged = true
+			d.OutputDiff = diffLines(nodeA.FinalOutput, nodeB.FinalOutput)
+		}
+		if d.Change == NodeFrozen || d.Change == NodeEdited {
+			diff.CarriedOver = diff.CarriedOver.add(d.UsageA)
+		} else {
+			d.Delta = d.UsageB.sub(d.UsageA)
+			diff.TotalA = diff.TotalA.add(d.UsageA)
+			diff.TotalB = diff.TotalB.add(d.UsageB)
+		}
+		diff.Nodes = append(diff.Nodes, d)
+
+		ranA, ranB := inA && ran(nodeA), inB && ran(nodeB)
+		switch {
+		case ranA && !ranB:
+			diff.Path.OnlyA = append(diff.Path.OnlyA, id)
+		case ranB && !ranA:
+			diff.Path.OnlyB = append(diff.Path.OnlyB, id)
+		case ranA && ranB:
+			nextA := nextNodes(a.Edges, nodesA, id)
+			nextB := nextNodes(b.Edges, nodesB, id)
+			if nodeA.Route != nodeB.Route || strings.Join(nextA, "\x00") != strings.Join(nextB, "\x00") {
+				diff.Path.Divergence = append(diff.Path.Divergence, Divergence{
+					NodeID: id,
+					RouteA: nodeA.Route,
+					RouteB: nodeB.Route,
+					NextA:  nextA,
+					NextB:  nextB,
+				})
+			}
+		}
+	}
+	diff.Delta = diff.TotalB.sub(diff.TotalA)
+	return diff
+}
+
+func snapshotNodes(snapshot store.Snapshot) map[string]store.NodeSnapshot {
+	nodes := make(map[string]store.NodeSnapshot, len(snapshot.Nodes))
+	for _, node := range snapshot.Nodes {
+		nodes[node.NodeID] = node
+	}
+	return nodes
+}
+
+// carriedOver reports whether one node result is the other frozen by a
+// replay, recognised by their shared steps
+func carriedOver(a, b store.NodeSnapshot) bool {
+	if !a.Frozen && !b.Frozen || len(a.Steps) != len(b.Steps) {
+		return false
+	}
+	for i := range a.Steps {
+		if a.Steps[i].StepID != b.Steps[i].StepID {
+			return false
+		}
+	}
+	return true
+}
+
+// ran reports whether a node ran rather than being skipped or cancelled.
+// Snapshots from before node statuses were recorded have none.
+func ran(node store.NodeSnapshot) bool {
+	return node.Status != NodeStatusSkipped && node.Status != NodeStatusCancelled
+}
+
+// nextNodes returns the nodes directly after nodeID that ran
+func nextNodes(edges []store.EdgeConfig, nodes map[string]store.NodeSnapshot, nodeID string) []string {
+	next := []string{}
+	for _, edge := range edges {
+		if edge.Source != nodeID || edge.Loop != nil {
+			continue
+		}
+		if target, ok := nodes[edge.Target]; ok && ran(target) {
+			next = append(next, edge.Target)
+		}
+	}
+	sort.Strings(next)
+	return next
+}
+
+func stepUsage(steps []store.Step) Usage {
+	var u Usage
+	for _, step := range steps {
+		u.Tokens += step.Tokens
+		u.LatencyMs += step.LatencyMs
+	}
+	u.Cost = float64(u.Tokens) * EstimatedCostPerToken
+	return u
+}
+
+func (u Usage) add(o Usage) Usage {
+	return Usage{Tokens: u.Tokens + o.Tokens, LatencyMs: u.LatencyMs + o.LatencyMs, Cost: u.Cost + o.Cost}
+}
+
+func (u Usage) sub(o Usage) Usage {
+	return Usage{Tokens: u.Tokens - o.Tokens, LatencyMs: u.LatencyMs - o.LatencyMs, Cost: u.Cost - o.Cost}
+}
+
+// diffLines computes a line diff from a to b using their longest common
+// subsequence of lines
+func diffLines(a, b string) []DiffLine {
+	linesA := strings.Split(a, "\n")
+	linesB := strings.Split(b, "\n")
+	if a == "" {
+		linesA = nil
+	}
+	if b == "" {
+		linesB = nil
+	}
+
+	n, m := len(linesA), len(linesB)
+	if n*m > maxDiffCells {
+		diff := make([]DiffLine, 0, n+m)
+		for _, line := range linesA {
+			diff = append(diff, DiffLine{Op: "delete", Text: line})
+		}
+		for _, line := range linesB {
+			diff = append(diff, DiffLine{Op: "insert", Text: line})
+		}
+		return diff
+	}
+
+	// lcs[i][j] is the common subsequence length of linesA[i:] and linesB[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if linesA[i] == linesB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	diff := make([]DiffLine, 0, max(n, m))
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case linesA[i] == linesB[j]:
+			diff = append(diff, DiffLine{Op: "equal", Text: linesA[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Op: "delete", Text: linesA[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: "insert", Text: linesB[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		diff = append(diff, DiffLine{Op: "delete", Text: linesA[i]})
+	}
+	for ; j < m; j++ {
+		diff = append(diff, DiffLine{Op: "insert", Text: linesB[j]})
+	}
+	return diff
+}
@@ -0,0 +1,124 @@
+package workflow
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "x\ny", "x\ny", "=x =y"},
+		{"both empty", "", "", ""},
+		{"from empty", "", "x", "+x"},
+		{"to empty", "x\ny", "", "-x -y"},
+		{"insert", "a\nc", "a\nb\nc", "=a +b =c"},
+		{"delete", "a\nb\nc", "a\nc", "=a -b =c"},
+		{"replace", "a\nb\nc", "a\nB\nc", "=a -b +B =c"},
+		{"keeps the longest common lines", "a\nb\nc\nd", "b\nc\nx", "-a =b =c -d +x"},
+	}
+	ops := map[string]string{"equal": "=", "insert": "+", "delete": "-"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, line := range diffLines(tt.a, tt.b) {
+				got = append(got, ops[line.Op]+line.Text)
+			}
+			if s := strings.Join(got, " "); s != tt.want {
+				t.Errorf("diffLines = %q, want %q", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesLargeOutputs(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 1100; i++ {
+		a = append(a, fmt.Sprint("a", i))
+		b = append(b, fmt.Sprint("b", i))
+	}
+	diff := diffLines(strings.Join(a, "\n"), strings.Join(b, "\n"))
+	if len(diff) != 2200 || diff[0].Op != "delete" || diff[2199].Op != "insert" {
+		t.Errorf("got %d lines, want every line replaced", len(diff))
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	steps := func(id string, tokens int) []store.Step {
+		return []store.Step{{StepID: id, Tokens: tokens, LatencyMs: int64(tokens)}}
+	}
+	edges := []store.EdgeConfig{
+		{ID: "e1", Source: "plan", Target: "check"},
+		{ID: "e2", Source: "check", Target: "pass"},
+		{ID: "e3", Source: "check", Target: "fix"},
+		{ID: "e4", Source: "pass", Target: "report"},
+		{ID: "e5", Source: "fix", Target: "report"},
+	}
+	a := store.Snapshot{Edges: edges, Nodes: []store.NodeSnapshot{
+		{NodeID: "plan", Status: NodeStatusSuccess, FinalOutput: "plan", Steps: steps("p", 100)},
+		{NodeID: "check", Status: NodeStatusSuccess, FinalOutput: "bad", Steps: steps("c", 10)},
+		{NodeID: "pass", Status: NodeStatusSkipped},
+		{NodeID: "fix", Status: NodeStatusSuccess, FinalOutput: "fixed", Steps: steps("f", 20)},
+		{NodeID: "report", Status: NodeStatusSuccess, FinalOutput: "one\ntwo", Steps: steps("r", 30)},
+		{NodeID: "old", Status: NodeStatusSuccess, Steps: steps("o", 5)},
+	}}
+	// A replay froze plan, edited check and reran the rest
+	b := store.Snapshot{Edges: edges, Nodes: []store.NodeSnapshot{
+		{NodeID: "plan", Status: NodeStatusSuccess, Frozen: true, FinalOutput: "plan", Steps: steps("p", 100)},
+		{NodeID: "check", Status: NodeStatusSuccess, Frozen: true, Edited: true, FinalOutput: "ok", Steps: steps("c", 10)},
+		{NodeID: "pass", Status: NodeStatusSuccess, FinalOutput: "passed", Steps: steps("p2", 15)},
+		{NodeID: "fix", Status: NodeStatusSkipped},
+		{NodeID: "report", Status: NodeStatusSuccess, FinalOutput: "one\nthree", Steps: steps("r2", 40)},
+		{NodeID: "new", Status: NodeStatusSuccess, Steps: steps("n", 1)},
+	}}
+
+	diff := DiffSnapshots(a, b)
+	changes := make(map[string]NodeDiff)
+	for _, d := range diff.Nodes {
+		changes[d.NodeID] = d
+	}
+	want := map[string]string{
+		"plan": NodeFrozen, "check": NodeEdited, "pass": NodeRerun, "fix": NodeRerun,
+		"report": NodeRerun, "old": NodeRemoved, "new": NodeAdded,
+	}
+	for id, change := range want {
+		if got := changes[id].Change; got != change {
+			t.Errorf("%s change = %s, want %s", id, got, change)
+		}
+	}
+
+	report := changes["report"]
+	if !report.OutputChanged || len(report.OutputDiff) != 3 || report.Delta.Tokens != 10 {
+		t.Errorf("report diff = %+v", report)
+	}
+	if plan := changes["plan"]; plan.OutputChanged || plan.Delta != (Usage{}) {
+		t.Errorf("frozen plan = %+v, want no change and no delta", plan)
+	}
+
+	// Carried-over nodes were not spent again and count only once
+	if diff.CarriedOver.Tokens != 110 {
+		t.Errorf("carried over = %d tokens, want 110", diff.CarriedOver.Tokens)
+	}
+	if diff.TotalA.Tokens != 55 || diff.TotalB.Tokens != 56 || diff.Delta.Tokens != 1 {
+		t.Errorf("totals = %d, %d, delta %d; want 55, 56, 1", diff.TotalA.Tokens, diff.TotalB.Tokens, diff.Delta.Tokens)
+	}
+
+	if got := strings.Join(diff.Path.OnlyA, ","); got != "fix,old" {
+		t.Errorf("only a = %s", got)
+	}
+	if got := strings.Join(diff.Path.OnlyB, ","); got != "new,pass" {
+		t.Errorf("only b = %s", got)
+	}
+	if len(diff.Path.Divergence) != 1 || diff.Path.Divergence[0].NodeID != "check" {
+		t.Fatalf("divergence = %+v, want the paths to split at check", diff.Path.Divergence)
+	}
+	if d := diff.Path.Divergence[0]; strings.Join(d.NextA, ",") != "fix" || strings.Join(d.NextB, ",") != "pass" {
+		t.Errorf("divergence = %+v", d)
+	}
+}
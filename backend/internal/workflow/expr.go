@@ -0,0 +1,836 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Limits that keep expressions cheap to parse and evaluate
+const (
+	maxExprLength = 4096
+	maxExprDepth  = 64
+)
+
+// Expression is a compiled expression for expression nodes. The language
+// works on JSON values and has no loops, assignments or I/O:
+//
+//	literals     42, 1.5, "text", 'text', true, false, null, [1, 2], {a: 1}
+//	variables    input (the workflow input), nodes (upstream outputs by name or ID)
+//	access       input.user.name, nodes.scorer.score, list[0], obj["key"]
+//	operators    + - * / %  == != < <= > >=  && || !  cond ? a : b
+//	functions    len upper lower trim contains startsWith endsWith split join
+//	             keys values number string json parse round floor ceil abs
+//	             min max default
+//
+// Node outputs that are valid JSON are exposed as values, others as text.
+// Libraries such as CEL or expr bring their own type systems and a large
+// dependency; this evaluator renders values with formatValue as templates
+// and conditions do, and its length and depth limits bound the work an
+// expression from a workflow definition can cause.
+type Expression struct {
+	Source string
+	root   exprNode
+	refs   []string
+}
+
+// compileExpression parses an expression and records the nodes it references
+func compileExpression(src string) (*Expression, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, fmt.Errorf("expression is empty")
+	}
+	if len(src) > maxExprLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", maxExprLength)
+	}
+	tokens, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseTernary(0)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at offset %d", tok.text, tok.pos)
+	}
+	return &Expression{Source: src, root: root, refs: p.refs}, nil
+}
+
+// Eval evaluates the expression against the given variables
+func (e *Expression) Eval(vars map[string]any) (any, error) {
+	return e.root.eval(vars)
+}
+
+// lexer
+
+const (
+	tokEOF = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokPunct
+)
+
+type exprToken struct {
+	kind int
+	text string
+	num  float64
+	pos  int
+}
+
+var exprPuncts = []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "+", "-", "*", "/", "%", "!", "?", ":", ".", ",", "(", ")", "[", "]", "{", "}"}
+
+func lexExpr(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.' || src[i] == 'e' || src[i] == 'E' ||
+				(src[i] == '+' || src[i] == '-') && (src[i-1] == 'e' || src[i-1] == 'E')) {
+				i++
+			}
+			n, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at offset %d", src[start:i], start)
+			}
+			tokens = append(tokens, exprToken{kind: tokNumber, text: src[start:i], num: n, pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(src) {
+					return nil, fmt.Errorf("unterminated string at offset %d", start)
+				}
+				if src[i] == c {
+					i++
+					break
+				}
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+					switch src[i] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(src[i])
+					}
+					i++
+					continue
+				}
+				b.WriteByte(src[i])
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokString, text: b.String(), pos: start})
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			start := i
+			for i < len(src) && (src[i] == '_' || src[i] >= 'a' && src[i] <= 'z' || src[i] >= 'A' && src[i] <= 'Z' || src[i] >= '0' && src[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokIdent, text: src[start:i], pos: start})
+		default:
+			matched := false
+			for _, p := range exprPuncts {
+				if strings.HasPrefix(src[i:], p) {
+					tokens = append(tokens, exprToken{kind: tokPunct, text: p, pos: i})
+					i += len(p)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+		}
+	}
+	return append(tokens, exprToken{kind: tokEOF, text: "end of expression", pos: len(src)}), nil
+}
+
+// parser
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+	refs   []string
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) accept(punct string) bool {
+	if tok := p.peek(); tok.kind == tokPunct && tok.text == punct {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(punct string) error {
+	if !p.accept(punct) {
+		tok := p.peek()
+		return fmt.Errorf("expected %q at offset %d, got %q", punct, tok.pos, tok.text)
+	}
+	return nil
+}
+
+// Precedence climbing, lowest first
+var exprBinaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *exprParser) parseTernary(depth int) (exprNode, error) {
+	if depth > maxExprDepth {
+		return nil, fmt.Errorf("expression is nested too deeply")
+	}
+	cond, err := p.parseBinary(0, depth)
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("?") {
+		return cond, nil
+	}
+	a, err := p.parseTernary(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	b, err := p.parseTernary(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	return &condNode{cond: cond, a: a, b: b}, nil
+}
+
+func (p *exprParser) parseBinary(level, depth int) (exprNode, error) {
+	if level == len(exprBinaryLevels) {
+		return p.parseUnary(depth)
+	}
+	left, err := p.parseBinary(level+1, depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		op := ""
+		if tok.kind == tokPunct {
+			for _, candidate := range exprBinaryLevels[level] {
+				if tok.text == candidate {
+					op = candidate
+				}
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseBinary(level+1, depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, l: left, r: right}
+	}
+}
+
+func (p *exprParser) parseUnary(depth int) (exprNode, error) {
+	if depth > maxExprDepth {
+		return nil, fmt.Errorf("expression is nested too deeply")
+	}
+	if tok := p.peek(); tok.kind == tokPunct && (tok.text == "!" || tok.text == "-") {
+		p.next()
+		x, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: tok.text, x: x}, nil
+	}
+	return p.parsePostfix(depth)
+}
+
+func (p *exprParser) parsePostfix(depth int) (exprNode, error) {
+	x, err := p.parsePrimary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("."):
+			tok := p.next()
+			if tok.kind != tokIdent {
+				return nil, fmt.Errorf("expected field name at offset %d", tok.pos)
+			}
+			if id, ok := x.(*identNode); ok && id.name == "nodes" {
+				p.refs = append(p.refs, tok.text)
+			}
+			x = &memberNode{obj: x, key: &literalNode{v: tok.text}}
+		case p.accept("["):
+			key, err := p.parseTernary(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			if id, ok := x.(*identNode); ok && id.name == "nodes" {
+				if lit, ok := key.(*literalNode); ok {
+					if name, ok := lit.v.(string); ok {
+						p.refs = append(p.refs, name)
+					}
+				}
+			}
+			x = &memberNode{obj: x, key: key}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *exprParser) parsePrimary(depth int) (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		return &literalNode{v: tok.num}, nil
+	case tokString:
+		return &literalNode{v: tok.text}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return &literalNode{v: true}, nil
+		case "false":
+			return &literalNode{v: false}, nil
+		case "null":
+			return &literalNode{v: nil}, nil
+		case "input", "nodes":
+			return &identNode{name: tok.text}, nil
+		}
+		fn, ok := exprFuncs[tok.text]
+		if !ok {
+			return nil, fmt.Errorf("unknown identifier %q at offset %d", tok.text, tok.pos)
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		var args []exprNode
+		for !p.accept(")") {
+			if len(args) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			arg, err := p.parseTernary(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+		if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+			return nil, fmt.Errorf("wrong number of arguments to %s", tok.text)
+		}
+		return &callNode{name: tok.text, fn: fn.call, args: args}, nil
+	case tokPunct:
+		switch tok.text {
+		case "(":
+			x, err := p.parseTernary(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			arr := &arrayNode{}
+			for !p.accept("]") {
+				if len(arr.elems) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				elem, err := p.parseTernary(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				arr.elems = append(arr.elems, elem)
+			}
+			return arr, nil
+		case "{":
+			obj := &objectNode{}
+			for !p.accept("}") {
+				if len(obj.keys) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				key := p.next()
+				if key.kind != tokIdent && key.kind != tokString {
+					return nil, fmt.Errorf("expected object key at offset %d", key.pos)
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				val, err := p.parseTernary(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				obj.keys = append(obj.keys, key.text)
+				obj.vals = append(obj.vals, val)
+			}
+			return obj, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at offset %d", tok.text, tok.pos)
+}
+
+// evaluation
+
+type exprNode interface {
+	eval(vars map[string]any) (any, error)
+}
+
+type literalNode struct{ v any }
+
+func (n *literalNode) eval(map[string]any) (any, error) { return n.v, nil }
+
+type identNode struct{ name string }
+
+func (n *identNode) eval(vars map[string]any) (any, error) { return vars[n.name], nil }
+
+type memberNode struct{ obj, key exprNode }
+
+func (n *memberNode) eval(vars map[string]any) (any, error) {
+	obj, err := n.obj.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	key, err := n.key.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch o := obj.(type) {
+	case map[string]any:
+		k, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("object key must be a string")
+		}
+		return o[k], nil
+	case []any:
+		i, ok := key.(float64)
+		if !ok || i != math.Trunc(i) {
+			return nil, fmt.Errorf("array index must be an integer")
+		}
+		if i < 0 {
+			i += float64(len(o))
+		}
+		// Compare before converting, since int() of a huge float wraps
+		if i < 0 || i >= float64(len(o)) {
+			return nil, nil
+		}
+		return o[int(i)], nil
+	case nil:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("cannot access %s of %s", formatValue(key), exprType(obj))
+}
+
+type unaryNode struct {
+	op string
+	x  exprNode
+}
+
+func (n *unaryNode) eval(vars map[string]any) (any, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !truthy(x), nil
+	}
+	f, ok := x.(float64)
+	if !ok {
+		return nil, fmt.Errorf("cannot negate %s", exprType(x))
+	}
+	return -f, nil
+}
+
+type binaryNode struct {
+	op   string
+	l, r exprNode
+}
+
+func (n *binaryNode) eval(vars map[string]any) (any, error) {
+	l, err := n.l.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	// Logical operators short-circuit
+	switch n.op {
+	case "&&":
+		if !truthy(l) {
+			return false, nil
+		}
+		r, err := n.r.eval(vars)
+		return truthy(r), err
+	case "||":
+		if truthy(l) {
+			return true, nil
+		}
+		r, err := n.r.eval(vars)
+		return truthy(r), err
+	}
+
+	r, err := n.r.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(l, r), nil
+	case "!=":
+		return !reflect.DeepEqual(l, r), nil
+	case "+":
+		if la, ok := l.([]any); ok {
+			if ra, ok := r.([]any); ok {
+				return append(append([]any{}, la...), ra...), nil
+			}
+		}
+		_, ls := l.(string)
+		_, rs := r.(string)
+		if ls || rs {
+			return formatValue(l) + formatValue(r), nil
+		}
+	case "<", "<=", ">", ">=":
+		if ls, ok := l.(string); ok {
+			if rs, ok := r.(string); ok {
+				return compareOrdered(n.op, strings.Compare(ls, rs)), nil
+			}
+		}
+	}
+
+	lf, lok := l.(float64)
+	rf, rok := r.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %s does not apply to %s and %s", n.op, exprType(l), exprType(r))
+	}
+	switch n.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return lf / rf, nil
+	case "%":
+		if rf == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(lf, rf), nil
+	}
+	cmp := 0
+	if lf < rf {
+		cmp = -1
+	} else if lf > rf {
+		cmp = 1
+	}
+	return compareOrdered(n.op, cmp), nil
+}
+
+func compareOrdered(op string, cmp int) bool {
+	switch op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+type condNode struct{ cond, a, b exprNode }
+
+func (n *condNode) eval(vars map[string]any) (any, error) {
+	c, err := n.cond.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if truthy(c) {
+		return n.a.eval(vars)
+	}
+	return n.b.eval(vars)
+}
+
+type arrayNode struct{ elems []exprNode }
+
+func (n *arrayNode) eval(vars map[string]any) (any, error) {
+	out := make([]any, len(n.elems))
+	for i, elem := range n.elems {
+		v, err := elem.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+type objectNode struct {
+	keys []string
+	vals []exprNode
+}
+
+func (n *objectNode) eval(vars map[string]any) (any, error) {
+	out := make(map[string]any, len(n.keys))
+	for i, key := range n.keys {
+		v, err := n.vals[i].eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		out[key] = v
+	}
+	return out, nil
+}
+
+type callNode struct {
+	name string
+	fn   func(args []any) (any, error)
+	args []exprNode
+}
+
+func (n *callNode) eval(vars map[string]any) (any, error) {
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := n.fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return v, nil
+}
+
+func truthy(v any) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case float64:
+		return x != 0
+	case string:
+		return x != ""
+	case []any:
+		return len(x) > 0
+	case map[string]any:
+		return len(x) > 0
+	}
+	return true
+}
+
+func exprType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// functions
+
+type exprFunc struct {
+	minArgs, maxArgs int // maxArgs -1 means variadic
+	call             func(args []any) (any, error)
+}
+
+var exprFuncs map[string]exprFunc
+
+func init() {
+	str := func(f func(string) any) func([]any) (any, error) {
+		return func(args []any) (any, error) { return f(formatValue(args[0])), nil }
+	}
+	num := func(f func(float64) float64) func([]any) (any, error) {
+		return func(args []any) (any, error) {
+			x, ok := args[0].(float64)
+			if !ok {
+				return nil, fmt.Errorf("expected a number, got %s", exprType(args[0]))
+			}
+			return f(x), nil
+		}
+	}
+	// entries maps an object's keys, in order, to an array
+	entries := func(f func(obj map[string]any, k string) any) func([]any) (any, error) {
+		return func(args []any) (any, error) {
+			obj, ok := args[0].(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("expected an object, got %s", exprType(args[0]))
+			}
+			keys := sortedKeys(obj)
+			out := make([]any, len(keys))
+			for i, k := range keys {
+				out[i] = f(obj, k)
+			}
+			return out, nil
+		}
+	}
+	extreme := func(less bool) func([]any) (any, error) {
+		return func(args []any) (any, error) {
+			values := args
+			if len(args) == 1 {
+				if arr, ok := args[0].([]any); ok {
+					values = arr
+				}
+			}
+			var best any
+			for _, v := range values {
+				f, ok := v.(float64)
+				if !ok {
+					return nil, fmt.Errorf("expected numbers, got %s", exprType(v))
+				}
+				if b, ok := best.(float64); !ok || (less && f < b) || (!less && f > b) {
+					best = f
+				}
+			}
+			return best, nil
+		}
+	}
+
+	exprFuncs = map[string]exprFunc{
+		"len": {1, 1, func(args []any) (any, error) {
+			switch x := args[0].(type) {
+			case string:
+				return float64(len([]rune(x))), nil
+			case []any:
+				return float64(len(x)), nil
+			case map[string]any:
+				return float64(len(x)), nil
+			case nil:
+				return float64(0), nil
+			}
+			return nil, fmt.Errorf("no length for %s", exprType(args[0]))
+		}},
+		"upper": {1, 1, str(func(s string) any { return strings.ToUpper(s) })},
+		"lower": {1, 1, str(func(s string) any { return strings.ToLower(s) })},
+		"trim":  {1, 1, str(func(s string) any { return strings.TrimSpace(s) })},
+		"contains": {2, 2, func(args []any) (any, error) {
+			if arr, ok := args[0].([]any); ok {
+				for _, v := range arr {
+					if reflect.DeepEqual(v, args[1]) {
+						return true, nil
+					}
+				}
+				return false, nil
+			}
+			if obj, ok := args[0].(map[string]any); ok {
+				_, found := obj[formatValue(args[1])]
+				return found, nil
+			}
+			return strings.Contains(formatValue(args[0]), formatValue(args[1])), nil
+		}},
+		"startsWith": {2, 2, func(args []any) (any, error) {
+			return strings.HasPrefix(formatValue(args[0]), formatValue(args[1])), nil
+		}},
+		"endsWith": {2, 2, func(args []any) (any, error) {
+			return strings.HasSuffix(formatValue(args[0]), formatValue(args[1])), nil
+		}},
+		"split": {2, 2, func(args []any) (any, error) {
+			parts := strings.Split(formatValue(args[0]), formatValue(args[1]))
+			out := make([]any, len(parts))
+			for i, p := range parts {
+				out[i] = p
+			}
+			return out, nil
+		}},
+		"join": {1, 2, func(args []any) (any, error) {
+			arr, ok := args[0].([]any)
+			if !ok {
+				return nil, fmt.Errorf("expected an array, got %s", exprType(args[0]))
+			}
+			sep := ""
+			if len(args) == 2 {
+				sep = formatValue(args[1])
+			}
+			parts := make([]string, len(arr))
+			for i, v := range arr {
+				parts[i] = formatValue(v)
+			}
+			return strings.Join(parts, sep), nil
+		}},
+		"keys":   {1, 1, entries(func(obj map[string]any, k string) any { return k })},
+		"values": {1, 1, entries(func(obj map[string]any, k string) any { return obj[k] })},
+		"number": {1, 1, func(args []any) (any, error) {
+			switch x := args[0].(type) {
+			case float64:
+				return x, nil
+			case bool:
+				if x {
+					return float64(1), nil
+				}
+				return float64(0), nil
+			}
+			f, err := strconv.ParseFloat(strings.TrimSpace(formatValue(args[0])), 64)
+			if err != nil {
+				return nil, fmt.Errorf("not a number: %s", formatValue(args[0]))
+			}
+			return f, nil
+		}},
+		"string": {1, 1, str(func(s string) any { return s })},
+		"json": {1, 1, func(args []any) (any, error) {
+			b, err := json.Marshal(args[0])
+			return string(b), err
+		}},
+		"parse": {1, 1, func(args []any) (any, error) {
+			return decodeOutput(formatValue(args[0]))
+		}},
+		"round": {1, 1, num(math.Round)},
+		"floor": {1, 1, num(math.Floor)},
+		"ceil":  {1, 1, num(math.Ceil)},
+		"abs":   {1, 1, num(math.Abs)},
+		"min":   {1, -1, extreme(true)},
+		"max":   {1, -1, extreme(false)},
+		"default": {2, 2, func(args []any) (any, error) {
+			if truthy(args[0]) {
+				return args[0], nil
+			}
+			return args[1], nil
+		}},
+	}
+}
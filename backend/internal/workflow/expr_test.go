@@ -0,0 +1,347 @@
+package workflow
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+)
+
+func exprVars() map[string]any {
+	return map[string]any{
+		"input": map[string]any{
+			"name":  "Ada",
+			"tags":  []any{"a", "b", "c"},
+			"score": 0.75,
+			"empty": "",
+			"user":  map[string]any{"age": float64(36)},
+		},
+		"nodes": map[string]any{
+			"scorer": map[string]any{"score": float64(8)},
+			"writer": "plain text",
+		},
+	}
+}
+
+func TestExpressionEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want any
+	}{
+		// literals
+		{`42`, 42.0},
+		{`1.5e2`, 150.0},
+		{`"a\"b"`, `a"b`},
+		{`'it\'s'`, "it's"},
+		{`"tab\there"`, "tab\there"},
+		{`null`, nil},
+		{`[1, "x", true]`, []any{1.0, "x", true}},
+		{`{a: 1, "b c": [2]}`, map[string]any{"a": 1.0, "b c": []any{2.0}}},
+		{`[]`, []any{}},
+
+		// precedence and associativity
+		{`1 + 2 * 3`, 7.0},
+		{`(1 + 2) * 3`, 9.0},
+		{`10 - 4 - 3`, 3.0},
+		{`12 / 3 / 2`, 2.0},
+		{`7 % 4 * 2`, 6.0},
+		{`-2 * 3`, -6.0},
+		{`--2`, 2.0},
+		{`1 + 2 == 3`, true},
+		{`1 < 2 == 2 < 3`, true},
+		{`true || false && false`, true},
+		{`(true || false) && false`, false},
+		{`!true == false`, true},
+		{`1 > 2 ? "a" : 3 > 2 ? "b" : "c"`, "b"},
+		{`true ? 1 : 0 + 10`, 1.0},
+
+		// comparison and equality
+		{`"abc" < "abd"`, true},
+		{`2 >= 2`, true},
+		{`2 <= 1`, false},
+		{`[1, 2] == [1, 2]`, true},
+		{`{a: 1} != {a: 2}`, true},
+		{`1 == "1"`, false},
+
+		// string and array concatenation
+		{`"n=" + 1`, "n=1"},
+		{`[1] + [2, 3]`, []any{1.0, 2.0, 3.0}},
+
+		// short-circuiting skips the side that would fail
+		{`false && 1 / 0`, false},
+		{`true || 1 / 0`, true},
+		{`true ? 1 : 1 / 0`, 1.0},
+
+		// access
+		{`input.name`, "Ada"},
+		{`input["name"]`, "Ada"},
+		{`input.user.age + 1`, 37.0},
+		{`input.tags[0]`, "a"},
+		{`input.tags[-1]`, "c"},
+		{`input.tags[3]`, nil},
+		{`input.tags[-4]`, nil},
+		{`input.tags[1e19]`, nil},
+		{`input.tags[-1e19]`, nil},
+		{`[1, 2][1e300 * 1e300]`, nil},
+		{`input.missing`, nil},
+		{`input.missing.deeper`, nil},
+		{`nodes.scorer.score > 5`, true},
+		{`nodes["writer"]`, "plain text"},
+
+		// truthiness
+		{`!input.empty`, true},
+		{`![]`, true},
+		{`!{}`, true},
+		{`!0`, true},
+		{`!!"x"`, true},
+
+		// functions
+		{`len("héllo")`, 5.0},
+		{`len(input.tags)`, 3.0},
+		{`len(input.user)`, 1.0},
+		{`len(null)`, 0.0},
+		{`upper("abc")`, "ABC"},
+		{`lower("ABC")`, "abc"},
+		{`trim("  x ")`, "x"},
+		{`contains(input.tags, "b")`, true},
+		{`contains(input.tags, "z")`, false},
+		{`contains(input.user, "age")`, true},
+		{`contains("haystack", "st")`, true},
+		{`startsWith("prefix", "pre")`, true},
+		{`endsWith("suffix", "fix")`, true},
+		{`split("a,b", ",")`, []any{"a", "b"}},
+		{`join(input.tags)`, "abc"},
+		{`join(input.tags, "-")`, "a-b-c"},
+		{`keys({b: 1, a: 2})`, []any{"a", "b"}},
+		{`values({b: 1, a: 2})`, []any{2.0, 1.0}},
+		{`number("3.5")`, 3.5},
+		{`number(true)`, 1.0},
+		{`number(false)`, 0.0},
+		{`number(4)`, 4.0},
+		{`string(12)`, "12"},
+		{`json({a: [1]})`, `{"a":[1]}`},
+		{`parse("{\"a\": 1}").a`, 1.0},
+		{`round(2.5)`, 3.0},
+		{`floor(2.7)`, 2.0},
+		{`ceil(2.1)`, 3.0},
+		{`abs(-3)`, 3.0},
+		{`min(3, 1, 2)`, 1.0},
+		{`max([3, 1, 2])`, 3.0},
+		{`min([])`, nil},
+		{`default(input.missing, "fallback")`, "fallback"},
+		{`default(input.name, "fallback")`, "Ada"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			expr, err := compileExpression(tt.src)
+			if err != nil {
+				t.Fatalf("compile: %v", err)
+			}
+			got, err := expr.Eval(exprVars())
+			if err != nil {
+				t.Fatalf("eval: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		// compile errors
+		{``, "empty"},
+		{`1 +`, "unexpected"},
+		{`(1`, `expected ")"`},
+		{`1 2`, "unexpected"},
+		{`"open`, "unterminated string"},
+		{`1 # 2`, "unexpected character"},
+		{`1.2.3`, "invalid number"},
+		{`foo`, "unknown identifier"},
+		{`len()`, "wrong number of arguments"},
+		{`upper("a", "b")`, "wrong number of arguments"},
+		{`input.`, "expected field name"},
+		{`{1: 2}`, "expected object key"},
+		{`true ? 1`, `expected ":"`},
+		{strings.Repeat("(", maxExprDepth+2) + "1" + strings.Repeat(")", maxExprDepth+2), "nested too deeply"},
+		{strings.Repeat("!", maxExprDepth+2) + "true", "nested too deeply"},
+		{strings.Repeat("[", maxExprDepth+2) + strings.Repeat("]", maxExprDepth+2), "nested too deeply"},
+		{"1" + strings.Repeat(" + 1", maxExprLength/4), "longer than"},
+
+		// evaluation errors
+		{`1 / 0`, "division by zero"},
+		{`5 % 0`, "division by zero"},
+		{`-"x"`, "cannot negate"},
+		{`"a" - 1`, "does not apply"},
+		{`[1] < [2]`, "does not apply"},
+		{`input.tags[0.5]`, "must be an integer"},
+		{`input.tags["0"]`, "must be an integer"},
+		{`input[1]`, "key must be a string"},
+		{`"text".length`, "cannot access"},
+		{`len(1)`, "no length"},
+		{`join("a")`, "expected an array"},
+		{`keys([])`, "expected an object"},
+		{`values("x")`, "expected an object"},
+		{`number("abc")`, "not a number"},
+		{`round("x")`, "expected a number"},
+		{`max(1, "2")`, "expected numbers"},
+		{`parse("{")`, "parse"},
+		{`false || 1 / 0`, "division by zero"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			expr, err := compileExpression(tt.src)
+			if err == nil {
+				_, err = expr.Eval(exprVars())
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestExpressionIndexBounds(t *testing.T) {
+	// Indexes beyond the int range must not wrap around into valid ones
+	for _, index := range []float64{math.MaxInt64, 1e19, -1e19, math.Inf(1), math.Inf(-1), float64(math.MaxInt64) * 2} {
+		node := &memberNode{obj: &literalNode{v: []any{1.0, 2.0}}, key: &literalNode{v: index}}
+		got, err := node.eval(nil)
+		if err != nil || got != nil {
+			t.Errorf("[1, 2][%g] = %v, %v; want null", index, got, err)
+		}
+	}
+	node := &memberNode{obj: &literalNode{v: []any{1.0}}, key: &literalNode{v: math.NaN()}}
+	if _, err := node.eval(nil); err == nil {
+		t.Error("NaN index should be rejected")
+	}
+}
+
+func TestExpressionRefs(t *testing.T) {
+	expr, err := compileExpression(`nodes.a.x + nodes["b"] + len(nodes.c)`)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if got := strings.Join(expr.refs, ","); got != "a,b,c" {
+		t.Errorf("refs = %s", got)
+	}
+}
+
+func TestExpressionLexer(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{`a>=b`, []string{"a", ">=", "b"}},
+		{`a>-1`, []string{"a", ">", "-", "1"}},
+		{`a!=!b`, []string{"a", "!=", "!", "b"}},
+		{`1e+3-2E-1`, []string{"1e+3", "-", "2E-1"}},
+		{`x_1.y2`, []string{"x_1", ".", "y2"}},
+		{"\t a \r\n", []string{"a"}},
+		{`'a"b' "c'd"`, []string{`a"b`, `c'd`}},
+		{`"a\\b\n"`, []string{"a\\b\n"}},
+		{`"\q"`, []string{"q"}},
+		{`""`, []string{""}},
+	}
+	for _, tt := range tests {
+		tokens, err := lexExpr(tt.src)
+		if err != nil {
+			t.Errorf("lex %q: %v", tt.src, err)
+			continue
+		}
+		var got []string
+		for _, tok := range tokens[:len(tokens)-1] {
+			got = append(got, tok.text)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lex %q = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+
+	for _, src := range []string{`"\`, `'abc`, `a @ b`, `1e`, `1..2`, "a\x00"} {
+		if _, err := lexExpr(src); err == nil {
+			t.Errorf("lex %q succeeded", src)
+		}
+	}
+}
+
+// FuzzExpression checks that no expression, valid or not, panics or
+// produces a value outside the JSON types
+func FuzzExpression(f *testing.F) {
+	for _, seed := range []string{
+		`1 + 2 * 3`,
+		`input.tags[-1]`,
+		`nodes["writer"] + "!"`,
+		`{a: [1, 2], "b": null}.a[1]`,
+		`len(split(input.name, "")) > 2 ? upper(input.name) : default(input.missing, 0)`,
+		`keys(input.user) + values({x: 1})`,
+		`parse(json([input.score, true]))[0] % 0.5`,
+		`max(min(3, 1), abs(-2), round(1e308 * 10))`,
+		`!!(-input.user.age) && 'x' < "y" || contains(input, "name")`,
+		`number(string(1e-7)) / 0`,
+		strings.Repeat("(", maxExprDepth) + "1" + strings.Repeat(")", maxExprDepth),
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		expr, err := compileExpression(src)
+		if err != nil {
+			return
+		}
+		got, err := expr.Eval(exprVars())
+		if err != nil {
+			return
+		}
+		var check func(v any)
+		check = func(v any) {
+			switch x := v.(type) {
+			case nil, bool, float64, string:
+			case []any:
+				for _, elem := range x {
+					check(elem)
+				}
+			case map[string]any:
+				for _, elem := range x {
+					check(elem)
+				}
+			default:
+				t.Fatalf("%q evaluated to a %T", src, v)
+			}
+		}
+		check(got)
+	})
+}
+
+func TestSchedulerRecoversPanics(t *testing.T) {
+	agents := newTestAgents()
+	id := agents.add("crash", nil)
+	exec := newFakeExecutor(func(system string, messages []agent.Message) *agent.Result {
+		panic("executor bug")
+	})
+	wf := &store.Workflow{
+		Nodes: []store.NodeConfig{
+			agentNode("crash", id, nil),
+			transformNode("after", "x"),
+			transformNode("other", "y"),
+			agentNode("each", id, map[string]any{"type": NodeTypeMap, "items": "{{input.list}}"}),
+		},
+		Edges: []store.EdgeConfig{edge("e1", "crash", "after")},
+	}
+
+	run := runScheduler(t, newTestScheduler(t, wf, agents, exec), map[string]any{"list": []any{1.0}})
+	if run.status("crash") != NodeStatusFailed || run.status("each") != NodeStatusFailed {
+		t.Fatalf("statuses = %s, %s; want failed", run.status("crash"), run.status("each"))
+	}
+	if err := run.results["crash"].Error; !strings.Contains(err.Error(), "executor bug") {
+		t.Errorf("error = %v", err)
+	}
+	if run.status("after") != NodeStatusSkipped || run.status("other") != NodeStatusSuccess {
+		t.Errorf("after = %s, other = %s", run.status("after"), run.status("other"))
+	}
+}
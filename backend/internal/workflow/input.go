@@ -0,0 +1,56 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/tools"
+)
+
+// mapInput picks fields from the workflow input according to a node's input
+// mapping (label -> field path, e.g. "Topic" -> "request.topic") and renders
+// them as "label: value" lines
+func mapInput(input map[string]any, mapping map[string]string) (string, error) {
+	fields := make(map[string]any, len(mapping))
+	for label, path := range mapping {
+		value, err := tools.ExtractPath(input, path)
+		if err != nil {
+			return "", fmt.Errorf("input mapping %q: %w", label, err)
+		}
+		fields[label] = value
+	}
+	return formatFields(fields), nil
+}
+
+// formatFields renders a map as sorted "key: value" lines
+func formatFields(fields map[string]any) string {
+	var b strings.Builder
+	for _, k := range sortedKeys(fields) {
+		fmt.Fprintf(&b, "%s: %s\n", k, formatValue(fields[k]))
+	}
+	return b.String()
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatValue renders strings verbatim and everything else as JSON
+func formatValue(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
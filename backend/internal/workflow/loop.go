@@ -0,0 +1,228 @@
+package workflow
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+)
+
+// defaultLoopIterations applies when a loop edge leaves max_iterations unset
+const defaultLoopIterations = 3
+
+// Loop is a bounded refinement cycle closed by a back-edge. Each iteration
+// runs the body as an ordinary acyclic sub-graph from Start to End; once End
+// finishes the loop either exits through End's forward edges or starts over.
+type Loop struct {
+	EdgeID        string
+	Start         string
+	End           string
+	Body          map[string]bool
+	MaxIterations int
+	Exit          *Condition
+}
+
+// addLoop registers a back-edge from edge.Source to the upstream edge.Target.
+// The body is every node on a path from the target to the source. Only the
+// source may have edges leaving the body, so nothing outside the loop runs
+// on an intermediate iteration.
+func (d *DAG) addLoop(edge store.EdgeConfig) error {
+	if _, ok := d.Nodes[edge.Source]; !ok {
+		return fmt.Errorf("unknown source node %s", edge.Source)
+	}
+	if _, ok := d.Nodes[edge.Target]; !ok {
+		return fmt.Errorf("unknown target node %s", edge.Target)
+	}
+	if edge.Condition != nil {
+		return fmt.Errorf("use loop.exit instead of a condition")
+	}
+	if edge.Source != edge.Target && !d.Ancestors(edge.Source)[edge.Target] {
+		return fmt.Errorf("target %s is not upstream of %s", edge.Target, edge.Source)
+	}
+
+	maxIterations := edge.Loop.MaxIterations
+	if maxIterations == 0 {
+		maxIterations = defaultLoopIterations
+	}
+	if maxIterations < 1 {
+		return fmt.Errorf("max_iterations must be at least 1")
+	}
+	exit, err := compileCondition(edge.Loop.Exit)
+	if err != nil {
+		return fmt.Errorf("exit: %w", err)
+	}
+
+	ancestors := d.Ancestors(edge.Source)
+	body := map[string]bool{edge.Source: true, edge.Target: true}
+	stack := []string{edge.Target}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, next := range d.Nodes[id].Downstream {
+			if ancestors[next] && !body[next] {
+				body[next] = true
+				stack = append(stack, next)
+			}
+		}
+	}
+
+	for id := range body {
+		if other := d.loopOf[id]; other != nil {
+			return fmt.Errorf("overlaps loop edge %s at node %s", other.EdgeID, id)
+		}
+		if id == edge.Source {
+			continue
+		}
+		for _, next := range d.Nodes[id].Downstream {
+			if !body[next] {
+				return fmt.Errorf("node %s leaves the loop body; only %s may have edges out of the loop", id, edge.Source)
+			}
+		}
+	}
+
+	loop := &Loop{
+		EdgeID:        edge.ID,
+		Start:         edge.Target,
+		End:           edge.Source,
+		Body:          body,
+		MaxIterations: maxIterations,
+		Exit:          exit,
+	}
+	d.Loops = append(d.Loops, loop)
+	for id := range body {
+		d.loopOf[id] = loop
+	}
+	return nil
+}
+
+// LoopOf returns the loop containing a node, or nil
+func (d *DAG) LoopOf(nodeID string) *Loop {
+	return d.loopOf[nodeID]
+}
+
+// loopIteration returns the iteration a node is on: 1-based inside a loop,
+// 0 outside one
+func (s *Scheduler) loopIteration(nodeID string) int {
+	loop := s.dag.LoopOf(nodeID)
+	if loop == nil {
+		return 0
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.iterations[loop.EdgeID] + 1
+}
+
+// iteration is loopIteration for callers holding s.mu
+func (s *Scheduler) iteration(nodeID string) int {
+	loop := s.dag.LoopOf(nodeID)
+	if loop == nil {
+		return 0
+	}
+	return s.iterations[loop.EdgeID] + 1
+}
+
+// loopFeedback returns the previous iteration's output of the loop's end
+// node, empty on the first iteration
+func (s *Scheduler) loopFeedback(nodeID string) string {
+	loop := s.dag.LoopOf(nodeID)
+	if loop == nil {
+		return ""
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.feedback[loop.EdgeID]
+}
+
+// nextIteration is called when a loop's end node succeeds. It reports
+// whether another iteration starts, in which case the body's results are
+// reset (their steps are carried over) and the caller schedules loop.Start.
+func (s *Scheduler) nextIteration(loop *Loop, output string) bool {
+	s.mu.Lock()
+	iteration := s.iterations[loop.EdgeID] + 1
+	if loop.Exit != nil && loop.Exit.Evaluate(output) {
+		s.mu.Unlock()
+		log.Printf("[Scheduler] Loop %s exited after iteration %d", loop.EdgeID, iteration)
+		return false
+	}
+	if iteration >= loop.MaxIterations {
+		s.mu.Unlock()
+		log.Printf("[Scheduler] Loop %s stopped at max iterations (%d)", loop.EdgeID, loop.MaxIterations)
+		return false
+	}
+
+	for id := range loop.Body {
+		if result := s.results[id]; result != nil {
+			s.carried[id] = result.Steps
+		}
+		delete(s.results, id)
+		delete(s.completed, id)
+		delete(s.started, id)
+		for _, edge := range s.dag.OutgoingEdges(id) {
+			delete(s.active, edge.ID)
+		}
+	}
+	s.iterations[loop.EdgeID] = iteration
+	s.feedback[loop.EdgeID] = output
+	s.mu.Unlock()
+
+	s.eventChan <- ExecutionEvent{
+		Type:      "loop_iteration",
+		NodeID:    loop.Start,
+		Iteration: iteration + 1,
+		Timestamp: time.Now(),
+	}
+	log.Printf("[Scheduler] Loop %s starting iteration %d", loop.EdgeID, iteration+1)
+	return true
+}
+
+// carriedSteps prepends the steps of a node's earlier loop iterations.
+// Callers must hold s.mu.
+func (s *Scheduler) carriedSteps(nodeID string, steps []store.Step) []store.Step {
+	carried := s.carried[nodeID]
+	if len(carried) == 0 {
+		return steps
+	}
+	all := make([]store.Step, 0, len(carried)+len(steps))
+	all = append(all, carried...)
+	return append(all, steps...)
+}
+
+// restoreLoop resumes a loop at the latest iteration among its restored body
+// results. Results of earlier iterations are dropped so those nodes run again,
+// keeping their steps, and the end node's last output becomes the feedback.
+// A finished end node whose loop was due another iteration starts the next
+// one. Callers must hold s.mu.
+func (s *Scheduler) restoreLoop(loop *Loop) {
+	current := 0
+	for id := range loop.Body {
+		if result := s.results[id]; result != nil && result.Iteration > current {
+			current = result.Iteration
+		}
+	}
+	// Checkpoints from before iterations were recorded restore as they are
+	if current == 0 {
+		return
+	}
+
+	end := s.results[loop.End]
+	if end != nil && end.Iteration == current && end.Status == NodeStatusSuccess &&
+		current < loop.MaxIterations && (loop.Exit == nil || !loop.Exit.Evaluate(end.Output)) {
+		current++
+	}
+	if end != nil && end.Iteration == current-1 {
+		s.feedback[loop.EdgeID] = end.Output
+	}
+
+	for id := range loop.Body {
+		result := s.results[id]
+		if result == nil || result.Iteration >= current {
+			continue
+		}
+		s.carried[id] = result.Steps
+		delete(s.results, id)
+		delete(s.completed, id)
+		delete(s.started, id)
+	}
+	s.iterations[loop.EdgeID] = current - 1
+}
@@ -0,0 +1,261 @@
+package workflow
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+)
+
+// refineWorkflow loops draft -> review back to draft until review approves,
+// then publishes
+func refineWorkflow(agents *testAgents, maxIterations int) *store.Workflow {
+	writer := agents.add("writer", nil)
+	critic := agents.add("critic", nil)
+	return &store.Workflow{
+		Nodes: []store.NodeConfig{
+			agentNode("draft", writer, nil),
+			agentNode("review", critic, nil),
+			transformNode("publish", "{{nodes.draft.output}}"),
+		},
+		Edges: []store.EdgeConfig{
+			edge("e1", "draft", "review"),
+			edge("e2", "review", "publish"),
+			{ID: "again", Source: "review", Target: "draft", Loop: &store.EdgeLoop{
+				MaxIterations: maxIterations,
+				Exit:          &store.EdgeCondition{Type: "contains", Value: "APPROVED"},
+			}},
+		},
+	}
+}
+
+// refineExecutor writes numbered drafts and approves the given one
+func refineExecutor(approve int) *fakeExecutor {
+	var drafts int
+	return newFakeExecutor(func(system string, messages []agent.Message) *agent.Result {
+		if system == "writer" {
+			drafts++
+			return text(fmt.Sprintf("draft %d", drafts))
+		}
+		if strings.Contains(lastUser(messages), fmt.Sprintf("draft %d", approve)) {
+			return text("APPROVED")
+		}
+		return text("needs work")
+	})
+}
+
+func TestLoopExitsOnCondition(t *testing.T) {
+	agents := newTestAgents()
+	wf := refineWorkflow(agents, 5)
+	exec := refineExecutor(3)
+
+	run := runScheduler(t, newTestScheduler(t, wf, agents, exec), nil)
+	if run.err != nil {
+		t.Fatalf("Run: %v", run.err)
+	}
+	if calls := exec.Calls("writer"); calls != 3 {
+		t.Errorf("writer ran %d times, want 3", calls)
+	}
+	if got := run.output("publish"); got != "draft 3" {
+		t.Errorf("publish output = %q, want the approved draft", got)
+	}
+
+	// Every iteration's steps stay on the body nodes, tagged by iteration
+	steps := run.results["draft"].Steps
+	if len(steps) != 3 {
+		t.Fatalf("draft has %d steps, want 3", len(steps))
+	}
+	for i, step := range steps {
+		if step.Iteration != i+1 {
+			t.Errorf("step %d has iteration %d", i, step.Iteration)
+		}
+	}
+
+	var iterations []int
+	publishes := 0
+	for _, event := range run.events {
+		switch {
+		case event.Type == "loop_iteration":
+			iterations = append(iterations, event.Iteration)
+		case event.Type == "node_started" && event.NodeID == "publish":
+			publishes++
+		}
+	}
+	if fmt.Sprint(iterations) != "[2 3]" {
+		t.Errorf("loop_iteration events = %v, want [2 3]", iterations)
+	}
+	if publishes != 1 {
+		t.Errorf("publish started %d times, want once after the loop", publishes)
+	}
+}
+
+func TestLoopStopsAtMaxIterations(t *testing.T) {
+	agents := newTestAgents()
+	wf := refineWorkflow(agents, 2)
+	exec := refineExecutor(10)
+
+	run := runScheduler(t, newTestScheduler(t, wf, agents, exec), nil)
+	if run.err != nil {
+		t.Fatalf("Run: %v", run.err)
+	}
+	if calls := exec.Calls("writer"); calls != 2 {
+		t.Errorf("writer ran %d times, want 2", calls)
+	}
+	if got := run.output("publish"); got != "draft 2" {
+		t.Errorf("publish output = %q, want the last draft", got)
+	}
+}
+
+func TestLoopFeedback(t *testing.T) {
+	agents := newTestAgents()
+	wf := refineWorkflow(agents, 3)
+	var inputs []string
+	exec := newFakeExecutor(func(system string, messages []agent.Message) *agent.Result {
+		if system == "writer" {
+			inputs = append(inputs, lastUser(messages))
+			return text("draft")
+		}
+		return text("more detail")
+	})
+
+	run := runScheduler(t, newTestScheduler(t, wf, agents, exec), map[string]any{"topic": "go"})
+	if run.err != nil {
+		t.Fatalf("Run: %v", run.err)
+	}
+	if len(inputs) != 3 {
+		t.Fatalf("writer ran %d times, want 3", len(inputs))
+	}
+	if strings.Contains(inputs[0], "Feedback") {
+		t.Errorf("first iteration got feedback: %q", inputs[0])
+	}
+	for i, input := range inputs[1:] {
+		want := fmt.Sprintf("Feedback (iteration %d): more detail", i+1)
+		if !strings.Contains(input, want) || !strings.Contains(input, "topic: go") {
+			t.Errorf("iteration %d input %q, want the workflow input and %q", i+2, input, want)
+		}
+	}
+}
+
+func TestLoopValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		edges []store.EdgeConfig
+		err   string
+	}{
+		{
+			name:  "target not upstream",
+			edges: []store.EdgeConfig{edge("e1", "a", "b"), {ID: "l", Source: "a", Target: "b", Loop: &store.EdgeLoop{}}},
+			err:   "not upstream",
+		},
+		{
+			name:  "condition instead of exit",
+			edges: []store.EdgeConfig{edge("e1", "a", "b"), {ID: "l", Source: "b", Target: "a", Loop: &store.EdgeLoop{}, Condition: &store.EdgeCondition{Type: "contains", Value: "x"}}},
+			err:   "loop.exit",
+		},
+		{
+			name:  "negative max iterations",
+			edges: []store.EdgeConfig{edge("e1", "a", "b"), {ID: "l", Source: "b", Target: "a", Loop: &store.EdgeLoop{MaxIterations: -1}}},
+			err:   "max_iterations",
+		},
+		{
+			name: "body node leaves the loop",
+			edges: []store.EdgeConfig{
+				edge("e1", "a", "b"), edge("e2", "a", "c"),
+				{ID: "l", Source: "b", Target: "a", Loop: &store.EdgeLoop{}},
+			},
+			err: "leaves the loop body",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDAG(&store.Workflow{
+				Nodes: []store.NodeConfig{transformNode("a", "x"), transformNode("b", "y"), transformNode("c", "z")},
+				Edges: tt.edges,
+			})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoopRestore(t *testing.T) {
+	step := func(iteration int) []store.Step {
+		return []store.Step{{StepID: fmt.Sprint("s", iteration), Type: "output", Iteration: iteration}}
+	}
+	tests := []struct {
+		name      string
+		nodes     []store.NodeSnapshot
+		drafts    int
+		feedback  string
+		iteration int
+	}{
+		{
+			// review had not run for the second draft yet
+			name: "mid iteration",
+			nodes: []store.NodeSnapshot{
+				{NodeID: "draft", Status: NodeStatusSuccess, Iteration: 2, FinalOutput: "draft 2", Steps: step(2)},
+				{NodeID: "review", Status: NodeStatusSuccess, Iteration: 1, FinalOutput: "needs work", Steps: step(1)},
+			},
+			drafts: 0,
+		},
+		{
+			// review asked for another draft before the next iteration started
+			name: "between iterations",
+			nodes: []store.NodeSnapshot{
+				{NodeID: "draft", Status: NodeStatusSuccess, Iteration: 1, FinalOutput: "draft 1", Steps: step(1)},
+				{NodeID: "review", Status: NodeStatusSuccess, Iteration: 1, FinalOutput: "needs work", Steps: step(1)},
+			},
+			drafts:    1,
+			feedback:  "Feedback (iteration 1): needs work",
+			iteration: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agents := newTestAgents()
+			wf := refineWorkflow(agents, 5)
+			var inputs []string
+			exec := newFakeExecutor(func(system string, messages []agent.Message) *agent.Result {
+				if system == "writer" {
+					inputs = append(inputs, lastUser(messages))
+					return text("draft 2")
+				}
+				if strings.Contains(lastUser(messages), "draft 2") {
+					return text("APPROVED")
+				}
+				return text("needs work")
+			})
+
+			s := newTestScheduler(t, wf, agents, exec)
+			s.Restore(tt.nodes)
+			run := runScheduler(t, s, nil)
+			if run.err != nil {
+				t.Fatalf("Run: %v", run.err)
+			}
+			if len(inputs) != tt.drafts {
+				t.Fatalf("writer ran %d times, want %d", len(inputs), tt.drafts)
+			}
+			if tt.feedback != "" && !strings.Contains(inputs[0], tt.feedback) {
+				t.Errorf("writer input %q, want %q", inputs[0], tt.feedback)
+			}
+			if calls := exec.Calls("critic"); calls != 1 {
+				t.Errorf("review ran %d times, want once", calls)
+			}
+			if got := run.output("publish"); got != "draft 2" {
+				t.Errorf("publish output = %q", got)
+			}
+			// Steps of the restored iterations are kept
+			if steps := run.results["review"].Steps; len(steps) != 2 || steps[0].StepID != "s1" {
+				t.Errorf("review steps = %+v, want the restored step first", steps)
+			}
+			if tt.iteration != 0 {
+				if steps := run.results["draft"].Steps; len(steps) != 2 || steps[1].Iteration != tt.iteration {
+					t.Errorf("draft steps = %+v, want a new step in iteration %d", steps, tt.iteration)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+	"github.com/Wangren-Academy/Agent/backend/internal/tools"
+)
+
+// runMapNode runs the node's agent, or its sub-graph, once per element of
+// its items array with bounded concurrency. The output is a JSON array of
+// the per-item results in item order; every item's steps are kept on the
+// map node, tagged with the item index.
+func (s *Scheduler) runMapNode(ctx context.Context, node *Node) (*nodeRun, error) {
+	items, err := s.mapItems(node)
+	if err != nil {
+		return nil, err
+	}
+
+	runItem := s.runSubgraphItem
+	if node.Map.Subgraph == nil {
+		runItem, err = s.agentItemRunner(ctx, node)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("[Scheduler] Map node %s running %d item(s)", node.ID, len(items))
+
+	runs := make([]*nodeRun, len(items))
+	errs := make([]error, len(items))
+	sem := make(chan struct{}, node.Map.Concurrency)
+	var wg sync.WaitGroup
+	for i, item := range items {
+		index := i
+		runs[i] = &nodeRun{item: &index}
+		wg.Add(1)
+		go func(i int, item any) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+			defer recoverNode(node.ID, &errs[i])
+			errs[i] = runItem(ctx, node, runs[i], item)
+		}(i, item)
+	}
+	wg.Wait()
+
+	run := &nodeRun{}
+	outputs := make([]any, len(items))
+	var failures []string
+	for i, itemRun := range runs {
+		run.Steps = append(run.Steps, itemRun.Steps...)
+		if errs[i] != nil {
+			failures = append(failures, fmt.Sprintf("item %d: %v", i, errs[i]))
+			continue
+		}
+		outputs[i] = itemValue(itemRun.Output)
+	}
+
+	b, err := json.Marshal(outputs)
+	if err != nil {
+		return run, fmt.Errorf("encode map output: %w", err)
+	}
+	run.Output = string(b)
+
+	if len(failures) > 0 {
+		return run, fmt.Errorf("%d of %d item(s) failed: %s", len(failures), len(items), strings.Join(failures, "; "))
+	}
+	return run, nil
+}
+
+// mapItems resolves the array a map node iterates over
+func (s *Scheduler) mapItems(node *Node) ([]any, error) {
+	var value any
+	if node.Map.Items == "" {
+		s.mu.RLock()
+		result := s.results[node.DependsOn[0]]
+		s.mu.RUnlock()
+		if result == nil || result.Status != NodeStatusSuccess {
+			return nil, fmt.Errorf("upstream node %s has no output", node.DependsOn[0])
+		}
+		value = result.Output
+	} else {
+		ref, err := parseRef(node.Map.Items)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = s.resolveTemplateRef(ref); err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+	}
+
+	if text, ok := value.(string); ok {
+		decoded, err := decodeOutput(text)
+		if err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+		value = decoded
+	}
+	items, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("items must be a JSON array")
+	}
+	return items, nil
+}
+
+// mapItemRunner processes one element of a map node into run
+type mapItemRunner func(ctx context.Context, node *Node, run *nodeRun, item any) error
+
+// agentItemRunner prepares the map node's agent once and returns a runner
+// that sends it each item, rendered through the node's prompt template if
+// it has one
+func (s *Scheduler) agentItemRunner(ctx context.Context, node *Node) (mapItemRunner, error) {
+	agentConfig, exec, config, err := s.prepareAgent(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	if names := toolNames(agentConfig.ModelConfig); len(names) > 0 {
+		if s.tools == nil {
+			return nil, fmt.Errorf("agent requires tools but no tool runner is configured")
+		}
+		defs, err := s.tools.Definitions(names)
+		if err != nil {
+			return nil, err
+		}
+		config.Tools = append(config.Tools, defs...)
+	}
+	maxIterations := maxToolIterations(agentConfig.ModelConfig)
+
+	return func(ctx context.Context, node *Node, run *nodeRun, item any) error {
+		input := formatValue(item)
+		if node.Template != "" {
+			resolve := s.nodeResolver(node.ID)
+			rendered, err := renderTemplate(node.Template, func(ref templateRef) (any, error) {
+				if ref.Kind == "item" {
+					if ref.Path == "" {
+						return item, nil
+					}
+					return tools.ExtractPath(item, ref.Path)
+				}
+				return resolve(ref)
+			})
+			if err != nil {
+				return err
+			}
+			input = rendered
+		}
+		messages := buildMessages(agentConfig.SystemPrompt, input)
+		return s.runAgent(ctx, run, node.ID, exec, agentConfig.SystemPrompt, input, messages, config, maxIterations)
+	}, nil
+}
+
+// runSubgraphItem runs the map node's sub-graph on one item, with
+// {"item": ..., "index": ...} as the sub-graph's workflow input
+func (s *Scheduler) runSubgraphItem(ctx context.Context, node *Node, run *nodeRun, item any) error {
+	input := map[string]any{"item": item, "index": *run.item}
+	results, err := s.runChild(ctx, node.ID, node.Map.Subgraph, s.executionID, input, run)
+	if err != nil {
+		return err
+	}
+	run.Output = terminalOutput(node.Map.Subgraph, results)
+	return nil
+}
+
+// terminalOutput combines the outputs of a graph's successful terminal
+// nodes: a single terminal yields its output as-is, several yield a JSON
+// object keyed by node name (or ID)
+func terminalOutput(dag *DAG, results map[string]*NodeResult) string {
+	outputs := make(map[string]any)
+	last := ""
+	for nodeID, node := range dag.Nodes {
+		result, ok := results[nodeID]
+		if len(node.Downstream) > 0 || !ok || result.Status != NodeStatusSuccess {
+			continue
+		}
+		key := node.Name
+		if key == "" {
+			key = nodeID
+		}
+		outputs[key] = itemValue(result.Output)
+		last = result.Output
+	}
+	if len(outputs) <= 1 {
+		return last
+	}
+	b, err := json.Marshal(outputs)
+	if err != nil {
+		return last
+	}
+	return string(b)
+}
+
+// itemValue embeds JSON outputs as values and everything else as text
+func itemValue(output string) any {
+	if value, err := decodeOutput(output); err == nil {
+		return value
+	}
+	return output
+}
+
+func tagStep(step store.Step, item *int, subNodeID string) store.Step {
+	step.Item = item
+	step.SubNodeID = subNodeID
+	return step
+}
@@ -0,0 +1,160 @@
+package workflow
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+)
+
+func TestMapNodeAgent(t *testing.T) {
+	agents := newTestAgents()
+	upper := agents.add("upper", nil)
+	var running, peak atomic.Int32
+	exec := newFakeExecutor(func(system string, messages []agent.Message) *agent.Result {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		return text(strings.ToUpper(lastUser(messages)))
+	})
+	wf := &store.Workflow{
+		Nodes: []store.NodeConfig{
+			typedNode("split", NodeTypeTransform, map[string]any{"template": `["a", "b", "c", "d"]`, "format": "json"}),
+			agentNode("each", upper, map[string]any{"type": NodeTypeMap, "concurrency": float64(2), "prompt_template": "item {{item}}"}),
+		},
+		Edges: []store.EdgeConfig{edge("e1", "split", "each")},
+	}
+
+	run := runScheduler(t, newTestScheduler(t, wf, agents, exec), nil)
+	if run.err != nil {
+		t.Fatalf("Run: %v", run.err)
+	}
+	if got := run.output("each"); got != `["ITEM A","ITEM B","ITEM C","ITEM D"]` {
+		t.Errorf("output = %s", got)
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("%d items ran at once with concurrency 2", p)
+	}
+
+	steps := run.results["each"].Steps
+	if len(steps) != 4 {
+		t.Fatalf("got %d steps, want one per item", len(steps))
+	}
+	for i, step := range steps {
+		if step.Item == nil || *step.Item != i {
+			t.Errorf("step %d tagged with item %v", i, step.Item)
+		}
+	}
+}
+
+func TestMapNodeItemsReference(t *testing.T) {
+	agents := newTestAgents()
+	echo := agents.add("echo", nil)
+	exec := newFakeExecutor(func(system string, messages []agent.Message) *agent.Result {
+		return text(fmt.Sprintf(`{"len": %d}`, len(lastUser(messages))))
+	})
+	wf := &store.Workflow{
+		Nodes: []store.NodeConfig{
+			agentNode("each", echo, map[string]any{"type": NodeTypeMap, "items": "{{input.words}}", "prompt_template": "{{item.word}}"}),
+		},
+	}
+
+	input := map[string]any{"words": []any{map[string]any{"word": "hi"}, map[string]any{"word": "hey"}}}
+	run := runScheduler(t, newTestScheduler(t, wf, agents, exec), input)
+	if run.err != nil {
+		t.Fatalf("Run: %v", run.err)
+	}
+	// JSON item outputs are embedded as values rather than strings
+	if got := run.output("each"); got != `[{"len":2},{"len":3}]` {
+		t.Errorf("output = %s", got)
+	}
+}
+
+func TestMapNodeSubgraph(t *testing.T) {
+	subgraph := map[string]any{
+		"nodes": []any{
+			map[string]any{"id": "label", "data": map[string]any{"type": NodeTypeTransform, "template": "{{input.index}}:{{input.item}}"}},
+		},
+		"edges": []any{},
+	}
+	wf := &store.Workflow{
+		Nodes: []store.NodeConfig{
+			typedNode("each", NodeTypeMap, map[string]any{"items": "{{input.list}}", "subgraph": subgraph}),
+		},
+	}
+	run := runScheduler(t, newTestScheduler(t, wf, nil, nil), map[string]any{"list": []any{"x", "y"}})
+	if run.err != nil {
+		t.Fatalf("Run: %v", run.err)
+	}
+	if got := run.output("each"); got != `["0:x","1:y"]` {
+		t.Errorf("output = %s", got)
+	}
+	for _, step := range run.results["each"].Steps {
+		if step.SubNodeID != "label" || step.Item == nil {
+			t.Errorf("step not tagged with its sub-node and item: %+v", step)
+		}
+	}
+}
+
+func TestMapNodeFailures(t *testing.T) {
+	agents := newTestAgents()
+	picky := agents.add("picky", nil)
+	exec := newFakeExecutor(func(system string, messages []agent.Message) *agent.Result {
+		if lastUser(messages) == "bad" {
+			return nil
+		}
+		return text("ok")
+	})
+
+	tests := []struct {
+		name  string
+		items string
+		err   string
+	}{
+		{"failing item", `["good", "bad", "good"]`, "1 of 3 item(s) failed: item 1: model unavailable"},
+		{"not an array", `{"a": 1}`, "items must be a JSON array"},
+		{"not json", `nope`, "items"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf := &store.Workflow{
+				Nodes: []store.NodeConfig{
+					typedNode("split", NodeTypeTransform, map[string]any{"template": tt.items}),
+					agentNode("each", picky, map[string]any{"type": NodeTypeMap}),
+				},
+				Edges: []store.EdgeConfig{edge("e1", "split", "each")},
+			}
+			run := runScheduler(t, newTestScheduler(t, wf, agents, exec), nil)
+			if run.status("each") != NodeStatusFailed {
+				t.Fatalf("status = %s, want failed", run.status("each"))
+			}
+			if err := run.results["each"].Error; !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestMapNodeValidation(t *testing.T) {
+	_, err := NewDAG(&store.Workflow{
+		Nodes: []store.NodeConfig{typedNode("each", NodeTypeMap, nil)},
+	})
+	if err == nil || !strings.Contains(err.Error(), "items is required") {
+		t.Errorf("error = %v", err)
+	}
+
+	_, err = NewDAG(&store.Workflow{
+		Nodes: []store.NodeConfig{typedNode("each", NodeTypeMap, map[string]any{"items": "{{input.x}}", "concurrency": float64(0)})},
+	})
+	if err == nil || !strings.Contains(err.Error(), "concurrency") {
+		t.Errorf("error = %v", err)
+	}
+}
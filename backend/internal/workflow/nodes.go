@@ -0,0 +1,223 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// Deterministic node types run without calling a model
+const (
+	NodeTypeTransform  = "transform"
+	NodeTypeHTTP       = "http"
+	NodeTypeExpression = "expression"
+)
+
+const (
+	defaultHTTPTimeout = 30 * time.Second
+	maxHTTPNodeBytes   = 1 << 20
+)
+
+// HTTPConfig configures an HTTP node. URL, header values and body are
+// templates rendered like prompt templates.
+type HTTPConfig struct {
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    string
+	Timeout time.Duration
+}
+
+// parseHTTPConfig reads data.method, data.url, data.headers, data.body and
+// data.timeout_seconds
+func parseHTTPConfig(data map[string]any) (*HTTPConfig, error) {
+	cfg := &HTTPConfig{Method: http.MethodGet, Timeout: defaultHTTPTimeout}
+	cfg.URL, _ = data["url"].(string)
+	if strings.TrimSpace(cfg.URL) == "" {
+		return nil, fmt.Errorf("http node requires a url")
+	}
+	if m, ok := data["method"].(string); ok && m != "" {
+		cfg.Method = strings.ToUpper(m)
+	}
+	switch cfg.Method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return nil, fmt.Errorf("unsupported http method: %s", cfg.Method)
+	}
+	if raw, ok := data["headers"].(map[string]any); ok {
+		cfg.Headers = make(map[string]string, len(raw))
+		for k, v := range raw {
+			value, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("header %q must be a string", k)
+			}
+			cfg.Headers[k] = value
+		}
+	}
+	cfg.Body, _ = data["body"].(string)
+	if t, ok := data["timeout_seconds"].(float64); ok && t > 0 {
+		cfg.Timeout = time.Duration(t * float64(time.Second))
+	}
+	return cfg, nil
+}
+
+// runTransformNode renders the node's template. With data.format "json" the
+// result must be valid JSON and is emitted in compact form.
+func (s *Scheduler) runTransformNode(ctx context.Context, node *Node) (*nodeRun, error) {
+	start := time.Now()
+	output, err := renderTemplate(node.Template, s.nodeResolver(node.ID))
+	if err != nil {
+		return nil, err
+	}
+	if node.Format == "json" {
+		value, err := decodeOutput(output)
+		if err != nil {
+			return nil, fmt.Errorf("transform result: %w", err)
+		}
+		b, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("encode transform result: %w", err)
+		}
+		output = string(b)
+	}
+
+	run := &nodeRun{Output: output}
+	s.recordStep(node.ID, run, store.Step{
+		StepID:    uuid.NewString(),
+		Type:      "result",
+		Tool:      NodeTypeTransform,
+		Input:     node.Template,
+		Output:    output,
+		LatencyMs: time.Since(start).Milliseconds(),
+		Timestamp: start,
+	})
+	return run, nil
+}
+
+// runHTTPNode sends the configured request and outputs the response body.
+// Error statuses fail the node.
+func (s *Scheduler) runHTTPNode(ctx context.Context, node *Node) (*nodeRun, error) {
+	if s.httpClient == nil {
+		return nil, fmt.Errorf("http nodes are disabled")
+	}
+	cfg := node.HTTP
+	resolve := s.nodeResolver(node.ID)
+
+	rawURL, err := renderTemplate(cfg.URL, resolve)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid url: %s", rawURL)
+	}
+
+	var body io.Reader
+	if cfg.Body != "" {
+		rendered, err := renderTemplate(cfg.Body, resolve)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(rendered)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, cfg.Method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	for k, v := range cfg.Headers {
+		value, err := renderTemplate(v, resolve)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(k, value)
+	}
+
+	start := time.Now()
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", cfg.Method, u.Host, err)
+	}
+	defer resp.Body.Close()
+
+	// Read one byte past the limit so that an oversized body fails the node
+	// rather than passing a cut-off document downstream
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPNodeBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if len(data) > maxHTTPNodeBytes {
+		return nil, fmt.Errorf("%s %s: response body is larger than %d bytes", cfg.Method, u.Host, maxHTTPNodeBytes)
+	}
+
+	run := &nodeRun{Output: string(data)}
+	s.recordStep(node.ID, run, store.Step{
+		StepID:    uuid.NewString(),
+		Type:      "result",
+		Tool:      NodeTypeHTTP,
+		Arguments: map[string]any{"method": cfg.Method, "url": u.String(), "status": resp.StatusCode},
+		Output:    run.Output,
+		LatencyMs: time.Since(start).Milliseconds(),
+		Timestamp: start,
+	})
+
+	if resp.StatusCode >= 400 {
+		snippet := run.Output
+		if len(snippet) > 200 {
+			snippet = snippet[:200] + "..."
+		}
+		return run, fmt.Errorf("HTTP %d: %s", resp.StatusCode, snippet)
+	}
+	return run, nil
+}
+
+// runExpressionNode evaluates the node's expression. Strings are output
+// verbatim, other results as JSON.
+func (s *Scheduler) runExpressionNode(ctx context.Context, node *Node) (*nodeRun, error) {
+	start := time.Now()
+
+	// Upstream outputs are visible by name and ID; skipped nodes are null
+	nodes := make(map[string]any)
+	s.mu.RLock()
+	for id := range s.dag.Ancestors(node.ID) {
+		result, ok := s.results[id]
+		if !ok || result.Status != NodeStatusSuccess {
+			continue
+		}
+		value := itemValue(result.Output)
+		nodes[id] = value
+		if name := s.dag.Nodes[id].Name; name != "" {
+			nodes[name] = value
+		}
+	}
+	s.mu.RUnlock()
+
+	value, err := node.Expr.Eval(map[string]any{"input": s.input, "nodes": nodes})
+	if err != nil {
+		return nil, fmt.Errorf("expression: %w", err)
+	}
+
+	run := &nodeRun{Output: formatValue(value)}
+	s.recordStep(node.ID, run, store.Step{
+		StepID:    uuid.NewString(),
+		Type:      "result",
+		Tool:      NodeTypeExpression,
+		Input:     node.Expr.Source,
+		Output:    run.Output,
+		LatencyMs: time.Since(start).Milliseconds(),
+		Timestamp: start,
+	})
+	return run, nil
+}
@@ -0,0 +1,54 @@
+package workflow
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+)
+
+func TestHTTPNode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			fmt.Fprint(w, strings.Repeat("x", maxHTTPNodeBytes))
+		case "/large":
+			fmt.Fprint(w, strings.Repeat("x", maxHTTPNodeBytes+1))
+		default:
+			http.Error(w, "no such page", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path string
+		err  string
+	}{
+		{"/ok", ""},
+		{"/large", fmt.Sprintf("response body is larger than %d bytes", maxHTTPNodeBytes)},
+		{"/missing", "HTTP 404: no such page"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			wf := &store.Workflow{Nodes: []store.NodeConfig{
+				typedNode("fetch", NodeTypeHTTP, map[string]any{"url": server.URL + tt.path}),
+			}}
+			s := newTestScheduler(t, wf, nil, nil)
+			s.SetHTTPClient(server.Client())
+			result := runScheduler(t, s, nil).results["fetch"]
+
+			if tt.err == "" {
+				if result.Status != NodeStatusSuccess || len(result.Output) != maxHTTPNodeBytes {
+					t.Errorf("status %s with %d bytes of output, error %v", result.Status, len(result.Output), result.Error)
+				}
+				return
+			}
+			if result.Status != NodeStatusFailed || result.Error == nil || !strings.Contains(result.Error.Error(), tt.err) {
+				t.Errorf("status %s, error %v; want a failure containing %q", result.Status, result.Error, tt.err)
+			}
+		})
+	}
+}
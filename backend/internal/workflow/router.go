@@ -0,0 +1,165 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// routeToolName is the function a router must call to pick its branch
+const routeToolName = "route"
+
+// runRouterNode asks the router's agent to choose one of its outgoing edge
+// labels. The choice is forced through a tool call whose argument is an enum
+// of the labels; models that ignore tool choice fall back to matching a label
+// in the reply text. The router passes its input through to the chosen branch.
+func (s *Scheduler) runRouterNode(ctx context.Context, node *Node) (*nodeRun, error) {
+	agentConfig, exec, config, err := s.prepareAgent(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+
+	input, err := s.buildInput(node.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := s.dag.RouteLabels(node.ID)
+	config.Tools = []agent.Tool{routeTool(labels)}
+	extra := make(map[string]any, len(config.Extra)+1)
+	for k, v := range config.Extra {
+		extra[k] = v
+	}
+	extra["tool_choice"] = routeToolName
+	config.Extra = extra
+
+	messages := buildMessages(agentConfig.SystemPrompt, input)
+	messages = append(messages[:len(messages)-1], agent.Message{
+		Role:    "system",
+		Content: routeInstruction(labels),
+	}, messages[len(messages)-1])
+
+	stepID := uuid.NewString()
+	start := time.Now()
+	result, err := s.execute(ctx, exec, node.ID, stepID, messages, config)
+	if err != nil {
+		return nil, err
+	}
+
+	route, reason := chooseRoute(result, labels)
+	output := fmt.Sprintf("route: %s", route)
+	if reason != "" {
+		output += "\n" + reason
+	}
+
+	run := &nodeRun{Output: input, Route: route}
+	s.recordStep(node.ID, run, store.Step{
+		StepID:    stepID,
+		Type:      "think",
+		Input:     input,
+		Output:    output,
+		Prompt:    agentConfig.SystemPrompt,
+		Tokens:    result.Usage.TotalTokens,
+		LatencyMs: result.Latency.Milliseconds(),
+		Timestamp: start,
+	})
+
+	if route == "" {
+		return run, fmt.Errorf("router chose none of the routes %s", strings.Join(labels, ", "))
+	}
+	return run, nil
+}
+
+// routeTool builds the function definition constraining the router's choice
+func routeTool(labels []string) agent.Tool {
+	return agent.Tool{
+		Type: "function",
+		Function: agent.FunctionDef{
+			Name:        routeToolName,
+			Description: "Select the branch the workflow should follow next",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"route": map[string]any{
+						"type":        "string",
+						"enum":        labels,
+						"description": "The chosen route",
+					},
+					"reason": map[string]any{
+						"type":        "string",
+						"description": "A short justification for the choice",
+					},
+				},
+				"required": []string{"route"},
+			},
+		},
+	}
+}
+
+func routeInstruction(labels []string) string {
+	return fmt.Sprintf("Decide which route the request should take. Call the %s function with exactly one of: %s.",
+		routeToolName, strings.Join(labels, ", "))
+}
+
+// chooseRoute extracts the chosen label from the model's reply, preferring
+// the route tool call over the reply text
+func chooseRoute(result *agent.Result, labels []string) (route, reason string) {
+	for _, call := range result.ToolCalls {
+		if call.Function.Name != routeToolName {
+			continue
+		}
+		reason, _ = call.Function.Arguments["reason"].(string)
+		if value, ok := call.Function.Arguments["route"].(string); ok {
+			if label := matchLabel(value, labels); label != "" {
+				return label, reason
+			}
+		}
+	}
+
+	if label := matchLabel(outputLabel(result.Content), labels); label != "" {
+		return label, reason
+	}
+	// Last resort: a single label mentioned anywhere in the reply
+	text := strings.ToLower(result.Content)
+	found := ""
+	for _, label := range labels {
+		if strings.Contains(text, strings.ToLower(label)) {
+			if found != "" {
+				return "", reason
+			}
+			found = label
+		}
+	}
+	return found, reason
+}
+
+func matchLabel(value string, labels []string) string {
+	value = strings.TrimSpace(value)
+	for _, label := range labels {
+		if strings.EqualFold(value, label) {
+			return label
+		}
+	}
+	return ""
+}
+
+// EditedRoute returns the route chosen by an edited router step. The output
+// names one of the node's route labels, either the way the router writes it
+// ("route: <label>" on the first line) or bare.
+func (d *DAG) EditedRoute(nodeID, output string) (string, error) {
+	line, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	if strings.HasPrefix(strings.ToLower(line), "route:") {
+		line = line[len("route:"):]
+	}
+	labels := d.RouteLabels(nodeID)
+	if label := matchLabel(line, labels); label != "" {
+		return label, nil
+	}
+	return "", fmt.Errorf("%q names none of the routes %s", strings.TrimSpace(line), strings.Join(labels, ", "))
+}
@@ -0,0 +1,41 @@
+package workflow
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Runs tracks the schedulers of executions in progress so they can be
+// reached while running, e.g. to deliver approval decisions
+type Runs struct {
+	mu         sync.RWMutex
+	schedulers map[uuid.UUID]*Scheduler
+}
+
+// NewRuns creates an empty run registry
+func NewRuns() *Runs {
+	return &Runs{schedulers: make(map[uuid.UUID]*Scheduler)}
+}
+
+// Add registers the scheduler running an execution
+func (r *Runs) Add(executionID uuid.UUID, s *Scheduler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schedulers[executionID] = s
+}
+
+// Remove forgets an execution once its scheduler has finished
+func (r *Runs) Remove(executionID uuid.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.schedulers, executionID)
+}
+
+// Get returns the scheduler running an execution
+func (r *Runs) Get(executionID uuid.UUID) (*Scheduler, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.schedulers[executionID]
+	return s, ok
+}
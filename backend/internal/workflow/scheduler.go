@@ -2,8 +2,12 @@ package workflow
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,33 +22,92 @@ type Scheduler struct {
 	dag         *DAG
 	agentStore  AgentStore
 	executor    *agent.Registry
+	tools       ToolRunner
+	recorder    ExecutionRecorder
+	httpClient  *http.Client
+	runs        *Runs
 	executionID uuid.UUID
+	// nested schedulers run map sub-graphs inside their parent's execution
+	// and leave checkpointing to it
+	nested bool
 
+	input     map[string]any
+	started   map[string]bool
 	completed map[string]bool
+	active    map[string]bool
 	results   map[string]*NodeResult
-	mu        sync.RWMutex
+
+	// Loop state, keyed by loop edge ID; carried holds the steps of earlier
+	// iterations per node
+	iterations map[string]int
+	feedback   map[string]string
+	carried    map[string][]store.Step
+
+	// Approval nodes waiting for a reviewer, keyed by node ID
+	approvals map[string]chan ApprovalDecision
+
+	// cancel stops the running execution; cancelled records a Cancel call
+	// made before Run started
+	cancel    context.CancelFunc
+	cancelled bool
+
+	// Pause state: nodes that become ready while pausing or paused are held
+	// until Resume; inFlight counts the nodes currently running
+	state    string
+	held     []heldNode
+	inFlight int
+	finished bool
+
+	mu      sync.RWMutex
+	stateMu sync.Mutex
+	wg      sync.WaitGroup
 
 	eventChan chan ExecutionEvent
 	done      chan struct{}
 }
 
+// Node statuses recorded in NodeResult.Status
+const (
+	NodeStatusSuccess   = "success"
+	NodeStatusFailed    = "failed"
+	NodeStatusSkipped   = "skipped"
+	NodeStatusCancelled = "cancelled"
+)
+
+// ErrCancelled is returned by Run when the execution was cancelled
+var ErrCancelled = errors.New("execution cancelled")
+
 // NodeResult stores the result of a node execution
 type NodeResult struct {
-	NodeID    string
-	Output    string
-	Steps     []store.Step
-	StartTime time.Time
-	EndTime   time.Time
-	Error     error
+	NodeID           string
+	Status           string
+	Output           string
+	Edited           bool
+	Frozen           bool
+	Route            string
+	ChildExecutionID string
+	Iteration        int
+	Steps            []store.Step
+	StartTime        time.Time
+	EndTime          time.Time
+	Error            error
 }
 
 // ExecutionEvent represents an event during execution
 type ExecutionEvent struct {
-	Type      string      `json:"type"`
-	NodeID    string      `json:"node_id"`
-	Step      *store.Step `json:"step,omitempty"`
-	Result    *NodeResult `json:"result,omitempty"`
-	Timestamp time.Time   `json:"timestamp"`
+	Type             string            `json:"type"`
+	NodeID           string            `json:"node_id"`
+	StepID           string            `json:"step_id,omitempty"`
+	Delta            string            `json:"delta,omitempty"`
+	Step             *store.Step       `json:"step,omitempty"`
+	Result           *NodeResult       `json:"result,omitempty"`
+	Iteration        int               `json:"iteration,omitempty"`
+	ChildExecutionID string            `json:"child_execution_id,omitempty"`
+	Approval         *ApprovalRequest  `json:"approval,omitempty"`
+	Decision         *ApprovalDecision `json:"decision,omitempty"`
+	State            string            `json:"state,omitempty"`
+	Error            string            `json:"error,omitempty"`
+	Timestamp        time.Time         `json:"timestamp"`
 }
 
 // AgentStore interface for fetching agent configurations
@@ -52,6 +115,25 @@ type AgentStore interface {
 	GetAgent(ctx context.Context, id uuid.UUID) (*store.Agent, error)
 }
 
+// ExecutionRecorder persists what an execution produces while it runs: node
+// results as they finish, child executions of sub-workflow nodes, pending
+// approvals and the pause state
+type ExecutionRecorder interface {
+	// RecordNode checkpoints a node result so the execution can be resumed
+	// after a restart
+	RecordNode(ctx context.Context, executionID uuid.UUID, node store.NodeSnapshot) error
+	StartChildExecution(ctx context.Context, parentID uuid.UUID, nodeID string, workflowID uuid.UUID, input map[string]any) (uuid.UUID, error)
+	FinishChildExecution(ctx context.Context, executionID uuid.UUID, sub *SubWorkflow, results map[string]*NodeResult, runErr error) error
+	// RequestApproval stores a pending approval with the node results so far
+	// and marks the execution waiting_for_input. A request still pending from
+	// before a restart keeps its deadline, which is written to req.ExpiresAt.
+	RequestApproval(ctx context.Context, executionID uuid.UUID, req *ApprovalRequest, nodes []store.NodeSnapshot) error
+	ResolveApproval(ctx context.Context, executionID uuid.UUID, nodeID string, decision ApprovalDecision) error
+	// RecordState stores the execution's pause state with the node results
+	// so far
+	RecordState(ctx context.Context, executionID uuid.UUID, state string, nodes []store.NodeSnapshot) error
+}
+
 // NewScheduler creates a new workflow scheduler
 func NewScheduler(dag *DAG, agentStore AgentStore, executor *agent.Registry, executionID uuid.UUID) *Scheduler {
 	return &Scheduler{
@@ -59,202 +141,661 @@ func NewScheduler(dag *DAG, agentStore AgentStore, executor *agent.Registry, exe
 		agentStore:  agentStore,
 		executor:    executor,
 		executionID: executionID,
+		started:     make(map[string]bool),
 		completed:   make(map[string]bool),
+		active:      make(map[string]bool),
 		results:     make(map[string]*NodeResult),
+		iterations:  make(map[string]int),
+		feedback:    make(map[string]string),
+		carried:     make(map[string][]store.Step),
+		approvals:   make(map[string]chan ApprovalDecision),
+		state:       ExecutionRunning,
 		eventChan:   make(chan ExecutionEvent, 100),
 		done:        make(chan struct{}),
 	}
 }
 
-// Run executes the workflow
-func (s *Scheduler) Run(ctx context.Context, input map[string]any) error {
-	log.Printf("[Scheduler] Starting execution %s", s.executionID)
+// SetTools sets the tool runner used for agent tool calls
+func (s *Scheduler) SetTools(tools ToolRunner) {
+	s.tools = tools
+}
 
-	// Initialize with input data
-	for nodeID, node := range s.dag.Nodes {
-		if len(node.DependsOn) == 0 {
-			// Entry node, can use initial input
-			s.results[nodeID] = &NodeResult{
-				NodeID: nodeID,
-				Output: "",
-			}
+// SetHTTPClient sets the client HTTP nodes send requests with. Without one
+// HTTP nodes fail.
+func (s *Scheduler) SetHTTPClient(client *http.Client) {
+	s.httpClient = client
+}
+
+// SetRecorder sets the recorder that persists child executions and approvals
+func (s *Scheduler) SetRecorder(recorder ExecutionRecorder) {
+	s.recorder = recorder
+}
+
+// SetRuns sets the registry child executions are added to while they run
+func (s *Scheduler) SetRuns(runs *Runs) {
+	s.runs = runs
+}
+
+// Restore marks nodes as already finished with the results recorded in a
+// snapshot or checkpoint, so Run continues after them instead of running them
+// again. Cancelled nodes run again, and loops resume at the iteration they
+// were on.
+func (s *Scheduler) Restore(nodes []store.NodeSnapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, n := range nodes {
+		if _, ok := s.dag.Nodes[n.NodeID]; !ok || n.Status == NodeStatusCancelled {
+			continue
+		}
+		result := &NodeResult{
+			NodeID:           n.NodeID,
+			Status:           n.Status,
+			Output:           n.FinalOutput,
+			Edited:           n.Edited,
+			Frozen:           n.Frozen,
+			Route:            n.Route,
+			ChildExecutionID: n.ChildExecutionID,
+			Iteration:        n.Iteration,
+			Steps:            n.Steps,
 		}
+		if n.Error != "" {
+			result.Error = errors.New(n.Error)
+		}
+		s.started[n.NodeID] = true
+		s.completed[n.NodeID] = true
+		s.results[n.NodeID] = result
+	}
+	for _, loop := range s.dag.Loops {
+		s.restoreLoop(loop)
+	}
+	for nodeID, result := range s.results {
+		s.resolveEdges(nodeID, result.Output)
+	}
+}
+
+// Freeze restores nodes like Restore and marks them frozen, so a replay
+// reports them as carried over from the original execution
+func (s *Scheduler) Freeze(nodes []store.NodeSnapshot) {
+	frozen := make([]store.NodeSnapshot, len(nodes))
+	for i, n := range nodes {
+		n.Frozen = true
+		frozen[i] = n
 	}
+	s.Restore(frozen)
+}
 
-	// Get ready nodes
-	readyNodes := s.dag.GetReadyNodes(s.completed)
+// Run executes the workflow. The input is the execution's input_data and is
+// delivered to entry nodes, or to any node through its input mapping.
+// Run returns once every reachable node has finished, or ErrCancelled once
+// the running nodes have stopped after ctx is done or Cancel is called.
+func (s *Scheduler) Run(ctx context.Context, input map[string]any) error {
+	log.Printf("[Scheduler] Starting execution %s", s.executionID)
 
-	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.mu.Lock()
+	s.cancel = cancel
+	if s.cancelled {
+		cancel()
+	}
+	s.mu.Unlock()
 
-	for _, nodeID := range readyNodes {
-		wg.Add(1)
-		go func(nid string) {
-			defer wg.Done()
-			s.executeNode(ctx, nid)
-		}(nodeID)
+	if input == nil {
+		input = make(map[string]any)
+	}
+	s.input = input
+
+	// Start entry nodes, and after a restore the nodes whose dependencies
+	// were restored; the rest are scheduled as their dependencies complete
+	for _, nodeID := range s.dag.GetReadyNodes(s.completed) {
+		if len(s.dag.Nodes[nodeID].DependsOn) == 0 {
+			s.schedule(ctx, nodeID)
+			continue
+		}
+		s.mu.Lock()
+		_, run, reason := s.evaluateDependencies(nodeID)
+		if run {
+			s.mu.Unlock()
+			s.schedule(ctx, nodeID)
+			continue
+		}
+		s.started[nodeID] = true
+		s.mu.Unlock()
+		s.markSkipped(ctx, nodeID, reason)
 	}
 
-	wg.Wait()
+	s.wg.Wait()
+	if ctx.Err() != nil {
+		s.cancelRemaining()
+	}
+	s.mu.Lock()
+	s.finished = true
 	close(s.eventChan)
+	s.mu.Unlock()
+
+	if ctx.Err() != nil {
+		log.Printf("[Scheduler] Execution %s cancelled", s.executionID)
+		return ErrCancelled
+	}
 
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	failed := 0
+	for _, result := range s.results {
+		if result.Status == NodeStatusFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d node(s) failed", failed)
+	}
 	return nil
 }
 
+// schedule starts a node in its own goroutine unless it was already
+// started. While the execution is pausing or paused the node is held until
+// Resume.
+func (s *Scheduler) schedule(ctx context.Context, nodeID string) {
+	s.mu.Lock()
+	if s.started[nodeID] {
+		s.mu.Unlock()
+		return
+	}
+	s.started[nodeID] = true
+	s.wg.Add(1)
+	if ctx.Err() == nil && (s.state == ExecutionPausing || s.state == ExecutionPaused) {
+		s.held = append(s.held, heldNode{ctx: ctx, nodeID: nodeID})
+		s.mu.Unlock()
+		log.Printf("[Scheduler] Node %s held while paused", nodeID)
+		return
+	}
+	s.mu.Unlock()
+	s.start(ctx, nodeID)
+}
+
+// start runs a scheduled node, which the caller has added to s.wg
+func (s *Scheduler) start(ctx context.Context, nodeID string) {
+	if ctx.Err() != nil {
+		s.markCancelled(nodeID, nil, time.Now())
+		s.wg.Done()
+		return
+	}
+
+	s.mu.Lock()
+	s.inFlight++
+	s.mu.Unlock()
+	go func() {
+		defer s.wg.Done()
+		s.executeNode(ctx, nodeID)
+		s.nodeStopped()
+	}()
+}
+
 // executeNode executes a single node
 func (s *Scheduler) executeNode(ctx context.Context, nodeID string) {
 	node := s.dag.Nodes[nodeID]
 	startTime := time.Now()
 
-	log.Printf("[Scheduler] Executing node %s (agent: %s)", nodeID, node.AgentID)
+	log.Printf("[Scheduler] Executing %s node %s (agent: %s)", node.Type, nodeID, node.AgentID)
+	s.eventChan <- ExecutionEvent{
+		Type:      "node_started",
+		NodeID:    nodeID,
+		Timestamp: startTime,
+	}
+
+	run, err := s.runNode(ctx, node)
+	endTime := time.Now()
 
-	// Get agent configuration
-	agentConfig, err := s.agentStore.GetAgent(ctx, node.AgentID)
 	if err != nil {
-		s.markFailed(nodeID, err, startTime)
+		var steps []store.Step
+		if run != nil {
+			steps = run.Steps
+		}
+		if ctx.Err() != nil {
+			s.markCancelled(nodeID, steps, startTime)
+			return
+		}
+		s.markFailed(ctx, nodeID, err, steps, startTime)
 		return
 	}
 
-	// Get executor
-	exec, ok := s.executor.Get(agentConfig.ModelConfig["provider"].(string))
-	if !ok {
-		s.markFailed(nodeID, fmt.Errorf("no executor for provider: %s", agentConfig.ModelConfig["provider"]), startTime)
+	// Store result
+	s.mu.Lock()
+	s.completed[nodeID] = true
+	s.results[nodeID] = &NodeResult{
+		NodeID:           nodeID,
+		Status:           NodeStatusSuccess,
+		Output:           run.Output,
+		Route:            run.Route,
+		ChildExecutionID: run.ChildExecutionID,
+		Iteration:        s.iteration(nodeID),
+		Steps:            s.carriedSteps(nodeID, run.Steps),
+		StartTime:        startTime,
+		EndTime:          endTime,
+	}
+	// Events are encoded after the lock is released, so they carry a copy
+	result := *s.results[nodeID]
+	s.resolveEdges(nodeID, run.Output)
+	s.mu.Unlock()
+	s.checkpoint(nodeID)
+
+	s.eventChan <- ExecutionEvent{
+		Type:      "node_complete",
+		NodeID:    nodeID,
+		Result:    &result,
+		Timestamp: endTime,
+	}
+	log.Printf("[Scheduler] Node %s completed in %v", nodeID, endTime.Sub(startTime))
+
+	// A loop's end node either starts the next iteration or exits the loop
+	if loop := s.dag.LoopOf(nodeID); loop != nil && loop.End == nodeID && s.nextIteration(loop, run.Output) {
+		s.schedule(ctx, loop.Start)
 		return
 	}
 
-	// Build input message from upstream outputs
-	input := s.buildInput(nodeID)
+	// Check for downstream nodes ready to execute
+	s.checkDownstream(ctx, nodeID)
+}
 
-	// Build config
-	config := agent.Config{
-		Provider: agentConfig.ModelConfig["provider"].(string),
-		Model:    agentConfig.ModelConfig["model"].(string),
+// runNode dispatches a node to the runner for its type. A panic while
+// running fails the node instead of the whole process.
+func (s *Scheduler) runNode(ctx context.Context, node *Node) (run *nodeRun, err error) {
+	defer recoverNode(node.ID, &err)
+	switch node.Type {
+	case NodeTypeRouter:
+		return s.runRouterNode(ctx, node)
+	case NodeTypeMap:
+		return s.runMapNode(ctx, node)
+	case NodeTypeSubWorkflow:
+		return s.runSubWorkflowNode(ctx, node)
+	case NodeTypeTransform:
+		return s.runTransformNode(ctx, node)
+	case NodeTypeHTTP:
+		return s.runHTTPNode(ctx, node)
+	case NodeTypeExpression:
+		return s.runExpressionNode(ctx, node)
+	case NodeTypeApproval:
+		return s.runApprovalNode(ctx, node)
+	default:
+		return s.runAgentNode(ctx, node)
 	}
-	if temp, ok := agentConfig.ModelConfig["temperature"].(float64); ok {
-		config.Temperature = temp
+}
+
+// recoverNode turns a panic in a deferring node runner into its error
+func recoverNode(nodeID string, err *error) {
+	if r := recover(); r != nil {
+		log.Printf("[Scheduler] Node %s panicked: %v\n%s", nodeID, r, debug.Stack())
+		*err = fmt.Errorf("node panicked: %v", r)
 	}
+}
 
-	// Execute
-	result, err := exec.Execute(ctx, agent.Message{
-		Role:    "user",
-		Content: input,
-	}, config)
+// prepareAgent loads a node's agent and resolves its executor and config
+func (s *Scheduler) prepareAgent(ctx context.Context, node *Node) (*store.Agent, agent.Executor, agent.Config, error) {
+	// Get agent configuration
+	agentConfig, err := s.agentStore.GetAgent(ctx, node.AgentID)
+	if err != nil {
+		return nil, nil, agent.Config{}, err
+	}
 
-	endTime := time.Now()
+	// Build config
+	config := buildConfig(agentConfig.ModelConfig)
 
+	// Get executor
+	exec, ok := s.executor.Get(config.Provider)
+	if !ok {
+		return nil, nil, config, fmt.Errorf("no executor for provider: %s", config.Provider)
+	}
+	return agentConfig, exec, config, nil
+}
+
+// runAgentNode runs an agent node, including its tool loop
+func (s *Scheduler) runAgentNode(ctx context.Context, node *Node) (*nodeRun, error) {
+	agentConfig, exec, config, err := s.prepareAgent(ctx, node)
 	if err != nil {
-		s.markFailed(nodeID, err, startTime)
-		return
+		return nil, err
 	}
 
-	// Record step
-	step := store.Step{
-		StepID:    uuid.NewString(),
-		Type:      "think",
-		Input:     input,
-		Output:    result.Content,
-		Prompt:    agentConfig.SystemPrompt,
-		Tokens:    result.Usage.TotalTokens,
-		LatencyMs: result.Latency.Milliseconds(),
-		Timestamp: startTime,
+	// Resolve the tools this agent may call
+	if names := toolNames(agentConfig.ModelConfig); len(names) > 0 {
+		if s.tools == nil {
+			return nil, fmt.Errorf("agent requires tools but no tool runner is configured")
+		}
+		defs, err := s.tools.Definitions(names)
+		if err != nil {
+			return nil, err
+		}
+		config.Tools = append(config.Tools, defs...)
 	}
 
-	// Send event
-	s.eventChan <- ExecutionEvent{
-		Type:      "step_complete",
-		NodeID:    nodeID,
-		Step:      &step,
-		Timestamp: time.Now(),
+	// Build input message from workflow input and upstream outputs
+	input, err := s.buildInput(node.ID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Store result
-	s.mu.Lock()
-	s.completed[nodeID] = true
-	s.results[nodeID] = &NodeResult{
-		NodeID:    nodeID,
-		Output:    result.Content,
-		Steps:     []store.Step{step},
-		StartTime: startTime,
-		EndTime:   endTime,
+	// Execute with the agent's system prompt and the upstream context
+	messages := buildMessages(agentConfig.SystemPrompt, input)
+	run := &nodeRun{}
+	err = s.runAgent(ctx, run, node.ID, exec, agentConfig.SystemPrompt, input, messages, config, maxToolIterations(agentConfig.ModelConfig))
+	return run, err
+}
+
+// execute runs a single model call, streaming token deltas to the event
+// channel when the executor supports it and streaming is not disabled
+// through model_config.extra.stream
+func (s *Scheduler) execute(ctx context.Context, exec agent.Executor, nodeID, stepID string, messages []agent.Message, config agent.Config) (*agent.Result, error) {
+	streamer, ok := exec.(agent.StreamingExecutor)
+	if stream, set := config.Extra["stream"].(bool); !ok || (set && !stream) {
+		return exec.Execute(ctx, messages, config)
 	}
-	s.mu.Unlock()
 
-	log.Printf("[Scheduler] Node %s completed in %v", nodeID, endTime.Sub(startTime))
+	return streamer.ExecuteStream(ctx, messages, config, func(delta string) {
+		s.eventChan <- ExecutionEvent{
+			Type:      "token_delta",
+			NodeID:    nodeID,
+			StepID:    stepID,
+			Delta:     delta,
+			Timestamp: time.Now(),
+		}
+	})
+}
 
-	// Check for downstream nodes ready to execute
-	s.checkDownstream(ctx, nodeID)
+// buildConfig converts an agent's model_config into an executor config
+func buildConfig(modelConfig map[string]any) agent.Config {
+	config := agent.Config{}
+	config.Provider, _ = modelConfig["provider"].(string)
+	config.Model, _ = modelConfig["model"].(string)
+	if temp, ok := modelConfig["temperature"].(float64); ok {
+		config.Temperature = &temp
+	}
+	if maxTokens, ok := modelConfig["max_tokens"].(float64); ok {
+		config.MaxTokens = int(maxTokens)
+	}
+	if topP, ok := modelConfig["top_p"].(float64); ok {
+		config.TopP = topP
+	}
+	if extra, ok := modelConfig["extra"].(map[string]any); ok {
+		config.Extra = extra
+	}
+	return config
 }
 
-func (s *Scheduler) buildInput(nodeID string) string {
+// buildMessages assembles the conversation history sent to the executor
+func buildMessages(systemPrompt, input string) []agent.Message {
+	messages := make([]agent.Message, 0, 2)
+	if systemPrompt != "" {
+		messages = append(messages, agent.Message{Role: "system", Content: systemPrompt})
+	}
+	messages = append(messages, agent.Message{Role: "user", Content: input})
+	return messages
+}
+
+// buildInput renders the user message for a node. Nodes with a prompt
+// template get the rendered template. Otherwise nodes with an input mapping
+// receive the mapped workflow input fields, entry nodes without one receive
+// the whole workflow input, and upstream outputs follow.
+func (s *Scheduler) buildInput(nodeID string) (string, error) {
 	node := s.dag.Nodes[nodeID]
-	var inputs []string
 
-	for _, depID := range node.DependsOn {
-		s.mu.RLock()
-		result, ok := s.results[depID]
-		s.mu.RUnlock()
+	// A prompt template fully replaces the default input layout
+	if node.Template != "" {
+		return renderTemplate(node.Template, s.nodeResolver(nodeID))
+	}
+
+	var sections []string
 
-		if ok && result != nil {
+	if len(node.InputMap) > 0 {
+		fields, err := mapInput(s.input, node.InputMap)
+		if err != nil {
+			return "", err
+		}
+		sections = append(sections, fields)
+	} else if len(node.DependsOn) == 0 && len(s.input) > 0 {
+		sections = append(sections, formatFields(s.input))
+	}
+
+	// Only outputs arriving over taken edges are passed on
+	var inputs []string
+	s.mu.RLock()
+	for _, edge := range s.dag.IncomingEdges(nodeID) {
+		if !s.active[edge.ID] {
+			continue
+		}
+		if result, ok := s.results[edge.Source]; ok && result != nil {
 			inputs = append(inputs, result.Output)
 		}
 	}
+	s.mu.RUnlock()
 
 	// Combine inputs
-	input := ""
+	upstream := ""
 	for i, in := range inputs {
-		input += fmt.Sprintf("Input %d: %s\n", i+1, in)
+		upstream += fmt.Sprintf("Input %d: %s\n", i+1, in)
+	}
+	if upstream != "" {
+		sections = append(sections, upstream)
 	}
-	return input
+
+	// A loop restarts with the feedback from the end of the last iteration
+	if loop := s.dag.LoopOf(nodeID); loop != nil && loop.Start == nodeID {
+		if feedback := s.loopFeedback(nodeID); feedback != "" {
+			sections = append(sections, fmt.Sprintf("Feedback (iteration %d): %s\n", s.loopIteration(nodeID)-1, feedback))
+		}
+	}
+
+	return strings.Join(sections, "\n"), nil
 }
 
-func (s *Scheduler) markFailed(nodeID string, err error, startTime time.Time) {
+func (s *Scheduler) markFailed(ctx context.Context, nodeID string, err error, steps []store.Step, startTime time.Time) {
 	s.mu.Lock()
 	s.completed[nodeID] = true
 	s.results[nodeID] = &NodeResult{
 		NodeID:    nodeID,
+		Status:    NodeStatusFailed,
+		Iteration: s.iteration(nodeID),
+		Steps:     s.carriedSteps(nodeID, steps),
 		Error:     err,
 		StartTime: startTime,
 		EndTime:   time.Now(),
 	}
+	s.resolveEdges(nodeID, "")
 	s.mu.Unlock()
+	s.checkpoint(nodeID)
 
 	s.eventChan <- ExecutionEvent{
 		Type:      "node_failed",
 		NodeID:    nodeID,
+		Error:     err.Error(),
 		Timestamp: time.Now(),
 	}
 
 	log.Printf("[Scheduler] Node %s failed: %v", nodeID, err)
+
+	s.checkDownstream(ctx, nodeID)
+}
+
+// markSkipped records a node that will not run because none of its
+// incoming edges were taken, and propagates the skip downstream
+func (s *Scheduler) markSkipped(ctx context.Context, nodeID string, reason string) {
+	now := time.Now()
+	s.mu.Lock()
+	s.completed[nodeID] = true
+	s.results[nodeID] = &NodeResult{
+		NodeID:    nodeID,
+		Status:    NodeStatusSkipped,
+		Iteration: s.iteration(nodeID),
+		Steps:     s.carriedSteps(nodeID, nil),
+		StartTime: now,
+		EndTime:   now,
+	}
+	s.resolveEdges(nodeID, "")
+	s.mu.Unlock()
+	s.checkpoint(nodeID)
+
+	s.eventChan <- ExecutionEvent{
+		Type:      "node_skipped",
+		NodeID:    nodeID,
+		Timestamp: now,
+	}
+
+	log.Printf("[Scheduler] Node %s skipped: %s", nodeID, reason)
+
+	s.checkDownstream(ctx, nodeID)
+}
+
+// markCancelled records a node interrupted or never started because the
+// execution was cancelled. Nothing downstream is started.
+func (s *Scheduler) markCancelled(nodeID string, steps []store.Step, startTime time.Time) {
+	s.mu.Lock()
+	s.completed[nodeID] = true
+	s.results[nodeID] = &NodeResult{
+		NodeID:    nodeID,
+		Status:    NodeStatusCancelled,
+		Iteration: s.iteration(nodeID),
+		Steps:     s.carriedSteps(nodeID, steps),
+		Error:     ErrCancelled,
+		StartTime: startTime,
+		EndTime:   time.Now(),
+	}
+	s.resolveEdges(nodeID, "")
+	s.mu.Unlock()
+	s.checkpoint(nodeID)
+
+	s.eventChan <- ExecutionEvent{
+		Type:      "node_cancelled",
+		NodeID:    nodeID,
+		Timestamp: time.Now(),
+	}
+
+	log.Printf("[Scheduler] Node %s cancelled", nodeID)
+}
+
+// cancelRemaining marks every node without a result as cancelled once a
+// cancelled execution has stopped
+func (s *Scheduler) cancelRemaining() {
+	for _, nodeID := range s.dag.TopologicalSort() {
+		s.mu.RLock()
+		_, done := s.results[nodeID]
+		s.mu.RUnlock()
+		if !done {
+			s.markCancelled(nodeID, nil, time.Now())
+		}
+	}
+}
+
+// resolveEdges evaluates the conditions on a node's outgoing edges. Edges
+// of failed or skipped nodes are never taken, and a router only takes the
+// edge labelled with its chosen route. Callers must hold s.mu.
+func (s *Scheduler) resolveEdges(nodeID, output string) {
+	result := s.results[nodeID]
+	succeeded := result.Status == NodeStatusSuccess
+	isRouter := s.dag.Nodes[nodeID].Type == NodeTypeRouter
+	for _, edge := range s.dag.OutgoingEdges(nodeID) {
+		taken := succeeded && edge.Condition.Evaluate(output)
+		if isRouter {
+			taken = taken && strings.EqualFold(strings.TrimSpace(edge.Label), result.Route)
+		}
+		s.active[edge.ID] = taken
+	}
 }
 
+// checkDownstream starts or skips the downstream nodes whose dependencies
+// have all finished. A node runs when at least one incoming edge was taken
+// and none of its dependencies failed; otherwise it is skipped.
 func (s *Scheduler) checkDownstream(ctx context.Context, completedNodeID string) {
 	node := s.dag.Nodes[completedNodeID]
 
 	for _, downstreamID := range node.Downstream {
-		downstream := s.dag.Nodes[downstreamID]
-
-		// Check if all dependencies are complete
-		allComplete := true
-		for _, dep := range downstream.DependsOn {
-			s.mu.RLock()
-			complete := s.completed[dep]
-			s.mu.RUnlock()
-			if !complete {
-				allComplete = false
-				break
-			}
+		s.mu.Lock()
+		if s.started[downstreamID] {
+			s.mu.Unlock()
+			continue
+		}
+
+		ready, run, reason := s.evaluateDependencies(downstreamID)
+		if !ready {
+			s.mu.Unlock()
+			continue
+		}
+		if run {
+			s.mu.Unlock()
+			s.schedule(ctx, downstreamID)
+			continue
+		}
+
+		s.started[downstreamID] = true
+		s.mu.Unlock()
+		s.markSkipped(ctx, downstreamID, reason)
+	}
+}
+
+// evaluateDependencies reports whether all of a node's dependencies have
+// finished and, if so, whether it should run. Callers must hold s.mu.
+func (s *Scheduler) evaluateDependencies(nodeID string) (ready, run bool, reason string) {
+	for _, dep := range s.dag.Nodes[nodeID].DependsOn {
+		if !s.completed[dep] {
+			return false, false, ""
 		}
+	}
 
-		if allComplete {
-			// Check if already executed
-			s.mu.RLock()
-			alreadyDone := s.completed[downstreamID]
-			s.mu.RUnlock()
+	for _, dep := range s.dag.Nodes[nodeID].DependsOn {
+		if result := s.results[dep]; result != nil && result.Status == NodeStatusFailed {
+			return true, false, fmt.Sprintf("upstream node %s failed", dep)
+		}
+	}
 
-			if !alreadyDone {
-				go s.executeNode(ctx, downstreamID)
-			}
+	for _, edge := range s.dag.IncomingEdges(nodeID) {
+		if s.active[edge.ID] {
+			return true, true, ""
 		}
 	}
+	return true, false, "no incoming edge condition matched"
+}
+
+// checkpoint hands a node's result to the recorder as soon as it is stored
+func (s *Scheduler) checkpoint(nodeID string) {
+	if s.recorder == nil || s.nested {
+		return
+	}
+	s.mu.RLock()
+	node := nodeSnapshot(s.dag, nodeID, s.results[nodeID])
+	s.mu.RUnlock()
+	if err := s.recorder.RecordNode(context.Background(), s.executionID, node); err != nil {
+		log.Printf("[Scheduler] Failed to checkpoint node %s: %v", nodeID, err)
+	}
+}
+
+// NodeSnapshots converts node results into their snapshot form
+func NodeSnapshots(dag *DAG, results map[string]*NodeResult) []store.NodeSnapshot {
+	nodes := make([]store.NodeSnapshot, 0, len(results))
+	for nodeID, result := range results {
+		nodes = append(nodes, nodeSnapshot(dag, nodeID, result))
+	}
+	return nodes
+}
+
+func nodeSnapshot(dag *DAG, nodeID string, result *NodeResult) store.NodeSnapshot {
+	agentName := nodeID
+	if node, ok := dag.Nodes[nodeID]; ok && node.AgentName != "" {
+		agentName = node.AgentName
+	}
+	errMsg := ""
+	if result.Error != nil {
+		errMsg = result.Error.Error()
+	}
+	return store.NodeSnapshot{
+		NodeID:           nodeID,
+		AgentName:        agentName,
+		Status:           result.Status,
+		Edited:           result.Edited,
+		Frozen:           result.Frozen,
+		Error:            errMsg,
+		Route:            result.Route,
+		ChildExecutionID: result.ChildExecutionID,
+		Iteration:        result.Iteration,
+		Steps:            result.Steps,
+		FinalOutput:      result.Output,
+	}
 }
 
 // Events returns the event channel
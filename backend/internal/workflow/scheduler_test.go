@@ -0,0 +1,245 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// fakeExecutor answers model calls with reply, called with the agent's
+// system prompt and the conversation so far. A nil reply fails the call.
+type fakeExecutor struct {
+	mu    sync.Mutex
+	calls map[string]int
+	reply func(system string, messages []agent.Message) *agent.Result
+}
+
+func newFakeExecutor(reply func(system string, messages []agent.Message) *agent.Result) *fakeExecutor {
+	return &fakeExecutor{calls: make(map[string]int), reply: reply}
+}
+
+func (e *fakeExecutor) Name() string {
+	return "fake"
+}
+
+func (e *fakeExecutor) Execute(ctx context.Context, messages []agent.Message, config agent.Config) (*agent.Result, error) {
+	system := ""
+	if len(messages) > 0 && messages[0].Role == "system" {
+		system = messages[0].Content
+	}
+	e.mu.Lock()
+	e.calls[system]++
+	e.mu.Unlock()
+	result := e.reply(system, messages)
+	if result == nil {
+		return nil, fmt.Errorf("model unavailable")
+	}
+	if result.Usage.TotalTokens == 0 {
+		result.Usage.TotalTokens = 1
+	}
+	return result, nil
+}
+
+func (e *fakeExecutor) Calls(system string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls[system]
+}
+
+// text replies with plain content
+func text(content string) *agent.Result {
+	return &agent.Result{Content: content, StopReason: agent.StopReasonEnd}
+}
+
+// lastUser returns the content of the last user message
+func lastUser(messages []agent.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
+
+// testAgents serves agents whose system prompt names them, all using the
+// fake executor
+type testAgents struct {
+	mu     sync.Mutex
+	agents map[uuid.UUID]*store.Agent
+}
+
+func newTestAgents() *testAgents {
+	return &testAgents{agents: make(map[uuid.UUID]*store.Agent)}
+}
+
+// add registers an agent with the given system prompt and extra model config
+func (a *testAgents) add(prompt string, modelConfig map[string]any) uuid.UUID {
+	config := map[string]any{"provider": "fake", "model": "test"}
+	for k, v := range modelConfig {
+		config[k] = v
+	}
+	id := uuid.New()
+	a.mu.Lock()
+	a.agents[id] = &store.Agent{ID: id, Name: prompt, SystemPrompt: prompt, ModelConfig: config}
+	a.mu.Unlock()
+	return id
+}
+
+func (a *testAgents) GetAgent(ctx context.Context, id uuid.UUID) (*store.Agent, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if agentConfig, ok := a.agents[id]; ok {
+		return agentConfig, nil
+	}
+	return nil, fmt.Errorf("agent %s not found", id)
+}
+
+// agentNode returns an agent node config
+func agentNode(id string, agentID uuid.UUID, data map[string]any) store.NodeConfig {
+	return store.NodeConfig{ID: id, AgentID: agentID, Data: data}
+}
+
+// typedNode returns a node config of the given type
+func typedNode(id, nodeType string, data map[string]any) store.NodeConfig {
+	if data == nil {
+		data = make(map[string]any)
+	}
+	data["type"] = nodeType
+	return store.NodeConfig{ID: id, Data: data}
+}
+
+// edge returns an unconditional edge
+func edge(id, source, target string) store.EdgeConfig {
+	return store.EdgeConfig{ID: id, Source: source, Target: target}
+}
+
+// testRun is the outcome of running a scheduler to completion
+type testRun struct {
+	err     error
+	results map[string]*NodeResult
+	events  []ExecutionEvent
+}
+
+func (r *testRun) status(nodeID string) string {
+	if result, ok := r.results[nodeID]; ok {
+		return result.Status
+	}
+	return ""
+}
+
+func (r *testRun) output(nodeID string) string {
+	if result, ok := r.results[nodeID]; ok {
+		return result.Output
+	}
+	return ""
+}
+
+// newTestScheduler builds a scheduler for wf running agents on exec
+func newTestScheduler(t *testing.T, wf *store.Workflow, agents *testAgents, exec agent.Executor) *Scheduler {
+	t.Helper()
+	dag, err := NewDAG(wf)
+	if err != nil {
+		t.Fatalf("NewDAG: %v", err)
+	}
+	registry := agent.NewRegistry()
+	if exec != nil {
+		registry.Register(exec)
+	}
+	if agents == nil {
+		agents = newTestAgents()
+	}
+	return NewScheduler(dag, agents, registry, uuid.New())
+}
+
+// runScheduler runs s with input, draining its events, and fails the test if
+// it does not finish in time
+func runScheduler(t *testing.T, s *Scheduler, input map[string]any) *testRun {
+	t.Helper()
+	run := &testRun{}
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for event := range s.Events() {
+			run.events = append(run.events, event)
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() { done <- s.Run(context.Background(), input) }()
+	select {
+	case run.err = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("scheduler did not finish")
+	}
+	<-drained
+	run.results = s.GetResults()
+	return run
+}
+
+func TestSchedulerLinear(t *testing.T) {
+	agents := newTestAgents()
+	upper := agents.add("upper", nil)
+	exec := newFakeExecutor(func(system string, messages []agent.Message) *agent.Result {
+		return text(strings.ToUpper(lastUser(messages)))
+	})
+	wf := &store.Workflow{
+		Nodes: []store.NodeConfig{
+			typedNode("greet", NodeTypeTransform, map[string]any{"template": "hello {{input.name}}"}),
+			agentNode("shout", upper, map[string]any{"prompt_template": "{{nodes.greet.output}}"}),
+		},
+		Edges: []store.EdgeConfig{edge("e1", "greet", "shout")},
+	}
+
+	run := runScheduler(t, newTestScheduler(t, wf, agents, exec), map[string]any{"name": "ada"})
+	if run.err != nil {
+		t.Fatalf("Run: %v", run.err)
+	}
+	if got := run.output("shout"); got != "HELLO ADA" {
+		t.Errorf("shout output = %q, want %q", got, "HELLO ADA")
+	}
+
+	var types []string
+	for _, event := range run.events {
+		if event.Type == "node_started" || event.Type == "node_complete" {
+			types = append(types, event.Type+":"+event.NodeID)
+		}
+	}
+	want := "node_started:greet node_complete:greet node_started:shout node_complete:shout"
+	if got := strings.Join(types, " "); got != want {
+		t.Errorf("events = %s, want %s", got, want)
+	}
+}
+
+func TestSchedulerFailureSkipsDownstream(t *testing.T) {
+	wf := &store.Workflow{
+		Nodes: []store.NodeConfig{
+			typedNode("bad", NodeTypeTransform, map[string]any{"template": "not json", "format": "json"}),
+			typedNode("after", NodeTypeTransform, map[string]any{"template": "x"}),
+		},
+		Edges: []store.EdgeConfig{edge("e1", "bad", "after")},
+	}
+	run := runScheduler(t, newTestScheduler(t, wf, nil, nil), nil)
+	if run.err == nil {
+		t.Fatal("Run succeeded with a failing node")
+	}
+	if run.status("bad") != NodeStatusFailed || run.status("after") != NodeStatusSkipped {
+		t.Errorf("statuses = %s, %s; want failed, skipped", run.status("bad"), run.status("after"))
+	}
+}
+
+func TestBuildConfigTemperature(t *testing.T) {
+	if config := buildConfig(map[string]any{"temperature": 0.0}); config.Temperature == nil || *config.Temperature != 0 {
+		t.Errorf("temperature = %v, want an explicit 0", config.Temperature)
+	}
+	if config := buildConfig(map[string]any{}); config.Temperature != nil {
+		t.Errorf("temperature = %v, want none", *config.Temperature)
+	}
+}
@@ -0,0 +1,257 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+	"github.com/Wangren-Academy/Agent/backend/internal/tools"
+
+	"github.com/google/uuid"
+)
+
+// WorkflowStore loads saved workflows for sub-workflow nodes
+type WorkflowStore interface {
+	// GetWorkflow returns the workflow at version, or the latest when version is 0
+	GetWorkflow(ctx context.Context, id uuid.UUID, version int) (*store.Workflow, error)
+}
+
+// SubWorkflow is the saved workflow a sub-workflow node runs. Workflow and
+// DAG are filled in by BuildDAG.
+type SubWorkflow struct {
+	WorkflowID uuid.UUID
+	Version    int
+	Workflow   *store.Workflow
+	DAG        *DAG
+}
+
+// parseSubWorkflow reads data.workflow_id and the optional data.version pin
+func parseSubWorkflow(data map[string]any) (*SubWorkflow, error) {
+	raw, _ := data["workflow_id"].(string)
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("workflow_id must be a workflow UUID")
+	}
+	sub := &SubWorkflow{WorkflowID: id}
+	if v, ok := data["version"].(float64); ok {
+		if v < 1 || v != float64(int(v)) {
+			return nil, fmt.Errorf("version must be a positive integer")
+		}
+		sub.Version = int(v)
+	}
+	return sub, nil
+}
+
+// BuildDAG builds a workflow's DAG and loads every sub-workflow it includes,
+// directly or inside map sub-graphs. A workflow that includes itself at any
+// depth is rejected.
+func BuildDAG(ctx context.Context, workflows WorkflowStore, wf *store.Workflow) (*DAG, error) {
+	dag, err := NewDAG(wf)
+	if err != nil {
+		return nil, err
+	}
+	var path []uuid.UUID
+	if wf.ID != uuid.Nil {
+		path = append(path, wf.ID)
+	}
+	if err := resolveSubWorkflows(ctx, workflows, dag, path); err != nil {
+		return nil, err
+	}
+	return dag, nil
+}
+
+func resolveSubWorkflows(ctx context.Context, workflows WorkflowStore, dag *DAG, path []uuid.UUID) error {
+	for nodeID, node := range dag.Nodes {
+		if node.Map != nil && node.Map.Subgraph != nil {
+			if err := resolveSubWorkflows(ctx, workflows, node.Map.Subgraph, path); err != nil {
+				return err
+			}
+		}
+		sub := node.SubWorkflow
+		if sub == nil {
+			continue
+		}
+		for _, id := range path {
+			if id == sub.WorkflowID {
+				return fmt.Errorf("node %s: recursive sub-workflow %s", nodeID, formatPath(append(path, sub.WorkflowID)))
+			}
+		}
+		if workflows == nil {
+			return fmt.Errorf("node %s: sub-workflows are not available", nodeID)
+		}
+
+		child, err := workflows.GetWorkflow(ctx, sub.WorkflowID, sub.Version)
+		if err != nil {
+			return fmt.Errorf("node %s: load sub-workflow %s: %w", nodeID, sub.WorkflowID, err)
+		}
+		childDAG, err := NewDAG(child)
+		if err != nil {
+			return fmt.Errorf("node %s: sub-workflow %s: %w", nodeID, sub.WorkflowID, err)
+		}
+		childPath := append(append([]uuid.UUID(nil), path...), sub.WorkflowID)
+		if err := resolveSubWorkflows(ctx, workflows, childDAG, childPath); err != nil {
+			return err
+		}
+		sub.Workflow = child
+		sub.DAG = childDAG
+	}
+	return nil
+}
+
+func formatPath(path []uuid.UUID) string {
+	parts := make([]string, len(path))
+	for i, id := range path {
+		parts[i] = id.String()
+	}
+	return strings.Join(parts, " -> ")
+}
+
+// runSubWorkflowNode runs the referenced workflow as a child execution and
+// uses its terminal outputs as the node's output
+func (s *Scheduler) runSubWorkflowNode(ctx context.Context, node *Node) (*nodeRun, error) {
+	sub := node.SubWorkflow
+	if sub.DAG == nil {
+		return nil, fmt.Errorf("sub-workflow %s is not loaded", sub.WorkflowID)
+	}
+
+	input, err := s.subWorkflowInput(node)
+	if err != nil {
+		return nil, err
+	}
+
+	childID := uuid.New()
+	if s.recorder != nil {
+		if childID, err = s.recorder.StartChildExecution(ctx, s.executionID, node.ID, sub.WorkflowID, input); err != nil {
+			return nil, fmt.Errorf("start child execution: %w", err)
+		}
+	}
+	s.eventChan <- ExecutionEvent{
+		Type:             "subworkflow_started",
+		NodeID:           node.ID,
+		ChildExecutionID: childID.String(),
+		Timestamp:        time.Now(),
+	}
+	log.Printf("[Scheduler] Node %s started child execution %s (workflow %s)", node.ID, childID, sub.WorkflowID)
+
+	run := &nodeRun{ChildExecutionID: childID.String()}
+	results, runErr := s.runChild(ctx, node.ID, sub.DAG, childID, input, run)
+
+	if s.recorder != nil {
+		if err := s.recorder.FinishChildExecution(context.WithoutCancel(ctx), childID, sub, results, runErr); err != nil {
+			log.Printf("[Scheduler] Failed to record child execution %s: %v", childID, err)
+		}
+	}
+	if runErr != nil {
+		return run, fmt.Errorf("sub-workflow: %w", runErr)
+	}
+	run.Output = terminalOutput(sub.DAG, results)
+	return run, nil
+}
+
+// runChild runs a nested graph in a child scheduler that shares this
+// scheduler's agents, tools, recorder, HTTP client and run registry. Child steps are
+// forwarded live under nodeID and kept on run, tagged with the child node
+// that produced them.
+func (s *Scheduler) runChild(ctx context.Context, nodeID string, dag *DAG, executionID uuid.UUID, input map[string]any, run *nodeRun) (map[string]*NodeResult, error) {
+	child := NewScheduler(dag, s.agentStore, s.executor, executionID)
+	child.SetTools(s.tools)
+	child.SetRecorder(s.recorder)
+	child.SetHTTPClient(s.httpClient)
+	child.SetRuns(s.runs)
+
+	// Sub-workflows run as executions of their own and can be reached by
+	// ID; map sub-graphs are part of this execution
+	if executionID == s.executionID {
+		child.nested = true
+	} else if s.runs != nil {
+		s.runs.Add(executionID, child)
+		defer s.runs.Remove(executionID)
+	}
+
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		for event := range child.Events() {
+			switch event.Type {
+			case "step_complete":
+				step := tagStep(*event.Step, run.item, event.NodeID)
+				s.eventChan <- ExecutionEvent{
+					Type:      event.Type,
+					NodeID:    nodeID,
+					Step:      &step,
+					Timestamp: event.Timestamp,
+				}
+			case "token_delta":
+				event.NodeID = nodeID
+				s.eventChan <- event
+			}
+		}
+	}()
+
+	err := child.Run(ctx, input)
+	<-forwarded
+
+	results := child.GetResults()
+	for _, childNodeID := range dag.TopologicalSort() {
+		if result, ok := results[childNodeID]; ok {
+			for _, step := range result.Steps {
+				run.Steps = append(run.Steps, tagStep(step, run.item, childNodeID))
+			}
+		}
+	}
+	return results, err
+}
+
+// subWorkflowInput builds the child's input_data. A prompt template that
+// renders to a JSON object is used as-is (other text is passed as "input").
+// Otherwise the input holds the mapped workflow input fields, or the whole
+// workflow input for entry nodes, plus each upstream output keyed by the
+// upstream node's name or ID.
+func (s *Scheduler) subWorkflowInput(node *Node) (map[string]any, error) {
+	if node.Template != "" {
+		rendered, err := renderTemplate(node.Template, s.nodeResolver(node.ID))
+		if err != nil {
+			return nil, err
+		}
+		if value, err := decodeOutput(rendered); err == nil {
+			if obj, ok := value.(map[string]any); ok {
+				return obj, nil
+			}
+		}
+		return map[string]any{"input": rendered}, nil
+	}
+
+	input := make(map[string]any)
+	if len(node.InputMap) > 0 {
+		for label, path := range node.InputMap {
+			value, err := tools.ExtractPath(s.input, path)
+			if err != nil {
+				return nil, fmt.Errorf("input mapping %q: %w", label, err)
+			}
+			input[label] = value
+		}
+	} else if len(node.DependsOn) == 0 {
+		for k, v := range s.input {
+			input[k] = v
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, edge := range s.dag.IncomingEdges(node.ID) {
+		if !s.active[edge.ID] {
+			continue
+		}
+		if result, ok := s.results[edge.Source]; ok && result != nil {
+			key := s.dag.Nodes[edge.Source].Name
+			if key == "" {
+				key = edge.Source
+			}
+			input[key] = itemValue(result.Output)
+		}
+	}
+	return input, nil
+}
@@ -0,0 +1,170 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/tools"
+)
+
+// templatePattern matches {{ reference }} placeholders in prompt templates
+var templatePattern = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+
+// templateRef is a parsed template placeholder. Supported forms:
+//
+//	{{input}}                          the whole workflow input as JSON
+//	{{input.topic}}                    a workflow input field
+//	{{nodes.researcher.output}}        an upstream node's output
+//	{{nodes.researcher.output.summary}} a JSON field inside that output
+//	{{item}} / {{item.title}}          the current element inside a map node
+//	{{loop.iteration}}                 the current iteration inside a loop
+//	{{loop.feedback}}                  the loop exit node's previous output
+//
+// Nodes are referenced by their data.name or, failing that, their ID.
+type templateRef struct {
+	Raw  string
+	Kind string // "input", "nodes", "item" or "loop"
+	Node string
+	Path string
+}
+
+// parseTemplate extracts and validates the references in a template
+func parseTemplate(tpl string) ([]templateRef, error) {
+	var refs []templateRef
+	for _, m := range templatePattern.FindAllStringSubmatch(tpl, -1) {
+		ref, err := parseRef(m[1])
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+func parseRef(raw string) (templateRef, error) {
+	ref := templateRef{Raw: raw}
+	head, rest, _ := strings.Cut(raw, ".")
+
+	switch head {
+	case "input", "item":
+		ref.Kind = head
+		ref.Path = rest
+		return ref, nil
+	case "loop":
+		if rest != "iteration" && rest != "feedback" {
+			return ref, fmt.Errorf("invalid template reference {{%s}}: expected loop.iteration or loop.feedback", raw)
+		}
+		ref.Kind = "loop"
+		ref.Path = rest
+		return ref, nil
+	case "nodes":
+		node, rest, _ := strings.Cut(rest, ".")
+		field, path, _ := strings.Cut(rest, ".")
+		if node == "" || field != "output" {
+			return ref, fmt.Errorf("invalid template reference {{%s}}: expected nodes.<name>.output[.field]", raw)
+		}
+		ref.Kind = "nodes"
+		ref.Node = node
+		ref.Path = path
+		return ref, nil
+	default:
+		return ref, fmt.Errorf("invalid template reference {{%s}}: must start with input, nodes, item or loop", raw)
+	}
+}
+
+// renderTemplate substitutes every placeholder using resolve
+func renderTemplate(tpl string, resolve func(templateRef) (any, error)) (string, error) {
+	var renderErr error
+	out := templatePattern.ReplaceAllStringFunc(tpl, func(match string) string {
+		if renderErr != nil {
+			return match
+		}
+		ref, err := parseRef(templatePattern.FindStringSubmatch(match)[1])
+		if err != nil {
+			renderErr = err
+			return match
+		}
+		value, err := resolve(ref)
+		if err != nil {
+			renderErr = fmt.Errorf("template reference {{%s}}: %w", ref.Raw, err)
+			return match
+		}
+		return formatValue(value)
+	})
+	return out, renderErr
+}
+
+// decodeOutput parses a node output as JSON, tolerating a surrounding
+// Markdown code fence as models often emit one
+func decodeOutput(output string) (any, error) {
+	text := strings.TrimSpace(output)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```")
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[i+1:]
+		}
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	}
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return nil, fmt.Errorf("output is not valid JSON")
+	}
+	return value, nil
+}
+
+// nodeResolver resolves references for a node, adding its loop state to
+// resolveTemplateRef
+func (s *Scheduler) nodeResolver(nodeID string) func(templateRef) (any, error) {
+	return func(ref templateRef) (any, error) {
+		if ref.Kind != "loop" || s.dag.LoopOf(nodeID) == nil {
+			return s.resolveTemplateRef(ref)
+		}
+		if ref.Path == "iteration" {
+			return s.loopIteration(nodeID), nil
+		}
+		return s.loopFeedback(nodeID), nil
+	}
+}
+
+// resolveTemplateRef looks up a reference against the workflow input and
+// the outputs of completed nodes
+func (s *Scheduler) resolveTemplateRef(ref templateRef) (any, error) {
+	switch ref.Kind {
+	case "input":
+		if ref.Path == "" {
+			return s.input, nil
+		}
+		return tools.ExtractPath(s.input, ref.Path)
+	case "nodes":
+		nodeID, ok := s.dag.ResolveNode(ref.Node)
+		if !ok {
+			return nil, fmt.Errorf("unknown node %q", ref.Node)
+		}
+		s.mu.RLock()
+		result, ok := s.results[nodeID]
+		s.mu.RUnlock()
+		if ok && result != nil && result.Status == NodeStatusSkipped {
+			// Skipped branches render as empty so join nodes can reference
+			// every branch that might have run
+			return "", nil
+		}
+		if !ok || result == nil || result.Status != NodeStatusSuccess {
+			return nil, fmt.Errorf("node %q has no output", ref.Node)
+		}
+		if ref.Path == "" {
+			return result.Output, nil
+		}
+		value, err := decodeOutput(result.Output)
+		if err != nil {
+			return nil, err
+		}
+		return tools.ExtractPath(value, ref.Path)
+	case "item":
+		return nil, fmt.Errorf("item is only available inside a map node")
+	case "loop":
+		return nil, fmt.Errorf("loop is only available inside a loop")
+	}
+	return nil, fmt.Errorf("unsupported reference")
+}
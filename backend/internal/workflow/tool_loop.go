@@ -0,0 +1,155 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+
+	"github.com/google/uuid"
+)
+
+// defaultMaxToolIterations bounds the model/tool round trips within one node
+const defaultMaxToolIterations = 8
+
+// ToolRunner resolves tool definitions for agents and executes tool calls
+type ToolRunner interface {
+	// Definitions returns the definitions of the named tools
+	Definitions(names []string) ([]agent.Tool, error)
+	// Invoke runs a single tool call and returns its textual result
+	Invoke(ctx context.Context, call agent.ToolCall) (string, error)
+}
+
+// nodeRun is the outcome of running a node
+type nodeRun struct {
+	Output           string
+	Route            string
+	ChildExecutionID string
+	Steps            []store.Step
+
+	// item tags recorded steps with the map element being processed
+	item *int
+}
+
+// runAgent calls the model and, while it requests tools, executes them and
+// feeds their results back until it answers. A model still requesting tools
+// after maxIterations turns fails the node.
+// Every model turn is recorded as a "think" step; each tool invocation adds
+// a "tool_call" step followed by a "result" step.
+func (s *Scheduler) runAgent(ctx context.Context, run *nodeRun, nodeID string, exec agent.Executor, systemPrompt, input string, messages []agent.Message, config agent.Config, maxIterations int) error {
+	for iteration := 1; ; iteration++ {
+		stepID := uuid.NewString()
+		turnStart := time.Now()
+
+		result, err := s.execute(ctx, exec, nodeID, stepID, messages, config)
+		if err != nil {
+			return err
+		}
+
+		stepInput := input
+		if iteration > 1 {
+			stepInput = fmt.Sprintf("Tool results (iteration %d)", iteration)
+		}
+		s.recordStep(nodeID, run, store.Step{
+			StepID:    stepID,
+			Type:      "think",
+			Input:     stepInput,
+			Output:    result.Content,
+			Prompt:    systemPrompt,
+			Tokens:    result.Usage.TotalTokens,
+			LatencyMs: result.Latency.Milliseconds(),
+			Timestamp: turnStart,
+		})
+		run.Output = result.Content
+
+		if len(result.ToolCalls) == 0 {
+			return nil
+		}
+		if s.tools == nil {
+			return fmt.Errorf("model requested tools but no tool runner is configured")
+		}
+		if iteration >= maxIterations {
+			return fmt.Errorf("tool loop exceeded %d iterations", maxIterations)
+		}
+
+		messages = append(messages, agent.Message{
+			Role:      "assistant",
+			Content:   result.Content,
+			ToolCalls: result.ToolCalls,
+		})
+
+		for _, call := range result.ToolCalls {
+			callStart := time.Now()
+			s.recordStep(nodeID, run, store.Step{
+				StepID:    uuid.NewString(),
+				Type:      "tool_call",
+				Tool:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+				Timestamp: callStart,
+			})
+
+			output, err := s.tools.Invoke(ctx, call)
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				// Tool failures are reported back to the model rather than
+				// failing the node, so it can recover or try another approach
+				output = "error: " + err.Error()
+			}
+
+			s.recordStep(nodeID, run, store.Step{
+				StepID:    uuid.NewString(),
+				Type:      "result",
+				Tool:      call.Function.Name,
+				Result:    output,
+				LatencyMs: time.Since(callStart).Milliseconds(),
+				Timestamp: time.Now(),
+			})
+
+			messages = append(messages, agent.Message{
+				Role:       "tool",
+				Content:    output,
+				ToolCallID: call.ID,
+			})
+		}
+	}
+}
+
+// recordStep appends a step to the run and emits it on the event channel
+func (s *Scheduler) recordStep(nodeID string, run *nodeRun, step store.Step) {
+	step.Item = run.item
+	step.Iteration = s.loopIteration(nodeID)
+	run.Steps = append(run.Steps, step)
+	s.eventChan <- ExecutionEvent{
+		Type:      "step_complete",
+		NodeID:    nodeID,
+		Step:      &step,
+		Timestamp: time.Now(),
+	}
+}
+
+// toolNames reads the list of allowed tool names from an agent's model_config
+func toolNames(modelConfig map[string]any) []string {
+	raw, ok := modelConfig["tools"].([]any)
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if name, ok := v.(string); ok && name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// maxToolIterations reads model_config.max_tool_iterations, falling back to the default
+func maxToolIterations(modelConfig map[string]any) int {
+	if n, ok := modelConfig["max_tool_iterations"].(float64); ok && n >= 1 {
+		return int(n)
+	}
+	return defaultMaxToolIterations
+}
@@ -0,0 +1,89 @@
+package workflow
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Wangren-Academy/Agent/backend/internal/agent"
+	"github.com/Wangren-Academy/Agent/backend/internal/store"
+)
+
+// echoTools offers a single "echo" tool returning its "text" argument
+type echoTools struct{}
+
+func (echoTools) Definitions(names []string) ([]agent.Tool, error) {
+	defs := make([]agent.Tool, 0, len(names))
+	for _, name := range names {
+		defs = append(defs, agent.Tool{Type: "function", Function: agent.FunctionDef{Name: name}})
+	}
+	return defs, nil
+}
+
+func (echoTools) Invoke(ctx context.Context, call agent.ToolCall) (string, error) {
+	text, _ := call.Function.Arguments["text"].(string)
+	return text, nil
+}
+
+func toolCall(text string) *agent.Result {
+	return &agent.Result{
+		StopReason: agent.StopReasonToolCalls,
+		ToolCalls: []agent.ToolCall{{
+			ID:       "call_" + text,
+			Type:     "function",
+			Function: agent.FunctionCall{Name: "echo", Arguments: map[string]any{"text": text}},
+		}},
+	}
+}
+
+func TestToolLoop(t *testing.T) {
+	agents := newTestAgents()
+	id := agents.add("caller", map[string]any{"tools": []any{"echo"}})
+	exec := newFakeExecutor(func(system string, messages []agent.Message) *agent.Result {
+		last := messages[len(messages)-1]
+		if last.Role == "tool" {
+			return text("tool said " + last.Content)
+		}
+		return toolCall("pong")
+	})
+	wf := &store.Workflow{Nodes: []store.NodeConfig{agentNode("a", id, nil)}}
+	s := newTestScheduler(t, wf, agents, exec)
+	s.SetTools(echoTools{})
+
+	run := runScheduler(t, s, nil)
+	if run.err != nil {
+		t.Fatalf("Run: %v", run.err)
+	}
+	if got := run.output("a"); got != "tool said pong" {
+		t.Errorf("output = %q", got)
+	}
+	var types []string
+	for _, step := range run.results["a"].Steps {
+		types = append(types, step.Type)
+	}
+	if got := strings.Join(types, ","); got != "think,tool_call,result,think" {
+		t.Errorf("steps = %s", got)
+	}
+}
+
+func TestToolLoopIterationLimit(t *testing.T) {
+	agents := newTestAgents()
+	id := agents.add("looper", map[string]any{"tools": []any{"echo"}, "max_tool_iterations": float64(3)})
+	exec := newFakeExecutor(func(system string, messages []agent.Message) *agent.Result {
+		return toolCall("again")
+	})
+	wf := &store.Workflow{Nodes: []store.NodeConfig{agentNode("a", id, nil)}}
+	s := newTestScheduler(t, wf, agents, exec)
+	s.SetTools(echoTools{})
+
+	run := runScheduler(t, s, nil)
+	if run.status("a") != NodeStatusFailed {
+		t.Fatalf("status = %s, want failed", run.status("a"))
+	}
+	if err := run.results["a"].Error; err == nil || !strings.Contains(err.Error(), "exceeded 3 iterations") {
+		t.Errorf("error = %v", err)
+	}
+	if calls := exec.Calls("looper"); calls != 3 {
+		t.Errorf("model called %d times, want 3", calls)
+	}
+}
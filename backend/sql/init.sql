@@ -27,6 +27,16 @@ CREATE TABLE IF NOT EXISTS workflows (
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
+-- 2a. 工作流历史版本 (sub-workflow nodes may pin a version)
+CREATE TABLE IF NOT EXISTS workflow_versions (
+    workflow_id UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    nodes JSONB NOT NULL DEFAULT '[]',
+    edges JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (workflow_id, version)
+);
+
 -- 3. 工作流节点关联表
 CREATE TABLE IF NOT EXISTS workflow_nodes (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -44,28 +54,62 @@ CREATE TABLE IF NOT EXISTS executions (
     workflow_id UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
     status VARCHAR(20) DEFAULT 'running',
     snapshot JSONB NOT NULL DEFAULT '{}',
+    input_data JSONB NOT NULL DEFAULT '{}',
+    parent_execution_id UUID REFERENCES executions(id) ON DELETE CASCADE,
+    parent_node_id VARCHAR(100),
+    workflow_version INT,
+    replay_of UUID REFERENCES executions(id) ON DELETE SET NULL,
     started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     finished_at TIMESTAMP WITH TIME ZONE,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
+-- Columns added after the initial release
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS input_data JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS parent_execution_id UUID REFERENCES executions(id) ON DELETE CASCADE;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS parent_node_id VARCHAR(100);
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS workflow_version INT;
+ALTER TABLE executions ADD COLUMN IF NOT EXISTS replay_of UUID REFERENCES executions(id) ON DELETE SET NULL;
+
 -- 5. 详细执行日志
 CREATE TABLE IF NOT EXISTS execution_logs (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     execution_id UUID NOT NULL REFERENCES executions(id) ON DELETE CASCADE,
-    node_id UUID,
+    node_id VARCHAR(100),
     step_type VARCHAR(20),
     content JSONB,
     sequence INT,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
+-- 6. 人工审批 (approval nodes waiting for a reviewer)
+CREATE TABLE IF NOT EXISTS execution_approvals (
+    execution_id UUID NOT NULL REFERENCES executions(id) ON DELETE CASCADE,
+    node_id VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    pending_output TEXT NOT NULL DEFAULT '',
+    timeout_action VARCHAR(20) NOT NULL DEFAULT 'reject',
+    expires_at TIMESTAMP WITH TIME ZONE,
+    action VARCHAR(20),
+    output TEXT,
+    comment TEXT,
+    timed_out BOOLEAN NOT NULL DEFAULT FALSE,
+    requested_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    decided_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (execution_id, node_id)
+);
+
+-- Workflow node ids are not UUIDs
+ALTER TABLE execution_logs ALTER COLUMN node_id TYPE VARCHAR(100) USING node_id::text;
+
 -- Create indexes
 CREATE INDEX IF NOT EXISTS idx_agents_memory_vector ON agents USING ivfflat (memory_vector vector_cosine_ops) WITH (lists = 100);
 CREATE INDEX IF NOT EXISTS idx_executions_workflow ON executions(workflow_id);
 CREATE INDEX IF NOT EXISTS idx_executions_status ON executions(status);
+CREATE INDEX IF NOT EXISTS idx_executions_parent ON executions(parent_execution_id);
 CREATE INDEX IF NOT EXISTS idx_workflow_nodes_workflow ON workflow_nodes(workflow_id);
 CREATE INDEX IF NOT EXISTS idx_execution_logs_execution ON execution_logs(execution_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_execution_logs_sequence ON execution_logs(execution_id, sequence);
 
 -- Update timestamp trigger function
 CREATE OR REPLACE FUNCTION update_updated_at()
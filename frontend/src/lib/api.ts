@@ -1,4 +1,12 @@
-import type { Agent, Workflow, Execution, ApiResponse } from "./types";
+import type {
+  Agent,
+  Workflow,
+  Execution,
+  ExecutionDiff,
+  ExecutionLogPage,
+  ApiResponse,
+  ApprovalDecision,
+} from "./types";
 
 const API_BASE = process.env.NEXT_PUBLIC_API_URL || "http://localhost:8080";
 
@@ -92,15 +100,59 @@ export const executionApi = {
 
   get: (id: string) => fetchApi<Execution>(`/api/v1/executions/${id}`),
 
+  diff: (id: string, otherId: string) =>
+    fetchApi<ExecutionDiff>(`/api/v1/executions/${id}/diff/${otherId}`),
+
+  logs: (id: string, after = 0) =>
+    fetchApi<ExecutionLogPage>(`/api/v1/executions/${id}/logs?after=${after}`),
+
   replay: (id: string, modifiedSteps?: Array<{ step_id: string; new_output: string }>) =>
     fetchApi<{
       original_execution_id: string;
       new_execution_id: string;
       status: string;
+      modifications_applied: number;
+      frozen_nodes: string[];
+      rerun_nodes: string[];
     }>(`/api/v1/executions/${id}/replay`, {
       method: "POST",
       body: JSON.stringify({ modified_steps: modifiedSteps }),
     }),
+
+  cancel: (id: string) =>
+    fetchApi<{ execution_id: string; status: string }>(`/api/v1/executions/${id}/cancel`, {
+      method: "POST",
+    }),
+
+  pause: (id: string) =>
+    fetchApi<{ execution_id: string; status: string }>(`/api/v1/executions/${id}/pause`, {
+      method: "POST",
+    }),
+
+  resume: (id: string) =>
+    fetchApi<{ execution_id: string; status: string }>(`/api/v1/executions/${id}/resume`, {
+      method: "POST",
+    }),
+
+  editOutput: (id: string, nodeId: string, output: string) =>
+    fetchApi<{ message: string }>(`/api/v1/executions/${id}/nodes/${nodeId}/output`, {
+      method: "PUT",
+      body: JSON.stringify({ output }),
+    }),
+
+  decide: (id: string, nodeId: string, decision: ApprovalDecision) =>
+    fetchApi<{ message: string }>(`/api/v1/executions/${id}/approvals/${nodeId}`, {
+      method: "POST",
+      body: JSON.stringify(decision),
+    }),
+};
+
+// Model discovery API
+export const modelApi = {
+  listLocal: (api: "ollama" | "openai" = "ollama") =>
+    fetchApi<{ healthy: boolean; api: string; models: string[]; error?: string }>(
+      `/api/v1/models/local?api=${api}`
+    ),
 };
 
 // Health check
@@ -15,6 +15,9 @@ export interface ModelConfig {
   temperature?: number;
   max_tokens?: number;
   top_p?: number;
+  tools?: string[];
+  max_tool_iterations?: number;
+  extra?: Record<string, unknown>;
 }
 
 // Workflow types
@@ -33,7 +36,23 @@ export interface NodeConfig {
   id: string;
   agent_id: string;
   position: Position;
-  data?: Record<string, unknown>;
+  data?: NodeData;
+}
+
+// Set through data.type; nodes without a type are agents
+export type NodeType =
+  | "agent"
+  | "router"
+  | "map"
+  | "subworkflow"
+  | "transform"
+  | "http"
+  | "expression"
+  | "approval";
+
+export interface NodeData extends Record<string, unknown> {
+  type?: NodeType;
+  name?: string;
 }
 
 export interface Position {
@@ -45,6 +64,23 @@ export interface EdgeConfig {
   id: string;
   source: string;
   target: string;
+  label?: string;
+  condition?: EdgeCondition;
+  loop?: EdgeLoop;
+}
+
+export interface EdgeLoop {
+  max_iterations: number;
+  exit?: EdgeCondition;
+}
+
+export interface EdgeCondition {
+  type: "contains" | "regex" | "json" | "label";
+  value?: string;
+  path?: string;
+  operator?: "eq" | "ne" | "gt" | "gte" | "lt" | "lte" | "contains" | "exists";
+  case_sensitive?: boolean;
+  negate?: boolean;
 }
 
 // Execution types
@@ -53,12 +89,65 @@ export interface Execution {
   workflow_id: string;
   status: ExecutionStatus;
   snapshot: Snapshot;
+  input_data?: Record<string, unknown>;
+  parent_execution_id?: string;
+  parent_node_id?: string;
+  workflow_version?: number;
+  replay_of?: string;
+  children?: ChildExecution[];
+  approvals?: Approval[];
   started_at: string;
   finished_at?: string;
   created_at: string;
 }
 
-export type ExecutionStatus = "running" | "success" | "failed" | "replaying";
+export interface ChildExecution {
+  id: string;
+  workflow_id: string;
+  node_id: string;
+  status: ExecutionStatus;
+}
+
+export type ExecutionStatus =
+  | "running"
+  | "pausing"
+  | "paused"
+  | "resuming"
+  | "waiting_for_input"
+  | "success"
+  | "failed"
+  | "cancelled"
+  | "replaying";
+
+export type ApprovalAction = "approve" | "reject" | "edit";
+
+export interface Approval {
+  node_id: string;
+  status: "pending" | "decided" | "expired";
+  pending_output: string;
+  timeout_action: "approve" | "reject";
+  expires_at?: string;
+  action?: ApprovalAction;
+  output?: string;
+  comment?: string;
+  timed_out: boolean;
+  requested_at: string;
+  decided_at?: string;
+}
+
+export interface ApprovalRequest {
+  node_id: string;
+  output: string;
+  timeout_action: "approve" | "reject";
+  expires_at?: string;
+}
+
+export interface ApprovalDecision {
+  action: ApprovalAction;
+  output?: string;
+  comment?: string;
+  timed_out?: boolean;
+}
 
 export interface Snapshot {
   workflow_id: string;
@@ -68,9 +157,18 @@ export interface Snapshot {
   execution_meta: MetaInfo;
 }
 
+export type NodeStatus = "success" | "failed" | "skipped" | "cancelled";
+
 export interface NodeSnapshot {
   node_id: string;
   agent_name: string;
+  status?: NodeStatus;
+  edited?: boolean;
+  frozen?: boolean;
+  error?: string;
+  route?: string;
+  child_execution_id?: string;
+  iteration?: number;
   steps: Step[];
   final_output: string;
 }
@@ -87,6 +185,9 @@ export interface Step {
   tool?: string;
   arguments?: Record<string, unknown>;
   result?: string;
+  item?: number;
+  iteration?: number;
+  sub_node_id?: string;
 }
 
 export type StepType = "think" | "tool_call" | "result";
@@ -97,18 +198,104 @@ export interface MetaInfo {
   duration_ms: number;
 }
 
+// Execution diff types
+export interface Usage {
+  tokens: number;
+  latency_ms: number;
+  cost: number;
+}
+
+export interface DiffLine {
+  op: "equal" | "insert" | "delete";
+  text: string;
+}
+
+export type NodeChange = "rerun" | "frozen" | "edited" | "added" | "removed";
+
+export interface NodeDiff {
+  node_id: string;
+  change: NodeChange;
+  status_a?: NodeStatus;
+  status_b?: NodeStatus;
+  output_changed: boolean;
+  output_diff?: DiffLine[];
+  usage_a: Usage;
+  usage_b: Usage;
+  delta: Usage;
+}
+
+export interface Divergence {
+  node_id: string;
+  route_a?: string;
+  route_b?: string;
+  next_a: string[];
+  next_b: string[];
+}
+
+export interface ExecutionSummary {
+  id: string;
+  workflow_id: string;
+  workflow_version?: number;
+  status: ExecutionStatus;
+  replay_of?: string;
+}
+
+export interface ExecutionDiff {
+  execution_a: ExecutionSummary;
+  execution_b: ExecutionSummary;
+  nodes: NodeDiff[];
+  path: {
+    only_a: string[];
+    only_b: string[];
+    divergence: Divergence[];
+  };
+  total_a: Usage;
+  total_b: Usage;
+  delta: Usage;
+  carried_over: Usage;
+}
+
+// Execution journal types
+export interface ExecutionLog {
+  id: string;
+  execution_id: string;
+  node_id?: string;
+  step_type: string;
+  content: WebSocketEvent & ExecutionEventData;
+  sequence: number;
+  created_at: string;
+}
+
+export interface ExecutionLogPage {
+  execution_id: string;
+  logs: ExecutionLog[];
+  last_sequence: number;
+  has_more: boolean;
+}
+
 // WebSocket event types
 export interface WebSocketEvent {
   type: string;
   execution_id?: string;
+  sequence?: number;
   data?: ExecutionEventData;
   timestamp?: string;
 }
 
 export interface ExecutionEventData {
   node_id?: string;
+  step_id?: string;
+  delta?: string;
   step?: Step;
   result?: NodeResult;
+  iteration?: number;
+  child_execution_id?: string;
+  approval?: ApprovalRequest;
+  decision?: ApprovalDecision;
+  state?: ExecutionStatus;
+  execution_id?: string;
+  original_execution_id?: string;
+  error?: string;
 }
 
 export interface NodeResult {
@@ -1,15 +1,22 @@
-import type { WebSocketEvent, Step } from "./types";
+import type { WebSocketEvent, Step, ApprovalAction } from "./types";
 
 const WS_BASE = process.env.NEXT_PUBLIC_API_URL?.replace("http", "ws") || "ws://localhost:8080";
 
 export type StepUpdateHandler = (step: Step, nodeId: string) => void;
 export type ConnectionHandler = (connected: boolean) => void;
+export type TokenDeltaHandler = (delta: string, nodeId: string, stepId: string) => void;
+export type ForkHandler = (executionId: string, originalExecutionId: string) => void;
 
 export class ExecutionWebSocket {
   private ws: WebSocket | null = null;
   private executionId: string;
+  // Sequence of the last journaled event received, so reconnects resume
+  // after it instead of missing or repeating events
+  private lastSequence = 0;
   private onStepUpdate: StepUpdateHandler;
   private onConnectionChange?: ConnectionHandler;
+  private onTokenDelta?: TokenDeltaHandler;
+  private onFork?: ForkHandler;
   private reconnectAttempts = 0;
   private maxReconnectAttempts = 5;
   private reconnectDelay = 1000;
@@ -17,17 +24,23 @@ export class ExecutionWebSocket {
   constructor(
     executionId: string,
     onStepUpdate: StepUpdateHandler,
-    onConnectionChange?: ConnectionHandler
+    onConnectionChange?: ConnectionHandler,
+    onTokenDelta?: TokenDeltaHandler,
+    onFork?: ForkHandler
   ) {
     this.executionId = executionId;
     this.onStepUpdate = onStepUpdate;
     this.onConnectionChange = onConnectionChange;
+    this.onTokenDelta = onTokenDelta;
+    this.onFork = onFork;
     this.connect();
   }
 
   private connect() {
     try {
-      this.ws = new WebSocket(`${WS_BASE}/ws/executions/${this.executionId}`);
+      this.ws = new WebSocket(
+        `${WS_BASE}/ws/executions/${this.executionId}?since=${this.lastSequence}`
+      );
 
       this.ws.onopen = () => {
         console.log(`[WebSocket] Connected to execution ${this.executionId}`);
@@ -38,6 +51,9 @@ export class ExecutionWebSocket {
       this.ws.onmessage = (event) => {
         try {
           const payload: WebSocketEvent = JSON.parse(event.data);
+          if (payload.sequence) {
+            this.lastSequence = payload.sequence;
+          }
           this.handleMessage(payload);
         } catch (error) {
           console.error("[WebSocket] Failed to parse message:", error);
@@ -68,11 +84,43 @@ export class ExecutionWebSocket {
         }
         break;
 
+      case "token_delta":
+        if (event.data?.delta && event.data?.node_id && event.data?.step_id) {
+          this.onTokenDelta?.(event.data.delta, event.data.node_id, event.data.step_id);
+        }
+        break;
+
+      case "node_started":
       case "node_complete":
+      case "node_result":
       case "node_failed":
+      case "node_skipped":
+      case "node_cancelled":
+      case "loop_iteration":
+      case "subworkflow_started":
+      case "approval_requested":
+      case "approval_resolved":
+      case "output_edited":
         console.log(`[WebSocket] Node event: ${event.type}`, event.data);
         break;
 
+      case "execution_forked":
+        // The server moved this connection to the replay of an edited step
+        if (event.data?.execution_id) {
+          this.executionId = event.data.execution_id;
+          this.lastSequence = 0;
+          this.onFork?.(event.data.execution_id, event.data.original_execution_id || "");
+        }
+        break;
+
+      case "execution_state":
+        console.log(`[WebSocket] Execution ${event.data?.state}`);
+        break;
+
+      case "error":
+        console.error("[WebSocket] Request failed:", event.data);
+        break;
+
       case "execution_complete":
         console.log("[WebSocket] Execution complete");
         break;
@@ -94,16 +142,46 @@ export class ExecutionWebSocket {
   }
 
   sendModification(stepId: string, newOutput: string) {
+    this.send({
+      type: "modify_step",
+      data: {
+        step_id: stepId,
+        new_output: newOutput,
+      },
+    });
+  }
+
+  sendApproval(nodeId: string, action: ApprovalAction, newOutput?: string, comment?: string) {
+    this.send({
+      type: "approval",
+      data: {
+        node_id: nodeId,
+        action,
+        new_output: newOutput,
+        comment,
+      },
+    });
+  }
+
+  sendCancel() {
+    this.send({ type: "cancel", data: {} });
+  }
+
+  sendPause() {
+    this.send({ type: "pause", data: {} });
+  }
+
+  sendResume() {
+    this.send({ type: "resume", data: {} });
+  }
+
+  sendOutputEdit(nodeId: string, newOutput: string) {
+    this.send({ type: "edit_output", data: { node_id: nodeId, new_output: newOutput } });
+  }
+
+  private send(message: unknown) {
     if (this.ws?.readyState === WebSocket.OPEN) {
-      this.ws.send(
-        JSON.stringify({
-          type: "modify_step",
-          data: {
-            step_id: stepId,
-            new_output: newOutput,
-          },
-        })
-      );
+      this.ws.send(JSON.stringify(message));
     } else {
       console.error("[WebSocket] Cannot send - connection not open");
     }
@@ -128,6 +206,10 @@ export function useExecutionWebSocket(executionId: string | null) {
   const [socket, setSocket] = useState<ExecutionWebSocket | null>(null);
   const [connected, setConnected] = useState(false);
   const [steps, setSteps] = useState<Map<string, Step[]>>(new Map());
+  // Partial output of steps that are still streaming, keyed by node id
+  const [streaming, setStreaming] = useState<Map<string, string>>(new Map());
+  // Execution the socket follows, which moves to a replay when a step is edited
+  const [currentId, setCurrentId] = useState<string | null>(executionId);
 
   const handleStepUpdate = useCallback((step: Step, nodeId: string) => {
     setSteps((prev) => {
@@ -136,9 +218,30 @@ export function useExecutionWebSocket(executionId: string | null) {
       newMap.set(nodeId, [...nodeSteps, step]);
       return newMap;
     });
+    setStreaming((prev) => {
+      if (!prev.has(nodeId)) return prev;
+      const newMap = new Map(prev);
+      newMap.delete(nodeId);
+      return newMap;
+    });
+  }, []);
+
+  const handleTokenDelta = useCallback((delta: string, nodeId: string) => {
+    setStreaming((prev) => {
+      const newMap = new Map(prev);
+      newMap.set(nodeId, (newMap.get(nodeId) || "") + delta);
+      return newMap;
+    });
+  }, []);
+
+  const handleFork = useCallback((forkedId: string) => {
+    setCurrentId(forkedId);
+    setSteps(new Map());
+    setStreaming(new Map());
   }, []);
 
   useEffect(() => {
+    setCurrentId(executionId);
     if (!executionId) {
       socket?.disconnect();
       setSocket(null);
@@ -149,19 +252,26 @@ export function useExecutionWebSocket(executionId: string | null) {
     const ws = new ExecutionWebSocket(
       executionId,
       handleStepUpdate,
-      setConnected
+      setConnected,
+      handleTokenDelta,
+      handleFork
     );
     setSocket(ws);
 
     return () => {
       ws.disconnect();
     };
-  }, [executionId, handleStepUpdate]);
+  }, [executionId, handleStepUpdate, handleTokenDelta, handleFork]);
 
   return {
     socket,
+    executionId: currentId,
     connected,
     steps,
-    clearSteps: () => setSteps(new Map()),
+    streaming,
+    clearSteps: () => {
+      setSteps(new Map());
+      setStreaming(new Map());
+    },
   };
 }